@@ -0,0 +1,221 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// bucketConfigBucket holds per-bucket settings keyed by bucket name. Each
+// entry is encrypted and bound to its bucket name, so settings can neither be
+// read nor moved to another bucket without the database key.
+var bucketConfigBucket = []byte("securebolt_bucket_config")
+
+// bucketConfigKey is the binding key of bucket settings entries.
+var bucketConfigKey = []byte("securebolt bucket config")
+
+// CompressionType selects whether a bucket compresses its values.
+type CompressionType byte
+
+const (
+	CompressionDefault CompressionType = iota // Follow Options.Compression
+	CompressionNone                           // Never compress values
+	CompressionDeflate                        // DEFLATE-compress values
+)
+
+// bucketConfig is the decoded form of a bucket's settings. It is encoded as
+// one byte per field, in declaration order; fields added later are appended
+// so that older entries decode with the remaining fields at their defaults.
+type bucketConfig struct {
+	compression CompressionType
+	padding     int  // SetPadding block size, zero when values are not padded
+	bound       bool // Values are bound to their bucket and key, recorded at creation
+}
+
+// Bits of the encoded bucket options byte.
+const bucketBound = 1
+
+// paddingPowerOfTwo is the encoded padding of PadToPowerOfTwo. Fixed block
+// sizes are encoded as their base-2 logarithm.
+const paddingPowerOfTwo = 0xff
+
+// maxPaddingBlockSize is the largest block size SetPadding accepts.
+const maxPaddingBlockSize = 1 << 20
+
+// marshal encodes the settings.
+func (c *bucketConfig) marshal() []byte {
+	var padding byte
+	switch {
+	case c.padding == PadToPowerOfTwo:
+		padding = paddingPowerOfTwo
+	case c.padding > 1:
+		padding = byte(bits.Len(uint(c.padding)) - 1)
+	}
+	var options byte
+	if c.bound {
+		options |= bucketBound
+	}
+	return []byte{byte(c.compression), padding, options}
+}
+
+// unmarshalBucketConfig decodes settings encoded by marshal.
+func unmarshalBucketConfig(data []byte) (*bucketConfig, error) {
+	c := &bucketConfig{}
+	if len(data) > 0 {
+		c.compression = CompressionType(data[0])
+	}
+	if c.compression > CompressionDeflate {
+		return nil, fmt.Errorf("unknown compression type %d", c.compression)
+	}
+	if len(data) > 1 {
+		switch p := data[1]; {
+		case p == paddingPowerOfTwo:
+			c.padding = PadToPowerOfTwo
+		case 1<<p > maxPaddingBlockSize:
+			return nil, fmt.Errorf("unknown padding %d", p)
+		case p > 0:
+			c.padding = 1 << p
+		}
+	}
+	if len(data) > 2 {
+		if data[2]&^bucketBound != 0 {
+			return nil, fmt.Errorf("unknown bucket options %#x", data[2])
+		}
+		c.bound = data[2]&bucketBound != 0
+	}
+	return c, nil
+}
+
+// SetCompression sets whether values stored in this bucket from now on are
+// compressed, overriding Options.Compression; CompressionDefault removes the
+// override. Use CompressionNone for buckets holding already-compressed data
+// such as images. The setting is stored encrypted in the database and
+// applies to every later transaction. Existing values are not rewritten;
+// each value records whether it was compressed, so mixed buckets read back
+// correctly. SetCompression must be called within Update.
+func (sb *SecureBucket) SetCompression(c CompressionType) error {
+	if c > CompressionDeflate {
+		return fmt.Errorf("unknown compression type %d", c)
+	}
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return err
+	}
+	updated := *cfg
+	updated.compression = c
+	return sb.storeBucketSettings(&updated)
+}
+
+// SetPadding makes values stored in this bucket from now on hide their
+// length. Before encryption, each value's plaintext is prefixed with its
+// true length and zero-padded up to the next multiple of blockSize, or to
+// the next power of two with PadToPowerOfTwo, and trimmed back on read. A
+// value then only reveals which block size, or power of two, its length
+// rounds up to, at the price of the padding's storage. blockSize must be a
+// power of two no larger than 1 MiB; zero or one turns padding off. Padding
+// applies after compression. The setting is stored encrypted in the
+// database and applies to every later transaction. Existing values are not
+// rewritten; each value records whether it was padded. SetPadding must be
+// called within Update.
+func (sb *SecureBucket) SetPadding(blockSize int) error {
+	if blockSize != PadToPowerOfTwo && (blockSize < 0 || blockSize > maxPaddingBlockSize || blockSize&(blockSize-1) != 0) {
+		return fmt.Errorf("padding block size must be a power of two up to %d, got %d", maxPaddingBlockSize, blockSize)
+	}
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return err
+	}
+	updated := *cfg
+	updated.padding = blockSize
+	if blockSize == 1 {
+		updated.padding = 0
+	}
+	return sb.storeBucketSettings(&updated)
+}
+
+// recordDefaults stores the settings a new bucket adopts from the options in
+// effect when it is created, so that they keep applying to the bucket when
+// the database is later opened with other options. Every new bucket gets a
+// record: one created with Options.StrictSecurity keeps binding its values to
+// their bucket and key, and one created without it records that it does not.
+// Compression is recorded as CompressionDefault, so the bucket keeps
+// following Options.Compression until SetCompression overrides it.
+func (sb *SecureBucket) recordDefaults() error {
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return err
+	}
+	updated := *cfg
+	updated.bound = sb.tx.db.opts.StrictSecurity
+	return sb.storeBucketSettings(&updated)
+}
+
+// compresses reports whether values put into the bucket are compressed.
+func (sb *SecureBucket) compresses() (bool, error) {
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return false, err
+	}
+	switch cfg.compression {
+	case CompressionNone:
+		return false, nil
+	case CompressionDeflate:
+		return true, nil
+	default:
+		return sb.tx.db.opts.Compression, nil
+	}
+}
+
+// bucketSettings returns the bucket's settings, loading them on first use.
+// Buckets without stored settings use the defaults.
+func (sb *SecureBucket) bucketSettings() (*bucketConfig, error) {
+	if sb.config != nil {
+		return sb.config, nil
+	}
+	cfg := &bucketConfig{}
+	if configs := sb.tx.tx.Bucket(bucketConfigBucket); configs != nil {
+		if stored := configs.Get(sb.name); stored != nil {
+			data, flags, err := openEnvelopeFlags(stored, sb.aead, &binding{bucket: sb.name, key: bucketConfigKey})
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt bucket settings: %w", err)
+			}
+			if flags != flagBound {
+				return nil, errors.New("bucket settings are not bound to their bucket")
+			}
+			if cfg, err = unmarshalBucketConfig(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sb.config = cfg
+	return cfg, nil
+}
+
+// storeBucketSettings encrypts and stores the bucket's settings.
+func (sb *SecureBucket) storeBucketSettings(cfg *bucketConfig) error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	configs, err := sb.tx.tx.CreateBucketIfNotExists(bucketConfigBucket)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealEnvelope(cfg.marshal(), sb.aead, flagBound, &binding{bucket: sb.name, key: bucketConfigKey})
+	if err != nil {
+		return err
+	}
+	if err := configs.Put(sb.name, sealed); err != nil {
+		return err
+	}
+	sb.config = cfg
+	return nil
+}
+
+// deleteBucketConfig removes the settings of a bucket that is being deleted.
+func (stx *SecureTx) deleteBucketConfig(name []byte) error {
+	configs := stx.tx.Bucket(bucketConfigBucket)
+	if configs == nil {
+		return nil
+	}
+	return configs.Delete(name)
+}
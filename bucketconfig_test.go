@@ -0,0 +1,255 @@
+package securebolt
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSetCompression(t *testing.T) {
+	filename := "test_bucket_compression.db"
+	password := "secure-test-password"
+	value := bytes.Repeat([]byte("very compressible "), 50)
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		text, err := tx.CreateBucket([]byte("text"))
+		if err != nil {
+			return err
+		}
+		if err := text.SetCompression(CompressionDeflate); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket([]byte("images"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure buckets: %v", err)
+	}
+	db.Close()
+
+	// The setting persists across reopen
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		for _, name := range []string{"text", "images"} {
+			b, err := tx.Bucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("key"), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		for name, wantCompressed := range map[string]bool{"text": true, "images": false} {
+			b, err := tx.Bucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			got, err := b.Get([]byte("key"))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, value) {
+				t.Fatalf("Value in %q does not round-trip", name)
+			}
+			h, _, _, _, _ := parseEnvelope(tx.Bolt().Bucket([]byte(name)).Get([]byte("key")), b.aead.NonceSize())
+			if compressed := h.flags&flagCompressed != 0; compressed != wantCompressed {
+				t.Fatalf("Value in %q compressed=%v, expected %v", name, compressed, wantCompressed)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+}
+
+func TestSetPadding(t *testing.T) {
+	filename := "test_bucket_padding.db"
+	password := "secure-test-password"
+	short := []byte("no")
+	long := []byte("a considerably longer explanation")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		for name, blockSize := range map[string]int{"blocks": 64, "powers": PadToPowerOfTwo} {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := b.SetPadding(blockSize); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte("plain")); err != nil {
+			return err
+		}
+		b, _ := tx.Bucket([]byte("plain"))
+		if err := b.SetPadding(48); err == nil {
+			t.Errorf("Expected a block size that is not a power of two to be rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to configure buckets: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		for _, name := range []string{"blocks", "powers", "plain"} {
+			b, err := tx.Bucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("short"), short); err != nil {
+				return err
+			}
+			if err := b.Put([]byte("long"), long); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		storedLen := func(name, key string) int {
+			return len(tx.Bolt().Bucket([]byte(name)).Get([]byte(key)))
+		}
+		if a, b := storedLen("blocks", "short"), storedLen("blocks", "long"); a != b {
+			t.Errorf("Expected equal stored lengths within a 64-byte block, got %d and %d", a, b)
+		}
+		// 4+2 bytes pad to 8 and 4+33 bytes pad to 64
+		if a, b := storedLen("powers", "short"), storedLen("powers", "long"); b-a != 64-8 {
+			t.Errorf("Expected power-of-two padding, got stored lengths %d and %d", a, b)
+		}
+		if a, b := storedLen("plain", "short"), storedLen("plain", "long"); b-a != len(long)-len(short) {
+			t.Errorf("Expected unpadded values in the plain bucket, got stored lengths %d and %d", a, b)
+		}
+
+		for _, name := range []string{"blocks", "powers", "plain"} {
+			b, err := tx.Bucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for key, want := range map[string][]byte{"short": short, "long": long} {
+				v, err := b.Get([]byte(key))
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(v, want) {
+					t.Errorf("%s/%s: expected %q, got %q", name, key, want, v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to verify values: %v", err)
+	}
+}
+
+func TestBucketRecordsBinding(t *testing.T) {
+	filename := "test_bucket_binding.db"
+	password := "correct horse battery staple 42"
+	defer os.Remove(filename)
+
+	open := func(opts *Options) *SecureBolt {
+		db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		return db
+	}
+
+	db := open(&Options{StrictSecurity: true})
+	err := db.Update(func(tx *SecureTx) error {
+		_, err := tx.CreateBucket([]byte("Strict"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	db.Close()
+
+	// Without StrictSecurity, only the bucket created under it binds values
+	db = open(nil)
+	defer db.Close()
+	err = db.Update(func(tx *SecureTx) error {
+		if err := tx.Put([]byte("Strict"), []byte("key"), []byte("bound")); err != nil {
+			return err
+		}
+		if err := tx.Put([]byte("Relaxed"), []byte("key"), []byte("unbound")); err != nil {
+			return err
+		}
+		for name, want := range map[string]bool{"Strict": true, "Relaxed": false} {
+			stored := tx.Bolt().Bucket([]byte(name)).Get([]byte("key"))
+			if got := stored[1]&flagBound != 0; got != want {
+				t.Errorf("Bucket %q: bound=%v, expected %v", name, got, want)
+			}
+		}
+
+		// The bucket created without StrictSecurity records its settings too
+		if tx.Bolt().Bucket(bucketConfigBucket).Get([]byte("Relaxed")) == nil {
+			t.Errorf("Expected a settings record for the bucket created without StrictSecurity")
+		}
+		b, err := tx.Bucket([]byte("Relaxed"))
+		if err != nil {
+			return err
+		}
+		cfg, err := b.bucketSettings()
+		if err != nil {
+			return err
+		}
+		if cfg.bound || cfg.compression != CompressionDefault {
+			t.Errorf("Unexpected settings recorded for the relaxed bucket: %+v", *cfg)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		v, err := tx.Get([]byte("Strict"), []byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "bound" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+}
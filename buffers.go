@@ -0,0 +1,41 @@
+package securebolt
+
+import "github.com/awnumar/memguard"
+
+// trackBuffer registers buf, a secret handed out beyond a single call such
+// as the key of a SecureContext, so that Close destroys it if the caller
+// has not done so. When the database is already closed buf is destroyed at
+// once and ErrDBClosed is returned.
+func (s *SecureBolt) trackBuffer(buf *memguard.LockedBuffer) error {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	if s.buffersDestroyed {
+		buf.Destroy()
+		return ErrDBClosed
+	}
+	if s.buffers == nil {
+		s.buffers = make(map[*memguard.LockedBuffer]struct{})
+	}
+	s.buffers[buf] = struct{}{}
+	return nil
+}
+
+// untrackBuffer destroys buf and removes it from the registry.
+func (s *SecureBolt) untrackBuffer(buf *memguard.LockedBuffer) {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	delete(s.buffers, buf)
+	buf.Destroy()
+}
+
+// destroyBuffers destroys every registered buffer. Buffers registered
+// afterwards are destroyed immediately.
+func (s *SecureBolt) destroyBuffers() {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	for buf := range s.buffers {
+		buf.Destroy()
+	}
+	s.buffers = nil
+	s.buffersDestroyed = true
+}
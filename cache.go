@@ -0,0 +1,251 @@
+package securebolt
+
+import (
+	"container/list"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/awnumar/memguard"
+	"go.etcd.io/bbolt"
+)
+
+// valueCache is an LRU cache of decrypted values keyed by bucket and key. It
+// is safe for concurrent use by read transactions. A nil *valueCache is a
+// disabled cache.
+type valueCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration // Zero keeps entries until they are evicted
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cacheEntry is an element of valueCache.order.
+type cacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // Zero when the cache has no TTL
+}
+
+// CacheStats reports the activity of the decrypted value cache.
+type CacheStats struct {
+	Hits    uint64 // Gets answered from the cache
+	Misses  uint64 // Gets that had to decrypt the stored value
+	Entries int    // Values currently cached
+}
+
+// newValueCache returns a cache holding up to size values for at most ttl
+// each, or nil when size is not positive.
+func newValueCache(size int, ttl time.Duration) *valueCache {
+	if size <= 0 {
+		return nil
+	}
+	return &valueCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// cacheKey builds the cache key of a value; the bucket name is length
+// prefixed so that (bucket, key) pairs cannot collide.
+func cacheKey(bucket, key []byte) string {
+	k := binary.AppendUvarint(nil, uint64(len(bucket)))
+	k = append(k, bucket...)
+	return string(append(k, key...))
+}
+
+// get returns a copy of the cached value and whether it was present and
+// unexpired, counting the lookup as a hit or a miss.
+func (c *valueCache) get(bucket, key []byte) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[cacheKey(bucket, key)]
+	if ok && c.ttl > 0 && time.Now().After(el.Value.(*cacheEntry).expires) {
+		c.removeElement(el)
+		ok = false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.order.MoveToFront(el)
+	return append([]byte{}, el.Value.(*cacheEntry).value...), true
+}
+
+// put stores a copy of value, evicting the least recently used entry when
+// the cache is full.
+func (c *valueCache) put(bucket, key, value []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := cacheKey(bucket, key)
+	if el, ok := c.entries[k]; ok {
+		c.removeElement(el)
+	}
+	entry := &cacheEntry{key: k, value: append([]byte{}, value...)}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.entries[k] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// invalidate drops the cached value of a key.
+func (c *valueCache) invalidate(bucket, key []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[cacheKey(bucket, key)]; ok {
+		c.removeElement(el)
+	}
+}
+
+// invalidateBucket drops every cached value of a bucket.
+func (c *valueCache) invalidateBucket(bucket []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := cacheKey(bucket, nil)
+	for k, el := range c.entries {
+		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+			c.removeElement(el)
+		}
+	}
+}
+
+// purge wipes and drops every cached value.
+func (c *valueCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, el := range c.entries {
+		c.removeElement(el)
+	}
+}
+
+// stats returns the current cache statistics.
+func (c *valueCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: len(c.entries)}
+}
+
+// CacheStats returns hit and miss counts for the decrypted value cache. All
+// fields are zero when Options.CacheSize is not set.
+func (s *SecureBolt) CacheStats() CacheStats {
+	return s.cache.stats()
+}
+
+// FlushCache wipes and drops every decrypted value held by the cache, for
+// example before the process forks or in response to a security event.
+// Later Gets decrypt the stored values again and repopulate the cache. It
+// does nothing when Options.CacheSize is not set.
+func (s *SecureBolt) FlushCache() {
+	s.cache.purge()
+}
+
+// removeElement wipes and drops a single entry. The caller holds c.mu.
+func (c *valueCache) removeElement(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	memguard.WipeBytes(entry.value)
+	delete(c.entries, entry.key)
+	c.order.Remove(el)
+}
+
+// Warm reads every value in the bucket so that its pages are loaded into the
+// OS page cache, reducing the latency of the first reads after Open. When
+// Options.CacheSize is set and Warm runs in a read-only transaction, the
+// values are also decrypted into the cache so later Gets skip decryption;
+// with the cache disabled Warm only touches the pages and decrypts nothing.
+func (sb *SecureBucket) Warm() error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	cache := sb.tx.db.cache
+	populate := cache != nil && !sb.tx.tx.Writable() && !sb.tx.snapshot
+
+	// sink keeps the page reads from being optimized away; it is local so
+	// concurrent Warm calls do not race on it
+	var sink byte
+	defer func() { runtime.KeepAlive(sink) }()
+
+	c := sb.bucket.Cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		if len(v) > 0 {
+			sink ^= v[len(v)-1] // Fault in overflow pages too
+		}
+		if !populate || sb.tombstoned(k, v) {
+			continue
+		}
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return err
+		}
+		cache.put(sb.name, k, value)
+		memguard.WipeBytes(value)
+	}
+	return nil
+}
+
+// Warm touches every value of every bucket in the database, including the
+// internal and nested ones, so that the whole memory-mapped file is loaded
+// into the OS page cache, reducing the latency of the first reads after
+// Open. Nothing is decrypted, so it is cheap, but unlike SecureBucket.Warm
+// it does not fill the value cache.
+func (s *SecureBolt) Warm() error {
+	return s.View(func(tx *SecureTx) error {
+		pageSize := tx.tx.DB().Info().PageSize
+		var sink byte
+		err := tx.tx.ForEach(func(_ []byte, b *bbolt.Bucket) error {
+			sink ^= warmBucket(b, pageSize)
+			return nil
+		})
+		runtime.KeepAlive(sink)
+		return err
+	})
+}
+
+// warmBucket touches one byte in every page of each value of b and of the
+// buckets nested in it, and returns the XOR of the bytes it read so the
+// reads cannot be optimized away.
+func warmBucket(b *bbolt.Bucket, pageSize int) byte {
+	var sink byte
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			if child := b.Bucket(k); child != nil {
+				sink ^= warmBucket(child, pageSize)
+			}
+			continue
+		}
+		for i := len(v) - 1; i >= 0; i -= pageSize {
+			sink ^= v[i]
+		}
+	}
+	return sink
+}
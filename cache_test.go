@@ -0,0 +1,325 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWarmCache(t *testing.T) {
+	filename := "test_cache.db"
+	password := "secure-test-password"
+	bucketName := []byte("CacheBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	put := func(value string) {
+		err := db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("key"), []byte(value))
+		})
+		if err != nil {
+			t.Fatalf("Failed to put value: %v", err)
+		}
+	}
+	get := func() string {
+		var value []byte
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			value, err = b.Get([]byte("key"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		return string(value)
+	}
+
+	put("first")
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Warm()
+	})
+	if err != nil {
+		t.Fatalf("Failed to warm bucket: %v", err)
+	}
+	if _, ok := db.cache.get(bucketName, []byte("key")); !ok {
+		t.Fatalf("Warm did not populate the cache")
+	}
+	if got := get(); got != "first" {
+		t.Fatalf("Got %q from cache, expected %q", got, "first")
+	}
+
+	// Put invalidates the cached value
+	put("second")
+	if got := get(); got != "second" {
+		t.Fatalf("Got %q after overwrite, expected %q", got, "second")
+	}
+}
+
+func TestWarmDatabase(t *testing.T) {
+	filename := "test_warm.db"
+	password := "secure-test-password"
+	bucketName := []byte("Documents")
+	large := bytes.Repeat([]byte("page"), 4096) // Spans several overflow pages
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 50; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("doc%02d", i)), []byte(fmt.Sprintf("body%d", i))); err != nil {
+				return err
+			}
+		}
+		if err := b.Put([]byte("large"), large); err != nil {
+			return err
+		}
+		nested, err := b.CreateBucketIfNotExists([]byte("archive"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("old"), []byte("archived"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate database: %v", err)
+	}
+
+	if err := db.Warm(); err != nil {
+		t.Fatalf("Failed to warm database: %v", err)
+	}
+	if _, ok := db.cache.get(bucketName, []byte("doc00")); ok {
+		t.Fatalf("Expected Warm not to decrypt values into the cache")
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("doc07"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "body7" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		if v, err = b.Get([]byte("large")); err != nil {
+			return err
+		}
+		if !bytes.Equal(v, large) {
+			t.Errorf("Unexpected large value of %d bytes", len(v))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read after warming: %v", err)
+	}
+}
+
+func TestCacheTTLAndStats(t *testing.T) {
+	filename := "test_cache_ttl.db"
+	password := "secure-test-password"
+	bucketName := []byte("CacheBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16, CacheTTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	get := func() {
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			_, err = b.Get([]byte("key"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+	}
+
+	get() // Miss, populates the cache
+	get() // Hit
+	time.Sleep(100 * time.Millisecond)
+	get() // Expired, miss
+
+	stats := db.CacheStats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Fatalf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestFlushCache(t *testing.T) {
+	filename := "test_cache_flush.db"
+	password := "secure-test-password"
+	bucketName := []byte("CacheBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Put(k, []byte("secret")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	getAll := func() {
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				v, err := b.Get(k)
+				if err != nil {
+					return err
+				}
+				if string(v) != "secret" {
+					t.Fatalf("Get(%q) = %q, expected %q", k, v, "secret")
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to get values: %v", err)
+		}
+	}
+
+	getAll() // Misses, populates the cache
+	getAll() // Hits
+	if stats := db.CacheStats(); stats.Hits != 3 || stats.Misses != 3 || stats.Entries != 3 {
+		t.Fatalf("Unexpected cache stats before flush: %+v", stats)
+	}
+
+	db.FlushCache()
+	if stats := db.CacheStats(); stats.Entries != 0 {
+		t.Fatalf("Expected an empty cache after flush, got %+v", stats)
+	}
+
+	// Every Get decrypts again after the flush
+	getAll()
+	if stats := db.CacheStats(); stats.Hits != 3 || stats.Misses != 6 || stats.Entries != 3 {
+		t.Fatalf("Unexpected cache stats after flush: %+v", stats)
+	}
+}
+
+func TestWarmConcurrent(t *testing.T) {
+	password := "secure-test-password"
+	bucketName := []byte("Documents")
+
+	// Two databases warmed at once, each from several goroutines
+	var dbs []*SecureBolt
+	for _, filename := range []string{"test_warm_concurrent_a.db", "test_warm_concurrent_b.db"} {
+		defer os.Remove(filename)
+		db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 64})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 50; i++ {
+				if err := b.Put([]byte(fmt.Sprintf("doc%02d", i)), bytes.Repeat([]byte("x"), 5000)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to populate database: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for _, db := range dbs {
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				errs <- db.Warm()
+			}()
+			go func() {
+				defer wg.Done()
+				errs <- db.View(func(tx *SecureTx) error {
+					b, err := tx.Bucket(bucketName)
+					if err != nil {
+						return err
+					}
+					return b.Warm()
+				})
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to warm concurrently: %v", err)
+		}
+	}
+}
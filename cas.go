@@ -0,0 +1,77 @@
+package securebolt
+
+// CASOp is a single compare-and-swap condition for MultiCAS. Expected nil
+// requires the key to be absent; New nil deletes the key.
+type CASOp struct {
+	Bucket   []byte
+	Key      []byte
+	Expected []byte
+	New      []byte
+}
+
+// MultiCAS checks every op's expected value against the current decrypted
+// value, and only if all of them match applies every new value. It returns
+// false, changing nothing, when any condition fails. Expected values are
+// compared with SecureEqual. Buckets that do not exist hold no keys, and are
+// created when an op stores a value in them. MultiCAS must be called from
+// within Update; if applying an op fails the returned error should be
+// returned from the Update callback so that the ops already applied roll back.
+func (stx *SecureTx) MultiCAS(ops []CASOp) (bool, error) {
+	for _, op := range ops {
+		var current []byte
+		if bucket := stx.tx.Bucket(op.Bucket); bucket != nil {
+			var err error
+			if current, err = stx.newBucket(op.Bucket, bucket).Get(op.Key); err != nil {
+				return false, err
+			}
+		}
+		if (current == nil) != (op.Expected == nil) || !SecureEqual(current, op.Expected) {
+			return false, nil
+		}
+	}
+
+	for _, op := range ops {
+		if op.New == nil {
+			bucket := stx.tx.Bucket(op.Bucket)
+			if bucket == nil {
+				continue
+			}
+			if err := stx.newBucket(op.Bucket, bucket).Delete(op.Key); err != nil {
+				return false, err
+			}
+			continue
+		}
+		b, err := stx.CreateBucketIfNotExists(op.Bucket)
+		if err != nil {
+			return false, err
+		}
+		if err := b.Put(op.Key, op.New); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Do runs ops with a reader and a writer bound to the transaction, for
+// conditional logic spanning several keys that MultiCAS cannot express, such
+// as moving an amount between two balances only when the source covers it.
+// The reader returns the current decrypted value of a key, or nil when the
+// key or its bucket does not exist, and sees the writes made before it. The
+// writer stores a value, creating the bucket if needed; a nil value deletes
+// the key. Do returns the error returned by ops. Call it from within Update
+// and return its error from the Update callback so that a failed condition
+// or write discards every write made by ops.
+func (stx *SecureTx) Do(ops func(reader func(bucket, key []byte) ([]byte, error), writer func(bucket, key, value []byte) error) error) error {
+	reader := stx.Get
+	writer := func(bucket, key, value []byte) error {
+		if value == nil {
+			b := stx.tx.Bucket(bucket)
+			if b == nil {
+				return nil
+			}
+			return stx.newBucket(bucket, b).Delete(key)
+		}
+		return stx.Put(bucket, key, value)
+	}
+	return ops(reader, writer)
+}
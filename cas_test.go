@@ -0,0 +1,180 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestMultiCAS(t *testing.T) {
+	filename := "test_multicas.db"
+	password := "secure-test-password"
+	alice := []byte("alice")
+	bob := []byte("bob")
+	key := []byte("balance")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		for name, balance := range map[string]string{"alice": "100", "bob": "50"} {
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, []byte(balance)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create accounts: %v", err)
+	}
+
+	transfer := func(bobExpected string) bool {
+		var applied bool
+		err := db.Update(func(tx *SecureTx) error {
+			var err error
+			applied, err = tx.MultiCAS([]CASOp{
+				{Bucket: alice, Key: key, Expected: []byte("100"), New: []byte("70")},
+				{Bucket: bob, Key: key, Expected: []byte(bobExpected), New: []byte("80")},
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("MultiCAS failed: %v", err)
+		}
+		return applied
+	}
+	balances := func() (string, string) {
+		var a, b []byte
+		err := db.View(func(tx *SecureTx) error {
+			ba, err := tx.Bucket(alice)
+			if err != nil {
+				return err
+			}
+			if a, err = ba.Get(key); err != nil {
+				return err
+			}
+			bb, err := tx.Bucket(bob)
+			if err != nil {
+				return err
+			}
+			b, err = bb.Get(key)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to read balances: %v", err)
+		}
+		return string(a), string(b)
+	}
+
+	// Bob's balance is stale, so neither account changes
+	if transfer("40") {
+		t.Fatalf("Transfer applied despite a failed condition")
+	}
+	if a, b := balances(); a != "100" || b != "50" {
+		t.Fatalf("Balances changed after failed transfer: alice=%s bob=%s", a, b)
+	}
+
+	if !transfer("50") {
+		t.Fatalf("Transfer was not applied")
+	}
+	if a, b := balances(); a != "70" || b != "80" {
+		t.Fatalf("Unexpected balances after transfer: alice=%s bob=%s", a, b)
+	}
+}
+
+func TestDo(t *testing.T) {
+	filename := "test_do.db"
+	password := "secure-test-password"
+	accounts := []byte("accounts")
+	alice := []byte("alice")
+	bob := []byte("bob")
+	errInsufficientFunds := errors.New("insufficient funds")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	transfer := func(from, to []byte, amount int) error {
+		return db.Update(func(tx *SecureTx) error {
+			return tx.Do(func(read func(bucket, key []byte) ([]byte, error), write func(bucket, key, value []byte) error) error {
+				balance := func(account []byte) (int, error) {
+					v, err := read(accounts, account)
+					if err != nil || v == nil {
+						return 0, err
+					}
+					return strconv.Atoi(string(v))
+				}
+				src, err := balance(from)
+				if err != nil {
+					return err
+				}
+				dst, err := balance(to)
+				if err != nil {
+					return err
+				}
+				// Credit first so a failed condition must roll the credit back
+				if err := write(accounts, to, []byte(strconv.Itoa(dst+amount))); err != nil {
+					return err
+				}
+				if src < amount {
+					return errInsufficientFunds
+				}
+				return write(accounts, from, []byte(strconv.Itoa(src-amount)))
+			})
+		})
+	}
+	balances := func() (string, string) {
+		var a, b []byte
+		err := db.View(func(tx *SecureTx) error {
+			return tx.Do(func(read func(bucket, key []byte) ([]byte, error), _ func(bucket, key, value []byte) error) error {
+				var err error
+				if a, err = read(accounts, alice); err != nil {
+					return err
+				}
+				b, err = read(accounts, bob)
+				return err
+			})
+		})
+		if err != nil {
+			t.Fatalf("Failed to read balances: %v", err)
+		}
+		return string(a), string(b)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Do(func(_ func(bucket, key []byte) ([]byte, error), write func(bucket, key, value []byte) error) error {
+			return write(accounts, alice, []byte("100"))
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+
+	if err := transfer(alice, bob, 150); !errors.Is(err, errInsufficientFunds) {
+		t.Fatalf("Expected errInsufficientFunds, got %v", err)
+	}
+	if a, b := balances(); a != "100" || b != "" {
+		t.Fatalf("Balances changed after failed transfer: alice=%s bob=%s", a, b)
+	}
+
+	if err := transfer(alice, bob, 30); err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+	if a, b := balances(); a != "70" || b != "30" {
+		t.Fatalf("Unexpected balances after transfer: alice=%s bob=%s", a, b)
+	}
+}
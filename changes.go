@@ -0,0 +1,147 @@
+package securebolt
+
+import "bytes"
+
+// ChangeOp identifies the kind of change carried by a ChangeEvent.
+type ChangeOp int
+
+const (
+	OpPut    ChangeOp = iota + 1 // A key was written
+	OpDelete                     // A key was deleted
+)
+
+// String returns the name of the operation.
+func (op ChangeOp) String() string {
+	switch op {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEvent describes a single committed Put or Delete.
+type ChangeEvent struct {
+	Bucket []byte   // Name of the bucket that changed
+	Key    []byte   // Key that was written or deleted
+	Op     ChangeOp // Kind of change
+	Value  []byte   // Decrypted new value, set for OpPut when Options.ChangeValues is enabled
+}
+
+// recordChange queues a change to be published once the transaction commits.
+// It is a no-op unless change tracking is enabled.
+func (stx *SecureTx) recordChange(op ChangeOp, bucket, key, value []byte) {
+	if stx.db.opts.ChangeSink == nil && !stx.db.hasWatchers() {
+		return
+	}
+	event := ChangeEvent{
+		Bucket: append([]byte{}, bucket...),
+		Key:    append([]byte{}, key...),
+		Op:     op,
+	}
+	if op == OpPut && stx.db.opts.ChangeValues {
+		event.Value = append([]byte{}, value...)
+	}
+	stx.changes = append(stx.changes, event)
+}
+
+// publishChanges delivers committed changes to the configured sink and to
+// matching watchers in the order they were made.
+func (s *SecureBolt) publishChanges(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	if s.opts.ChangeSink != nil {
+		for _, event := range events {
+			s.opts.ChangeSink(event)
+		}
+	}
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for w := range s.watchers {
+		for _, event := range events {
+			if !w.matches(event) {
+				continue
+			}
+			select {
+			case w.ch <- event:
+			default:
+				// The subscriber is not keeping up; drop rather than stall writers
+			}
+		}
+	}
+}
+
+// watchBufferSize is the number of events buffered for each watcher.
+const watchBufferSize = 64
+
+// watcher is a subscription created by SecureBucket.Watch.
+type watcher struct {
+	bucket []byte
+	prefix []byte
+	ch     chan ChangeEvent
+}
+
+// matches reports whether event concerns the watched bucket and prefix.
+func (w *watcher) matches(event ChangeEvent) bool {
+	return bytes.Equal(event.Bucket, w.bucket) && bytes.HasPrefix(event.Key, w.prefix)
+}
+
+// Watch subscribes to committed changes of keys starting with prefix in this
+// bucket; an empty prefix matches every key. Events are delivered on the
+// returned channel after each Update commits. The channel buffers a limited
+// number of events and events are dropped when it is full, so subscribers
+// must drain it promptly. Values are only included when Options.ChangeValues
+// is set. Call the returned function to cancel the subscription; it closes
+// the channel. Closing the database also closes all watch channels.
+//
+// The subscription outlives the transaction the bucket was obtained from.
+func (sb *SecureBucket) Watch(prefix []byte) (<-chan ChangeEvent, func()) {
+	s := sb.tx.db
+	w := &watcher{
+		bucket: append([]byte{}, sb.name...),
+		prefix: append([]byte{}, prefix...),
+		ch:     make(chan ChangeEvent, watchBufferSize),
+	}
+
+	s.watchMu.Lock()
+	if s.closed.Load() {
+		close(w.ch)
+	} else {
+		if s.watchers == nil {
+			s.watchers = make(map[*watcher]struct{})
+		}
+		s.watchers[w] = struct{}{}
+	}
+	s.watchMu.Unlock()
+
+	cancel := func() {
+		s.watchMu.Lock()
+		defer s.watchMu.Unlock()
+		if _, ok := s.watchers[w]; ok {
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}
+	return w.ch, cancel
+}
+
+// hasWatchers reports whether any watch subscription is active.
+func (s *SecureBolt) hasWatchers() bool {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	return len(s.watchers) > 0
+}
+
+// closeWatchers cancels every watch subscription.
+func (s *SecureBolt) closeWatchers() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	for w := range s.watchers {
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
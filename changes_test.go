@@ -0,0 +1,158 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestChangeSink(t *testing.T) {
+	filename := "test_change_sink.db"
+	password := "secure-test-password"
+	bucketName := []byte("ChangeBucket")
+
+	defer os.Remove(filename)
+
+	var events []ChangeEvent
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{
+		ChangeSink:   func(event ChangeEvent) { events = append(events, event) },
+		ChangeValues: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("b"), []byte("2")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("a"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Changes from a rolled back transaction must not be published
+	errRollback := errors.New("rollback")
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("c"), []byte("3")); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Expected rollback error, got %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("b"), []byte("4"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	expected := []ChangeEvent{
+		{Bucket: bucketName, Key: []byte("a"), Op: OpPut, Value: []byte("1")},
+		{Bucket: bucketName, Key: []byte("b"), Op: OpPut, Value: []byte("2")},
+		{Bucket: bucketName, Key: []byte("a"), Op: OpDelete},
+		{Bucket: bucketName, Key: []byte("b"), Op: OpPut, Value: []byte("4")},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Received %d events, expected %d", len(events), len(expected))
+	}
+	for i, e := range expected {
+		got := events[i]
+		if !bytes.Equal(got.Bucket, e.Bucket) || !bytes.Equal(got.Key, e.Key) || got.Op != e.Op || !bytes.Equal(got.Value, e.Value) {
+			t.Fatalf("Event %d mismatch: got %s %q/%q=%q, expected %s %q/%q=%q",
+				i, got.Op, got.Bucket, got.Key, got.Value, e.Op, e.Bucket, e.Key, e.Value)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	filename := "test_watch.db"
+	password := "secure-test-password"
+	bucketName := []byte("WatchBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	var events <-chan ChangeEvent
+	var cancel func()
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		events, cancel = b.Watch([]byte("user:"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to watch bucket: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"user:1", "order:1", "user:2"} {
+			if err := b.Put([]byte(k), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte("user:1"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Changes to another bucket with a matching key are not delivered
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("OtherBucket"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("user:3"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	cancel()
+	var got []string
+	for event := range events {
+		got = append(got, event.Op.String()+" "+string(event.Key))
+	}
+	expected := []string{"put user:1", "put user:2", "delete user:1"}
+	if len(got) != len(expected) {
+		t.Fatalf("Received %v, expected %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Received %v, expected %v", got, expected)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package securebolt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.etcd.io/bbolt"
+)
+
+// compactTxMaxSize bounds the size of each write transaction during compaction.
+const compactTxMaxSize = 64 * 1024 * 1024
+
+// compactProgressInterval is the number of copied bytes between progress reports.
+const compactProgressInterval = 1024 * 1024
+
+// CompactTo writes a compacted copy of the database to path, which must not
+// already contain a database. Values are copied as stored, so the copy opens
+// with the same password and reclaims the free pages of the original.
+//
+// progress, when not nil, is called roughly every megabyte of copied keys
+// and values, and once more when the copy is complete, with the bytes copied
+// so far and the size of the source file as an estimate of the total. The
+// estimate includes free pages and page overhead that compaction drops, so
+// the final report is usually below it.
+func (s *SecureBolt) CompactTo(path string, mode fs.FileMode, progress func(bytesWritten, totalEstimate int64)) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
+	return s.compactToLocked(path, mode, progress)
+}
+
+// compactToLocked is CompactTo for callers already holding s.mu.
+func (s *SecureBolt) compactToLocked(path string, mode fs.FileMode, progress func(bytesWritten, totalEstimate int64)) error {
+	var total int64
+	if info, err := os.Stat(s.db.Path()); err == nil {
+		total = info.Size()
+	}
+
+	dst, err := bbolt.Open(path, mode, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open compaction target: %w", err)
+	}
+	written, err := compact(dst, s.db, compactTxMaxSize, func(written int64) {
+		if progress != nil {
+			progress(written, total)
+		}
+	})
+	if err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to compact database: %w", err)
+	}
+	if progress != nil {
+		progress(written, total)
+	}
+	return dst.Close()
+}
+
+// compact copies every bucket of src into dst like bbolt.Compact, committing
+// whenever a transaction grows past txMaxSize and calling report every
+// compactProgressInterval copied bytes. It returns the number of key and
+// value bytes copied.
+func compact(dst, src *bbolt.DB, txMaxSize int64, report func(written int64)) (int64, error) {
+	var written, txSize, nextReport int64 = 0, 0, compactProgressInterval
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { tx.Rollback() }()
+
+	// copyBucket recreates the bucket src in target and copies its contents.
+	var copyBucket func(target *bbolt.Bucket, path [][]byte, src *bbolt.Bucket) error
+	copyBucket = func(target *bbolt.Bucket, path [][]byte, src *bbolt.Bucket) error {
+		c := src.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			size := int64(len(k) + len(v))
+			if txSize+size > txMaxSize && txMaxSize != 0 {
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+				if tx, err = dst.Begin(true); err != nil {
+					return err
+				}
+				// Buckets must be looked up again in the new transaction
+				target = bucketAt(tx, path)
+				txSize = 0
+			}
+			txSize += size
+			written += size
+			if written >= nextReport {
+				report(written)
+				nextReport = written + compactProgressInterval
+			}
+
+			target.FillPercent = 1.0
+			if v != nil {
+				if err := target.Put(k, v); err != nil {
+					return err
+				}
+				continue
+			}
+			child := src.Bucket(k)
+			nested, err := target.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			if err := nested.SetSequence(child.Sequence()); err != nil {
+				return err
+			}
+			childPath := append(append([][]byte{}, path...), k)
+			if err := copyBucket(nested, childPath, child); err != nil {
+				return err
+			}
+			// A commit inside the child invalidates target
+			target = bucketAt(tx, path)
+		}
+		return nil
+	}
+
+	err = src.View(func(stx *bbolt.Tx) error {
+		return stx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			target, err := tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+			if err := target.SetSequence(b.Sequence()); err != nil {
+				return err
+			}
+			return copyBucket(target, [][]byte{name}, b)
+		})
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, tx.Commit()
+}
+
+// bucketAt returns the nested bucket at path.
+func bucketAt(tx *bbolt.Tx, path [][]byte) *bbolt.Bucket {
+	b := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// CloseWithCompaction compacts the database into a temporary file next to it,
+// closes the database and atomically replaces the original file with the
+// compacted copy. If compaction fails the temporary file is removed and the
+// database is closed normally, leaving the original file intact; the
+// compaction error is returned in that case.
+//
+// The database is marked closed and held for writing from the start, so no
+// transaction can commit after the copy is taken and be lost when the copy
+// replaces the file; transactions begun meanwhile fail with ErrDBClosed.
+func (s *SecureBolt) CloseWithCompaction() error {
+	if !s.closed.CompareAndSwap(false, true) {
+		return ErrDBClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.db.Path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return s.closeAfterFailedCompaction(err)
+	}
+
+	// The temporary file lives in the same directory so the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return s.closeAfterFailedCompaction(err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+
+	if err := s.compactToLocked(tmpPath, info.Mode().Perm(), nil); err != nil {
+		os.Remove(tmpPath)
+		return s.closeAfterFailedCompaction(err)
+	}
+	if err := s.closeLocked(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace database with compacted copy: %w", err)
+	}
+	return nil
+}
+
+// closeAfterFailedCompaction closes the database, whose s.mu the caller
+// holds, and reports why compaction was skipped.
+func (s *SecureBolt) closeAfterFailedCompaction(cause error) error {
+	if err := s.closeLocked(); err != nil {
+		return err
+	}
+	return fmt.Errorf("database closed without compaction: %w", cause)
+}
+
+// freePageRatio returns the fraction of the database's pages that are free
+// or pending release.
+func freePageRatio(db *bbolt.DB) (float64, error) {
+	var pages int64
+	err := db.View(func(tx *bbolt.Tx) error {
+		pages = tx.Size() / int64(db.Info().PageSize)
+		return nil
+	})
+	if err != nil || pages == 0 {
+		return 0, err
+	}
+	stats := db.Stats()
+	return float64(stats.FreePageN+stats.PendingPageN) / float64(pages), nil
+}
+
+// compactIfFragmented compacts the database in place when its free page
+// ratio exceeds opts.AutoCompactThreshold, returning the reopened database.
+// The original db is closed when an error is returned.
+func compactIfFragmented(db *bbolt.DB, opts *Options) (*bbolt.DB, error) {
+	ratio, err := freePageRatio(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to inspect free pages: %w", err)
+	}
+	if ratio <= opts.AutoCompactThreshold {
+		return db, nil
+	}
+	compacted, err := compactInPlace(db, opts)
+	if err != nil {
+		if compacted != nil {
+			compacted.Close()
+		}
+		return nil, err
+	}
+	return compacted, nil
+}
+
+// reopenBolt reopens the database file after an in-place compaction. It is
+// a variable so tests can make the reopen fail.
+var reopenBolt = bbolt.Open
+
+// compactInPlace compacts db into a temporary file next to it, closes db,
+// renames the copy over the original and reopens it with opts. It returns
+// the database to use from then on: the compacted one, or on error either db
+// itself or the reopened original when the failure left one open, and nil
+// otherwise.
+func compactInPlace(db *bbolt.DB, opts *Options) (*bbolt.DB, error) {
+	path := db.Path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return db, fmt.Errorf("failed to stat database file: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return db, fmt.Errorf("failed to create compaction target: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+
+	dst, err := bbolt.Open(tmpPath, info.Mode().Perm(), nil)
+	if err == nil {
+		_, err = compact(dst, db, compactTxMaxSize, func(int64) {})
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return db, fmt.Errorf("failed to compact database: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	renameErr := os.Rename(tmpPath, path)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	}
+	reopened, err := reopenBolt(path, info.Mode().Perm(), opts.boltOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen database after compaction: %w", err)
+	}
+	if renameErr != nil {
+		return reopened, fmt.Errorf("failed to replace database with compacted copy: %w", renameErr)
+	}
+	return reopened, nil
+}
@@ -0,0 +1,335 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestCloseWithCompaction(t *testing.T) {
+	filename := "test_close_compaction.db"
+	password := "secure-test-password"
+	bucketName := []byte("CompactBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	// Write and then delete most entries to leave free pages behind
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte("x"), 512)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 1; i < 2000; i++ {
+			if err := b.Delete([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete entries: %v", err)
+	}
+
+	before, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if err := db.CloseWithCompaction(); err != nil {
+		t.Fatalf("CloseWithCompaction failed: %v", err)
+	}
+	after, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat compacted database: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("Compacted file is %d bytes, original was %d", after.Size(), before.Size())
+	}
+
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen compacted database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key-0"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, bytes.Repeat([]byte("x"), 512)) {
+			return fmt.Errorf("value mismatch after compaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}
+
+func TestCompactToProgress(t *testing.T) {
+	filename := "test_compact_progress.db"
+	target := "test_compact_progress_copy.db"
+	password := "secure-test-password"
+	bucketName := []byte("CompactBucket")
+
+	defer os.Remove(filename)
+	defer os.Remove(target)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	// About 3 MiB of values, so progress is reported more than once
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%04d", i)), bytes.Repeat([]byte("x"), 1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	var reports [][2]int64
+	err = db.CompactTo(target, 0600, func(written, total int64) {
+		reports = append(reports, [2]int64{written, total})
+	})
+	if err != nil {
+		t.Fatalf("CompactTo failed: %v", err)
+	}
+	db.Close()
+
+	if len(reports) < 3 {
+		t.Fatalf("Expected several progress reports, got %d", len(reports))
+	}
+	for i, r := range reports {
+		if r[1] <= 0 {
+			t.Fatalf("Report %d has no total estimate", i)
+		}
+		if i > 0 && r[0] < reports[i-1][0] {
+			t.Fatalf("Progress went backwards: %v", reports)
+		}
+	}
+
+	copied, err := Open(target, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open compacted copy: %v", err)
+	}
+	defer copied.Close()
+	err = copied.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key-2999"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, bytes.Repeat([]byte("x"), 1024)) {
+			return fmt.Errorf("unexpected value in compacted copy")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read compacted copy: %v", err)
+	}
+}
+
+func TestAutoCompactThreshold(t *testing.T) {
+	filename := "test_auto_compact.db"
+	password := "secure-test-password"
+	bucketName := []byte("CompactBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte("x"), 512)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 1; i < 2000; i++ {
+			if err := b.Delete([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete entries: %v", err)
+	}
+	db.Close()
+
+	before, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	db, err = OpenWithOptions(filename, 0600, []byte(password), &Options{AutoCompactThreshold: 0.1})
+	if err != nil {
+		t.Fatalf("Failed to open with AutoCompactThreshold: %v", err)
+	}
+	defer db.Close()
+	after, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat compacted database: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("Compacted file is %d bytes, original was %d", after.Size(), before.Size())
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key-0"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, bytes.Repeat([]byte("x"), 512)) {
+			return fmt.Errorf("value mismatch after compaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}
+
+func TestCloseWithCompactionKeepsConcurrentWrites(t *testing.T) {
+	filename := "test_close_compaction_writes.db"
+	password := "secure-test-password"
+	bucketName := []byte("CompactBucket")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		_, err := tx.CreateBucket(bucketName)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+
+	// Writers race the close; every write that commits must survive it
+	var mu sync.Mutex
+	var committed []string
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	var once sync.Once
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			defer once.Do(func() { close(started) })
+			for i := 0; ; i++ {
+				key := fmt.Sprintf("writer-%d-%d", w, i)
+				err := db.Update(func(tx *SecureTx) error {
+					b, err := tx.Bucket(bucketName)
+					if err != nil {
+						return err
+					}
+					return b.Put([]byte(key), []byte("value"))
+				})
+				if errors.Is(err, ErrDBClosed) {
+					return
+				}
+				if err != nil {
+					t.Errorf("Unexpected write error: %v", err)
+					return
+				}
+				mu.Lock()
+				committed = append(committed, key)
+				mu.Unlock()
+				once.Do(func() { close(started) })
+			}
+		}(w)
+	}
+	<-started
+	if err := db.CloseWithCompaction(); err != nil {
+		t.Fatalf("CloseWithCompaction failed: %v", err)
+	}
+	wg.Wait()
+	if err := db.CloseWithCompaction(); !errors.Is(err, ErrDBClosed) {
+		t.Errorf("Expected ErrDBClosed from a second close, got %v", err)
+	}
+
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen compacted database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, key := range committed {
+			v, err := b.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				t.Errorf("Committed key %q was lost by compaction", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}
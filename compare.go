@@ -0,0 +1,12 @@
+package securebolt
+
+import "crypto/subtle"
+
+// SecureEqual reports whether a and b are equal, taking time that depends
+// only on their lengths and not on their contents. Use it instead of
+// bytes.Equal when comparing decrypted secrets such as tokens. Values of
+// different lengths return false immediately, so the length of a secret is
+// not protected.
+func SecureEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,21 @@
+package securebolt
+
+import "testing"
+
+func TestSecureEqual(t *testing.T) {
+	tests := []struct {
+		a, b []byte
+		want bool
+	}{
+		{[]byte("secret-token"), []byte("secret-token"), true},
+		{[]byte("secret-token"), []byte("secret-tokem"), false},
+		{[]byte("secret-token"), []byte("secret"), false},
+		{[]byte{}, nil, true},
+	}
+
+	for _, tt := range tests {
+		if got := SecureEqual(tt.a, tt.b); got != tt.want {
+			t.Fatalf("SecureEqual(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// KV is a key and its decrypted value.
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+// ScanComposite returns, in key order, every entry whose composite key starts
+// with the given parts, for keys built with CompositeKey. Because each part
+// is length prefixed, a prefix of ("us") matches ("us", ts) but never
+// ("usa", ts). Keys and values are copies owned by the caller.
+func (sb *SecureBucket) ScanComposite(prefix ...[]byte) ([]KV, error) {
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	p := CompositeKey(prefix...)
+
+	var entries []KV
+	c := sb.cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		entries = append(entries, KV{Key: append([]byte{}, k...), Value: value})
+	}
+	return entries, nil
+}
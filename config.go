@@ -0,0 +1,33 @@
+package securebolt
+
+// configBucket holds the database-wide settings written by PutConfig.
+var configBucket = []byte("securebolt_config")
+
+// PutConfig stores a database-wide setting, such as a feature flag or schema
+// version, in an internal bucket kept apart from user buckets. The value is
+// encrypted like any other and the write runs in its own transaction.
+func (s *SecureBolt) PutConfig(key, value []byte) error {
+	return s.Update(func(tx *SecureTx) error {
+		b, err := tx.tx.CreateBucketIfNotExists(configBucket)
+		if err != nil {
+			return err
+		}
+		return tx.newBucket(configBucket, b).Put(key, value)
+	})
+}
+
+// GetConfig returns a setting stored with PutConfig, or nil when it has not
+// been set.
+func (s *SecureBolt) GetConfig(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.View(func(tx *SecureTx) error {
+		b := tx.tx.Bucket(configBucket)
+		if b == nil {
+			return tx.newBucket(configBucket, nil).checkKey(key)
+		}
+		var err error
+		value, err = tx.newBucket(configBucket, b).Get(key)
+		return err
+	})
+	return value, err
+}
@@ -0,0 +1,42 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	filename := "test_config.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if v, err := db.GetConfig([]byte("schema_version")); err != nil || v != nil {
+		t.Fatalf("Expected no config before PutConfig, got %q, %v", v, err)
+	}
+	if err := db.PutConfig([]byte("schema_version"), []byte("3")); err != nil {
+		t.Fatalf("PutConfig failed: %v", err)
+	}
+	v, err := db.GetConfig([]byte("schema_version"))
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if string(v) != "3" {
+		t.Fatalf("GetConfig returned %q, expected %q", v, "3")
+	}
+
+	// Config stays out of the user-visible bucket hierarchy
+	root, err := db.Tree()
+	if err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+	if len(root.Children) != 0 {
+		t.Fatalf("Config bucket is visible as a user bucket")
+	}
+}
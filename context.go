@@ -0,0 +1,107 @@
+package securebolt
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/hkdf"
+)
+
+// contextLabelPrefix separates context keys from other keys derived from the master key.
+const contextLabelPrefix = "securebolt context: "
+
+// SecureContext is an independent encryption namespace whose key is derived
+// from the database master key and a label. Handing a SecureContext to a
+// subsystem lets it encrypt and decrypt its own data without exposing the
+// master key or any other context.
+type SecureContext struct {
+	label   string
+	aead    cipher.AEAD
+	keyLock *memguard.LockedBuffer
+	db      *SecureBolt // Destroys keyLock on Close
+}
+
+// errContextDestroyed is returned by a context used after Destroy or after
+// the database was closed.
+var errContextDestroyed = errors.New("context has been destroyed")
+
+// DeriveContext returns the encryption context for label. The context key is
+// HKDF-SHA256(master key, label), so the same label always yields the same
+// key for a given database while different labels are independent. The
+// context stays usable until Destroy is called or the database is closed.
+func (s *SecureBolt) DeriveContext(label string) (*SecureContext, error) {
+	if label == "" {
+		return nil, errors.New("label cannot be empty")
+	}
+
+	keyLock, err := s.deriveSubkey(contextLabelPrefix + label)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(keyLock.Bytes())
+	if err != nil {
+		keyLock.Destroy()
+		return nil, err
+	}
+	if err := s.trackBuffer(keyLock); err != nil {
+		return nil, err
+	}
+	return &SecureContext{label: label, aead: aead, keyLock: keyLock, db: s}, nil
+}
+
+// deriveSubkey derives a 32-byte key from the master key for the given
+// purpose. The returned buffer is frozen; the caller must destroy it.
+func (s *SecureBolt) deriveSubkey(info string) (*memguard.LockedBuffer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return nil, ErrDBClosed
+	}
+	return s.keys().deriveSubkey(info)
+}
+
+// deriveSubkey derives a subkey from this key material. Unlike the
+// SecureBolt method it takes no lock, so it can be used inside transactions.
+func (km *keyMaterial) deriveSubkey(info string) (*memguard.LockedBuffer, error) {
+	keyLock := memguard.NewBuffer(32)
+	r := hkdf.New(sha256.New, km.keyLock.Bytes(), km.salt, []byte(info))
+	if _, err := io.ReadFull(r, keyLock.Bytes()); err != nil {
+		keyLock.Destroy()
+		return nil, fmt.Errorf("failed to derive subkey: %w", err)
+	}
+	keyLock.Freeze()
+	return keyLock, nil
+}
+
+// Label returns the label the context was derived from.
+func (sc *SecureContext) Label() string {
+	return sc.label
+}
+
+// EncryptBytes encrypts plaintext under the context key.
+func (sc *SecureContext) EncryptBytes(plaintext []byte) ([]byte, error) {
+	if !sc.keyLock.IsAlive() {
+		return nil, errContextDestroyed
+	}
+	return encryptData(plaintext, sc.aead)
+}
+
+// DecryptBytes decrypts ciphertext produced by EncryptBytes of the same context.
+func (sc *SecureContext) DecryptBytes(ciphertext []byte) ([]byte, error) {
+	if ciphertext == nil {
+		return nil, errors.New("ciphertext cannot be nil")
+	}
+	if !sc.keyLock.IsAlive() {
+		return nil, errContextDestroyed
+	}
+	return decryptData(ciphertext, sc.aead)
+}
+
+// Destroy securely destroys the context key. The context cannot be used afterwards.
+func (sc *SecureContext) Destroy() {
+	sc.db.untrackBuffer(sc.keyLock)
+}
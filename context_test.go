@@ -0,0 +1,117 @@
+package securebolt
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestDeriveContext(t *testing.T) {
+	filename := "test_context.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	billing, err := db.DeriveContext("billing")
+	if err != nil {
+		t.Fatalf("Failed to derive billing context: %v", err)
+	}
+	defer billing.Destroy()
+	audit, err := db.DeriveContext("audit")
+	if err != nil {
+		t.Fatalf("Failed to derive audit context: %v", err)
+	}
+	defer audit.Destroy()
+
+	plaintext := []byte("card-number")
+	ciphertext, err := billing.EncryptBytes(plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	got, err := billing.DecryptBytes(ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt with the same context: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypted %q, expected %q", got, plaintext)
+	}
+
+	// A different context must not be able to decrypt
+	if _, err := audit.DecryptBytes(ciphertext); err == nil {
+		t.Fatalf("Audit context decrypted billing ciphertext")
+	}
+
+	// Deriving the same label again yields the same key
+	again, err := db.DeriveContext("billing")
+	if err != nil {
+		t.Fatalf("Failed to derive billing context again: %v", err)
+	}
+	defer again.Destroy()
+	if _, err := again.DecryptBytes(ciphertext); err != nil {
+		t.Fatalf("Re-derived context failed to decrypt: %v", err)
+	}
+}
+
+func TestCloseDestroysSecrets(t *testing.T) {
+	filename := "test_close_secrets.db"
+	password := "secure-test-password"
+	bucketName := []byte("Cached")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	kept, err := db.DeriveContext("kept")
+	if err != nil {
+		t.Fatalf("Failed to derive context: %v", err)
+	}
+	released, err := db.DeriveContext("released")
+	if err != nil {
+		t.Fatalf("Failed to derive context: %v", err)
+	}
+	released.Destroy()
+	if len(db.buffers) != 1 {
+		t.Fatalf("Expected 1 registered buffer after Destroy, got %d", len(db.buffers))
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Put(bucketName, []byte("key"), []byte("cached-secret"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		_, err := tx.Get(bucketName, []byte("key"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+	if db.cache.stats().Entries != 1 {
+		t.Fatalf("Expected the value to be cached")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+	if kept.keyLock.IsAlive() {
+		t.Errorf("Expected Close to destroy the context key")
+	}
+	if _, err := kept.EncryptBytes([]byte("late")); err == nil {
+		t.Errorf("Expected a context to be unusable after Close")
+	}
+	if n := db.cache.stats().Entries; n != 0 {
+		t.Errorf("Expected Close to wipe the cache, found %d entries", n)
+	}
+	kept.Destroy() // Safe after Close
+}
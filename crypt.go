@@ -0,0 +1,41 @@
+package securebolt
+
+import "errors"
+
+// blobBinding binds the ciphertexts of Encrypt to their purpose, so they are
+// never accepted as stored values and stored values never decrypt as blobs.
+var blobBinding = &binding{bucket: []byte("securebolt_blob")}
+
+// Encrypt encrypts plaintext under the database key for storage outside the
+// database, such as in a session cookie. The result uses the same envelope
+// and cipher as stored values and can only be decrypted by Decrypt on a
+// database opened with the same key.
+func (s *SecureBolt) Encrypt(plaintext []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return nil, ErrDBClosed
+	}
+	return sealEnvelope(plaintext, s.keys().aead, flagBound, blobBinding)
+}
+
+// Decrypt decrypts ciphertext produced by Encrypt. It fails when the
+// ciphertext was altered or was produced under another key.
+func (s *SecureBolt) Decrypt(ciphertext []byte) ([]byte, error) {
+	if ciphertext == nil {
+		return nil, errors.New("ciphertext cannot be nil")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return nil, ErrDBClosed
+	}
+	plaintext, flags, err := openEnvelopeFlags(ciphertext, s.keys().aead, blobBinding)
+	if err != nil {
+		return nil, err
+	}
+	if flags != flagBound {
+		return nil, errors.New("ciphertext was not produced by Encrypt")
+	}
+	return plaintext, nil
+}
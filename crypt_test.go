@@ -0,0 +1,82 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	filename := "test_crypt.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	plaintext := []byte("session=42")
+	ciphertext, err := db.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Fatalf("Ciphertext contains the plaintext")
+	}
+	got, err := db.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypted %q, expected %q", got, plaintext)
+	}
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := db.Decrypt(tampered); err == nil {
+		t.Fatalf("Tampered ciphertext was accepted")
+	}
+
+	// Stored values are not accepted as blobs
+	var stored []byte
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket([]byte("Sessions"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("k"), plaintext); err != nil {
+			return err
+		}
+		stored = append([]byte{}, tx.Bolt().Bucket([]byte("Sessions")).Get([]byte("k"))...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to store value: %v", err)
+	}
+	if _, err := db.Decrypt(stored); err == nil {
+		t.Fatalf("Stored value was accepted by Decrypt")
+	}
+
+	db.Close()
+
+	// The same key decrypts after reopening
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen SecureBolt: %v", err)
+	}
+	got, err = db.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt after reopening: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypted %q after reopening, expected %q", got, plaintext)
+	}
+	db.Close()
+
+	if _, err := db.Encrypt(plaintext); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Expected ErrDBClosed, got %v", err)
+	}
+}
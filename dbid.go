@@ -0,0 +1,119 @@
+package securebolt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// databaseIDKey and databaseIDMACKey are the securebolt_meta entries holding
+// Options.DatabaseID and its authenticator.
+var (
+	databaseIDKey    = []byte("database_id")
+	databaseIDMACKey = []byte("database_id_mac")
+)
+
+// databaseIDSubkeyInfo is the HKDF info of the key that authenticates the
+// stored database ID.
+const databaseIDSubkeyInfo = "securebolt database id"
+
+// idAEAD prefixes the additional data of every operation with the database
+// ID, so that ciphertexts only open in the database they were sealed in.
+type idAEAD struct {
+	cipher.AEAD
+	prefix []byte // uvarint(len(id)) followed by id
+}
+
+func (a idAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	return a.AEAD.Seal(dst, nonce, plaintext, a.additionalData(additionalData))
+}
+
+func (a idAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return a.AEAD.Open(dst, nonce, ciphertext, a.additionalData(additionalData))
+}
+
+// additionalData returns the database ID prefix followed by additionalData.
+// The length prefix keeps the ID from running into the data after it.
+func (a idAEAD) additionalData(additionalData []byte) []byte {
+	return append(append([]byte{}, a.prefix...), additionalData...)
+}
+
+// databaseIDMAC authenticates a database ID.
+func databaseIDMAC(km *keyMaterial, id []byte) ([]byte, error) {
+	keyLock, err := km.deriveSubkey(databaseIDSubkeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+	h := hmac.New(sha256.New, keyLock.Bytes())
+	h.Write(id)
+	return h.Sum(nil), nil
+}
+
+// withDatabaseID returns the cipher of km bound to the database ID. A new
+// database records opts.DatabaseID; an existing one uses the ID it
+// recorded, which opts.DatabaseID must match when set. Databases without an
+// ID use the cipher of km unchanged.
+func withDatabaseID(db *bbolt.DB, km *keyMaterial, opts *Options, isNewDB bool) (cipher.AEAD, error) {
+	id := opts.DatabaseID
+	if isNewDB {
+		if id == nil {
+			return km.aead, nil
+		}
+		mac, err := databaseIDMAC(km, id)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(databaseIDKey, id); err != nil {
+				return err
+			}
+			return b.Put(databaseIDMACKey, mac)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store database ID: %w", err)
+		}
+	} else {
+		var stored, storedMAC []byte
+		err := db.View(func(tx *bbolt.Tx) error {
+			if b := tx.Bucket(metaBucket); b != nil {
+				stored = append([]byte(nil), b.Get(databaseIDKey)...)
+				storedMAC = append([]byte(nil), b.Get(databaseIDMACKey)...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read database ID: %w", err)
+		}
+		if stored == nil {
+			if id != nil {
+				return nil, errors.New("database ID can only be set when the database is created")
+			}
+			return km.aead, nil
+		}
+		mac, err := databaseIDMAC(km, stored)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(mac, storedMAC) {
+			return nil, errors.New("stored database ID failed authentication")
+		}
+		if id != nil && !bytes.Equal(id, stored) {
+			return nil, fmt.Errorf("database ID %q does not match the ID %q the database was created with", id, stored)
+		}
+		id = stored
+	}
+
+	prefix := binary.AppendUvarint(nil, uint64(len(id)))
+	return idAEAD{AEAD: km.aead, prefix: append(prefix, id...)}, nil
+}
@@ -0,0 +1,84 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDatabaseID(t *testing.T) {
+	fileX := "test_dbid_tenant_x.db"
+	fileY := "test_dbid_tenant_y.db"
+	password := "secure-test-password"
+	bucketName := []byte("Data")
+	key := []byte("secret")
+
+	defer os.Remove(fileX)
+	defer os.Remove(fileY)
+
+	// A group shares one key between the files, which only the IDs separate
+	dbs, err := OpenGroup([]byte(password), []DBSpec{
+		{Filename: fileX, Mode: 0600, Options: &Options{DatabaseID: []byte("tenant-x")}},
+		{Filename: fileY, Mode: 0600, Options: &Options{DatabaseID: []byte("tenant-y")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to open databases: %v", err)
+	}
+	x, y := dbs[0], dbs[1]
+
+	var stored []byte
+	err = x.Update(func(tx *SecureTx) error {
+		if err := tx.Put(bucketName, key, []byte("tenant x data")); err != nil {
+			return err
+		}
+		stored = append([]byte{}, tx.Bolt().Bucket(bucketName).Get(key)...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write value: %v", err)
+	}
+
+	// Paste tenant X's ciphertext into tenant Y's file
+	err = y.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.bucket.Put(key, stored)
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy value: %v", err)
+	}
+	err = y.View(func(tx *SecureTx) error {
+		_, err := tx.Get(bucketName, key)
+		return err
+	})
+	if err == nil {
+		t.Fatalf("Expected a ciphertext copied from another database not to decrypt")
+	}
+	x.Close()
+	y.Close()
+
+	// Reopening uses the recorded ID
+	x, err = Open(fileX, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	err = x.View(func(tx *SecureTx) error {
+		v, err := tx.Get(bucketName, key)
+		if err != nil {
+			return err
+		}
+		if string(v) != "tenant x data" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+	x.Close()
+
+	if _, err := OpenWithOptions(fileX, 0600, []byte(password), &Options{DatabaseID: []byte("tenant-y")}); err == nil {
+		t.Fatalf("Expected opening with a different database ID to fail")
+	}
+}
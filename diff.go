@@ -0,0 +1,249 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+
+	"go.etcd.io/bbolt"
+)
+
+// DiffKind describes how a key differs between two buckets.
+type DiffKind int
+
+const (
+	OnlyInA       DiffKind = iota + 1 // Key exists only in the first bucket
+	OnlyInB                           // Key exists only in the second bucket
+	ValueMismatch                     // Key exists in both with different decrypted values
+)
+
+// String returns the name of the difference kind.
+func (k DiffKind) String() string {
+	switch k {
+	case OnlyInA:
+		return "only-in-a"
+	case OnlyInB:
+		return "only-in-b"
+	case ValueMismatch:
+		return "value-mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyDiff is a key whose presence or value differs between two buckets.
+type KeyDiff struct {
+	Key  []byte
+	Kind DiffKind
+}
+
+// DiffEntry is a difference between two databases, qualified by the
+// top-level bucket it was found in.
+type DiffEntry struct {
+	Bucket []byte
+	KeyDiff
+}
+
+// maxDiffEntries bounds the number of entries collected by Diff.
+const maxDiffEntries = 10000
+
+// errDiffLimit stops the walk once Diff has collected maxDiffEntries.
+var errDiffLimit = errors.New("diff limit reached")
+
+// Diff compares the decrypted logical contents of two databases, such as a
+// primary and its replica, and returns the differences in bucket and key
+// order. The databases may use different passwords and salts. Buckets present
+// in only one database report all of their keys. Internal securebolt_
+// buckets and nested buckets are not compared.
+//
+// At most 10000 entries are returned; when there are more, the first 10000 are
+// returned together with ErrDiffTruncated. Use DiffFunc to stream every
+// difference without holding them in memory. a and b must be distinct handles.
+func Diff(a, b *SecureBolt) ([]DiffEntry, error) {
+	var entries []DiffEntry
+	err := DiffFunc(a, b, func(e DiffEntry) error {
+		if len(entries) == maxDiffEntries {
+			return errDiffLimit
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if errors.Is(err, errDiffLimit) {
+		return entries, ErrDiffTruncated
+	}
+	return entries, err
+}
+
+// DiffFunc compares two databases like Diff, calling fn for each difference
+// as it is found instead of collecting them. A non-nil error from fn stops the
+// comparison and is returned. Both databases hold a read transaction for the
+// duration of the call.
+func DiffFunc(a, b *SecureBolt, fn func(DiffEntry) error) error {
+	return a.View(func(txA *SecureTx) error {
+		return b.View(func(txB *SecureTx) error {
+			return diffTxs(txA, txB, fn)
+		})
+	})
+}
+
+// diffTxs merges the top-level bucket names of both transactions and diffs
+// each bucket in turn.
+func diffTxs(txA, txB *SecureTx, fn func(DiffEntry) error) error {
+	ca, cb := txA.tx.Cursor(), txB.tx.Cursor()
+	na, _ := nextBucket(ca, true)
+	nb, _ := nextBucket(cb, true)
+	for na != nil || nb != nil {
+		var cmp int
+		switch {
+		case na == nil:
+			cmp = 1
+		case nb == nil:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(na, nb)
+		}
+
+		switch {
+		case cmp < 0:
+			if err := diffOneSided(txA.newBucket(na, txA.tx.Bucket(na)), OnlyInA, fn); err != nil {
+				return err
+			}
+			na, _ = nextBucket(ca, false)
+		case cmp > 0:
+			if err := diffOneSided(txB.newBucket(nb, txB.tx.Bucket(nb)), OnlyInB, fn); err != nil {
+				return err
+			}
+			nb, _ = nextBucket(cb, false)
+		default:
+			name := append([]byte{}, na...)
+			sa := txA.newBucket(name, txA.tx.Bucket(na))
+			sb := txB.newBucket(name, txB.tx.Bucket(nb))
+			err := diffBuckets(sa, sb, func(d KeyDiff) error {
+				return fn(DiffEntry{Bucket: name, KeyDiff: d})
+			})
+			if err != nil {
+				return err
+			}
+			na, _ = nextBucket(ca, false)
+			nb, _ = nextBucket(cb, false)
+		}
+	}
+	return nil
+}
+
+// diffOneSided reports every value in a bucket that exists in only one database.
+func diffOneSided(sb *SecureBucket, kind DiffKind, fn func(DiffEntry) error) error {
+	name := append([]byte{}, sb.name...)
+	c := sb.cursor()
+	for k, _ := nextValue(c, true); k != nil; k, _ = nextValue(c, false) {
+		if err := fn(DiffEntry{Bucket: name, KeyDiff: KeyDiff{Key: append([]byte{}, k...), Kind: kind}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextBucket advances a root cursor to the next user bucket, skipping the
+// internal securebolt_ buckets.
+func nextBucket(c *bbolt.Cursor, first bool) ([]byte, []byte) {
+	var k, v []byte
+	if first {
+		k, v = c.First()
+	} else {
+		k, v = c.Next()
+	}
+	for k != nil && bytes.HasPrefix(k, reservedPrefix) {
+		k, v = c.Next()
+	}
+	return k, v
+}
+
+// DiffBuckets compares the decrypted contents of two buckets, which may
+// belong to different databases encrypted under different keys, and returns
+// the differing keys in key order. Ciphertexts always differ because of
+// random nonces, so values are compared after decryption. Both buckets must
+// stay valid, i.e. their transactions open, for the duration of the call.
+func DiffBuckets(a, b *SecureBucket) ([]KeyDiff, error) {
+	var diffs []KeyDiff
+	err := diffBuckets(a, b, func(d KeyDiff) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	return diffs, err
+}
+
+// diffBuckets walks both buckets in key order and calls fn for each difference.
+func diffBuckets(a, b *SecureBucket, fn func(KeyDiff) error) error {
+	if err := a.checkOpen(); err != nil {
+		return err
+	}
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+
+	ca, cb := a.cursor(), b.cursor()
+	ka, va := nextValue(ca, true)
+	kb, vb := nextValue(cb, true)
+	for ka != nil || kb != nil {
+		var cmp int
+		switch {
+		case ka == nil:
+			cmp = 1
+		case kb == nil:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(ka, kb)
+		}
+
+		switch {
+		case cmp < 0:
+			if err := fn(KeyDiff{Key: append([]byte{}, ka...), Kind: OnlyInA}); err != nil {
+				return err
+			}
+			ka, va = nextValue(ca, false)
+		case cmp > 0:
+			if err := fn(KeyDiff{Key: append([]byte{}, kb...), Kind: OnlyInB}); err != nil {
+				return err
+			}
+			kb, vb = nextValue(cb, false)
+		default:
+			pa, err := a.openValue(ka, va)
+			if err != nil {
+				return err
+			}
+			pb, err := b.openValue(kb, vb)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(pa, pb) {
+				if err := fn(KeyDiff{Key: append([]byte{}, ka...), Kind: ValueMismatch}); err != nil {
+					return err
+				}
+			}
+			ka, va = nextValue(ca, false)
+			kb, vb = nextValue(cb, false)
+		}
+	}
+	return nil
+}
+
+// forwardCursor is the part of a cursor nextValue needs, implemented by both
+// *bbolt.Cursor and *liveCursor.
+type forwardCursor interface {
+	First() ([]byte, []byte)
+	Next() ([]byte, []byte)
+}
+
+// nextValue advances c to the next key holding a value, skipping nested
+// buckets. It starts from the first key when first is set.
+func nextValue(c forwardCursor, first bool) ([]byte, []byte) {
+	var k, v []byte
+	if first {
+		k, v = c.First()
+	} else {
+		k, v = c.Next()
+	}
+	for k != nil && v == nil {
+		k, v = c.Next()
+	}
+	return k, v
+}
@@ -0,0 +1,133 @@
+package securebolt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDiffBuckets(t *testing.T) {
+	filenameA := "test_diff_a.db"
+	filenameB := "test_diff_b.db"
+	password := "secure-test-password"
+	bucketName := []byte("DiffBucket")
+
+	defer os.Remove(filenameA)
+	defer os.Remove(filenameB)
+
+	// Two databases with different salts, and therefore different keys
+	dbA, err := Open(filenameA, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open first database: %v", err)
+	}
+	defer dbA.Close()
+	dbB, err := Open(filenameB, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open second database: %v", err)
+	}
+	defer dbB.Close()
+
+	populate := func(db *SecureBolt, entries map[string][]byte) {
+		err := db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.PutAll(entries)
+		})
+		if err != nil {
+			t.Fatalf("Failed to populate bucket: %v", err)
+		}
+	}
+	populate(dbA, map[string][]byte{"same": []byte("1"), "changed": []byte("old"), "only-a": []byte("a")})
+	populate(dbB, map[string][]byte{"same": []byte("1"), "changed": []byte("new"), "only-b": []byte("b")})
+
+	var diffs []KeyDiff
+	err = dbA.View(func(txA *SecureTx) error {
+		return dbB.View(func(txB *SecureTx) error {
+			a, err := txA.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			b, err := txB.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			diffs, err = DiffBuckets(a, b)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("DiffBuckets failed: %v", err)
+	}
+
+	expected := []string{"value-mismatch changed", "only-in-a only-a", "only-in-b only-b"}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Got %d diffs, expected %d: %v", len(diffs), len(expected), diffs)
+	}
+	for i, d := range diffs {
+		if got := fmt.Sprintf("%s %s", d.Kind, d.Key); got != expected[i] {
+			t.Fatalf("Diff %d: got %q, expected %q", i, got, expected[i])
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	filenameA := "test_diffdb_a.db"
+	filenameB := "test_diffdb_b.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filenameA)
+	defer os.Remove(filenameB)
+
+	dbA, err := Open(filenameA, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open first database: %v", err)
+	}
+	defer dbA.Close()
+	dbB, err := Open(filenameB, 0600, []byte("other-test-password"))
+	if err != nil {
+		t.Fatalf("Failed to open second database: %v", err)
+	}
+	defer dbB.Close()
+
+	populate := func(db *SecureBolt, buckets map[string]map[string][]byte) {
+		err := db.Update(func(tx *SecureTx) error {
+			for name, entries := range buckets {
+				b, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+				if err := b.PutAll(entries); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to populate database: %v", err)
+		}
+	}
+	populate(dbA, map[string]map[string][]byte{
+		"shared": {"k1": []byte("v1"), "k2": []byte("v2")},
+		"only-a": {"x": []byte("1")},
+	})
+	populate(dbB, map[string]map[string][]byte{
+		"shared": {"k1": []byte("v1"), "k2": []byte("changed")},
+	})
+
+	entries, err := Diff(dbA, dbB)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	expected := []string{"only-a x only-in-a", "shared k2 value-mismatch"}
+	if len(entries) != len(expected) {
+		t.Fatalf("Got %d entries, expected %d: %v", len(entries), len(expected), entries)
+	}
+	for i, e := range entries {
+		if got := fmt.Sprintf("%s %s %s", e.Bucket, e.Key, e.Kind); got != expected[i] {
+			t.Fatalf("Entry %d: got %q, expected %q", i, got, expected[i])
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package securebolt
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Encrypted values are stored in a versioned, self-describing envelope:
+//
+//	[version byte][flags byte][key-id uvarint][nonce][ciphertext+tag]
+//
+// The header (version, flags and key-id) is authenticated as additional data,
+// so flipping a flag or changing the key-id makes decryption fail. Values
+// written before the envelope existed are a bare nonce followed by the
+// ciphertext; they are recognized by falling back to that legacy layout
+// whenever a value does not authenticate as an envelope.
+//
+// SoftDelete tombstones use the same layout under their own version byte,
+// tombstoneVersion, and their plaintext is only the deletion time. Since the
+// version is authenticated too, a value cannot be turned into a tombstone or
+// back, and readers that predate tombstones fail to open them instead of
+// returning the deletion time as a value.
+
+// envelopeVersion is the version byte written at the start of every envelope.
+const envelopeVersion = 1
+
+// tombstoneVersion is the version byte written at the start of a tombstone.
+const tombstoneVersion = 2
+
+// Envelope flags.
+const (
+	flagCompressed byte = 1 << iota // Plaintext was DEFLATE-compressed before encryption
+	flagBound                       // Additional data binds the value to its bucket and key
+	flagExternal                    // Plaintext is a reference to a value in the securebolt_external bucket
+	flagSigned                      // Value ends with a PutSigned signature
+	flagExpiry                      // Value starts with a PutWithTTL expiry time
+	flagPadded                      // Plaintext was length-prefixed and zero-padded after compression
+	flagModified                    // Value starts, after any expiry time, with its last-modified time
+
+	knownFlags = flagCompressed | flagBound | flagExternal | flagSigned | flagExpiry | flagPadded | flagModified
+)
+
+// PadToPowerOfTwo is the SetPadding block size that pads values to the next
+// power of two.
+const PadToPowerOfTwo = -1
+
+// padLengthPrefix is the length of the true plaintext length recorded at the
+// start of padded plaintext.
+const padLengthPrefix = 4
+
+// rootKeyID is the key-id of the key derived from the password. Keys that
+// replace it when Options.AutoRotateOnLimit rotates the key get the next
+// key-ids; see keyRing.
+const rootKeyID = 0
+
+// binding identifies where a value is stored. Values sealed with flagBound
+// only decrypt at the same bucket and key they were written to.
+type binding struct {
+	bucket []byte
+	key    []byte
+}
+
+// additionalData returns the data authenticated alongside the ciphertext.
+func additionalData(header []byte, flags byte, bind *binding) []byte {
+	if flags&flagBound == 0 {
+		return header
+	}
+	aad := append([]byte{}, header...)
+	aad = binary.AppendUvarint(aad, uint64(len(bind.bucket)))
+	aad = append(aad, bind.bucket...)
+	return append(aad, bind.key...)
+}
+
+// envelopeHeader is the decoded header of an envelope.
+type envelopeHeader struct {
+	version byte
+	flags   byte
+	keyID   uint64
+}
+
+// parseEnvelope splits stored into its decoded header, the raw header bytes,
+// the nonce and the ciphertext. It returns false when stored does not start
+// with a recognizable envelope header.
+func parseEnvelope(stored []byte, nonceSize int) (h envelopeHeader, header, nonce, ciphertext []byte, ok bool) {
+	if len(stored) < 3 || (stored[0] != envelopeVersion && stored[0] != tombstoneVersion) {
+		return h, nil, nil, nil, false
+	}
+	keyID, n := binary.Uvarint(stored[2:])
+	if n <= 0 {
+		return h, nil, nil, nil, false
+	}
+	headerLen := 2 + n
+	if len(stored) < headerLen+nonceSize {
+		return h, nil, nil, nil, false
+	}
+	h = envelopeHeader{version: stored[0], flags: stored[1], keyID: keyID}
+	header = stored[:headerLen]
+	nonce = stored[headerLen : headerLen+nonceSize]
+	ciphertext = stored[headerLen+nonceSize:]
+	return h, header, nonce, ciphertext, true
+}
+
+// encryptData seals data in an envelope without flags.
+func encryptData(data []byte, aead cipher.AEAD) ([]byte, error) {
+	return sealEnvelope(data, aead, 0, nil)
+}
+
+// decryptData opens an envelope that is not bound to a bucket and key.
+func decryptData(encryptedData []byte, aead cipher.AEAD) ([]byte, error) {
+	return openEnvelope(encryptedData, aead, nil)
+}
+
+// sealEnvelope encrypts data into an envelope carrying the given flags. bind
+// is required when flags include flagBound.
+func sealEnvelope(data []byte, aead cipher.AEAD, flags byte, bind *binding) ([]byte, error) {
+	return sealEnvelopePadded(data, aead, flags, bind, 0)
+}
+
+// sealEnvelopePadded is sealEnvelope padding the plaintext to blockSize, as
+// described by SetPadding, when flags include flagPadded.
+func sealEnvelopePadded(data []byte, aead cipher.AEAD, flags byte, bind *binding, blockSize int) ([]byte, error) {
+	if flags&^knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported envelope flags %#x", flags)
+	}
+	if flags&flagBound != 0 && bind == nil {
+		return nil, errors.New("bound envelope requires a bucket and key")
+	}
+	if flags&flagPadded != 0 && blockSize == 0 {
+		return nil, errors.New("padded envelope requires a block size")
+	}
+	if flags&flagCompressed != 0 {
+		compressed, err := compressData(data)
+		if err != nil {
+			return nil, err
+		}
+		data = compressed
+	}
+	if flags&flagPadded != 0 {
+		data = padData(data, blockSize)
+	}
+	return sealRaw(data, aead, flags, bind)
+}
+
+// sealRaw encrypts data, already compressed and padded as flags say, into
+// an envelope.
+func sealRaw(data []byte, aead cipher.AEAD, flags byte, bind *binding) ([]byte, error) {
+	return sealVersion(envelopeVersion, data, aead, flags, bind)
+}
+
+// sealTombstone encrypts the deletion time of a SoftDelete tombstone. The
+// only flag a tombstone may carry is flagBound.
+func sealTombstone(deletedAt int64, aead cipher.AEAD, flags byte, bind *binding) ([]byte, error) {
+	if flags&^flagBound != 0 {
+		return nil, fmt.Errorf("unsupported tombstone flags %#x", flags)
+	}
+	if flags&flagBound != 0 && bind == nil {
+		return nil, errors.New("bound envelope requires a bucket and key")
+	}
+	return sealVersion(tombstoneVersion, Uint64Key(uint64(deletedAt)), aead, flags, bind)
+}
+
+// sealVersion is sealRaw writing the given version byte.
+func sealVersion(version byte, data []byte, aead cipher.AEAD, flags byte, bind *binding) ([]byte, error) {
+	header := binary.AppendUvarint([]byte{version, flags}, keyIDOf(aead))
+	out := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, header)
+	nonce := out[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(out, nonce, data, additionalData(header, flags, bind)), nil
+}
+
+// openEnvelope decrypts a stored value, falling back to the legacy layout
+// when it does not authenticate as an envelope. The returned plaintext is
+// never nil for a non-nil input, so an empty value is distinguishable from a
+// missing one.
+func openEnvelope(stored []byte, aead cipher.AEAD, bind *binding) ([]byte, error) {
+	plaintext, _, err := openEnvelopeFlags(stored, aead, bind)
+	return plaintext, err
+}
+
+// openEnvelopeFlags is openEnvelope that also returns the envelope flags,
+// which are zero for legacy values.
+func openEnvelopeFlags(stored []byte, aead cipher.AEAD, bind *binding) ([]byte, byte, error) {
+	plaintext, flags, _, err := openEnvelopeFormat(stored, aead, bind)
+	return plaintext, flags, err
+}
+
+// openEnvelopeFormat is openEnvelopeFlags that also reports whether stored
+// uses the legacy layout.
+func openEnvelopeFormat(stored []byte, aead cipher.AEAD, bind *binding) ([]byte, byte, bool, error) {
+	return openEnvelopeInto(nil, stored, aead, bind)
+}
+
+// openEnvelopeInto is openEnvelopeFormat decrypting into the storage of dst
+// when it has enough capacity. Compressed values are still decompressed into
+// a fresh allocation, and dst then holds the compressed plaintext.
+func openEnvelopeInto(dst, stored []byte, aead cipher.AEAD, bind *binding) ([]byte, byte, bool, error) {
+	if stored == nil {
+		return nil, 0, false, nil
+	}
+	h, header, nonce, ciphertext, ok := parseEnvelope(stored, aead.NonceSize())
+	if !ok {
+		plaintext, err := openLegacy(dst, stored, aead)
+		return plaintext, 0, true, err
+	}
+	plaintext, err := openCurrent(dst, h, header, nonce, ciphertext, aead, bind)
+	if err != nil {
+		// A legacy value whose random nonce happens to look like a header
+		if legacy, legacyErr := openLegacy(dst, stored, aead); legacyErr == nil {
+			return legacy, 0, true, nil
+		}
+		return nil, 0, false, err
+	}
+	return plaintext, h.flags, false, nil
+}
+
+// openCurrent decrypts the parts of a parsed envelope, appending to dst[:0].
+func openCurrent(dst []byte, h envelopeHeader, header, nonce, ciphertext []byte, aead cipher.AEAD, bind *binding) ([]byte, error) {
+	plaintext, err := openRaw(dst, h, header, nonce, ciphertext, aead, bind)
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&flagPadded != 0 {
+		if plaintext, err = unpadData(plaintext); err != nil {
+			return nil, err
+		}
+	}
+	if h.flags&flagCompressed != 0 {
+		return decompressData(plaintext)
+	}
+	return plaintext, nil
+}
+
+// openRaw decrypts the parts of a parsed envelope, appending to dst[:0],
+// without removing padding or decompressing.
+func openRaw(dst []byte, h envelopeHeader, header, nonce, ciphertext []byte, aead cipher.AEAD, bind *binding) ([]byte, error) {
+	if h.flags&^knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported envelope flags %#x", h.flags)
+	}
+	aead, err := cipherFor(aead, h.keyID)
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&flagBound != 0 && bind == nil {
+		return nil, errors.New("value is bound to a bucket and key")
+	}
+	plaintext, err := aead.Open(dst[:0], nonce, ciphertext, additionalData(header, h.flags, bind))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	return plaintext, nil
+}
+
+// resealEnvelope re-encrypts a stored value under a fresh nonce and the key
+// aead seals under, which after a key rotation is not the one stored was
+// sealed under. Envelopes keep their flags and their plaintext exactly as
+// stored, compressed and padded, and tombstones stay tombstones; legacy
+// values are sealed as envelopes without flags.
+func resealEnvelope(stored []byte, aead cipher.AEAD, bind *binding) ([]byte, error) {
+	if h, header, nonce, ciphertext, ok := parseEnvelope(stored, aead.NonceSize()); ok {
+		raw, err := openRaw(nil, h, header, nonce, ciphertext, aead, bind)
+		if err == nil {
+			return sealVersion(h.version, raw, aead, h.flags, bind)
+		}
+		// A legacy value whose random nonce happens to look like a header
+		plaintext, legacyErr := openLegacy(nil, stored, aead)
+		if legacyErr != nil {
+			return nil, err
+		}
+		return sealEnvelope(plaintext, aead, 0, nil)
+	}
+	plaintext, err := openLegacy(nil, stored, aead)
+	if err != nil {
+		return nil, err
+	}
+	return sealEnvelope(plaintext, aead, 0, nil)
+}
+
+// padData prefixes data with its length and appends zeros up to the next
+// power of two for PadToPowerOfTwo, or else the next multiple of blockSize.
+func padData(data []byte, blockSize int) []byte {
+	n := padLengthPrefix + len(data)
+	size := 1 << bits.Len(uint(n-1))
+	if blockSize != PadToPowerOfTwo {
+		size = (n + blockSize - 1) / blockSize * blockSize
+	}
+	padded := make([]byte, size)
+	binary.BigEndian.PutUint32(padded, uint32(len(data)))
+	copy(padded[padLengthPrefix:], data)
+	return padded
+}
+
+// unpadData reverses padData.
+func unpadData(padded []byte) ([]byte, error) {
+	if len(padded) < padLengthPrefix {
+		return nil, errors.New("padded value is missing its length")
+	}
+	n := binary.BigEndian.Uint32(padded)
+	if uint64(n) > uint64(len(padded)-padLengthPrefix) {
+		return nil, errors.New("padded value length is out of range")
+	}
+	end := padLengthPrefix + int(n)
+	return padded[padLengthPrefix:end:end], nil
+}
+
+// openLegacy decrypts a value stored as a bare nonce followed by the
+// ciphertext, appending to dst[:0]. Legacy values predate key rotation and
+// are always under the root key.
+func openLegacy(dst, encryptedData []byte, aead cipher.AEAD) ([]byte, error) {
+	aead, err := cipherFor(aead, rootKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedData) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, ciphertext := encryptedData[:aead.NonceSize()], encryptedData[aead.NonceSize():]
+	plaintext, err := aead.Open(dst[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	return plaintext, nil
+}
+
+// compressData compresses data with DEFLATE.
+func compressData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressData reverses compressData.
+func decompressData(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress data: %w", err)
+	}
+	return plaintext, nil
+}
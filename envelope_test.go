@@ -0,0 +1,168 @@
+package securebolt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+// testAEAD returns a cipher under a random key.
+func testAEAD(t *testing.T) cipher.AEAD {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	return aead
+}
+
+func TestEnvelopeFlags(t *testing.T) {
+	aead := testAEAD(t)
+	bind := &binding{bucket: []byte("bucket"), key: []byte("key")}
+	plaintexts := [][]byte{{}, []byte("short"), bytes.Repeat([]byte("compressible "), 100)}
+
+	for _, flags := range []byte{0, flagCompressed, flagBound, flagCompressed | flagBound} {
+		for _, plaintext := range plaintexts {
+			name := fmt.Sprintf("flags=%#x/len=%d", flags, len(plaintext))
+			var b *binding
+			if flags&flagBound != 0 {
+				b = bind
+			}
+
+			stored, err := sealEnvelope(plaintext, aead, flags, b)
+			if err != nil {
+				t.Fatalf("%s: failed to seal: %v", name, err)
+			}
+			h, _, _, _, ok := parseEnvelope(stored, aead.NonceSize())
+			if !ok || h.version != envelopeVersion || h.flags != flags || h.keyID != rootKeyID {
+				t.Fatalf("%s: unexpected header %+v (ok=%v)", name, h, ok)
+			}
+
+			got, err := openEnvelope(stored, aead, b)
+			if err != nil {
+				t.Fatalf("%s: failed to open: %v", name, err)
+			}
+			if got == nil || !bytes.Equal(got, plaintext) {
+				t.Fatalf("%s: opened %q, expected %q", name, got, plaintext)
+			}
+
+			// Tampering with the flags byte breaks authentication
+			tampered := append([]byte{}, stored...)
+			tampered[1] ^= flagCompressed
+			if _, err := openEnvelope(tampered, aead, bind); err == nil {
+				t.Fatalf("%s: tampered flags were accepted", name)
+			}
+
+			if flags&flagBound != 0 {
+				other := &binding{bucket: []byte("bucket"), key: []byte("other")}
+				if _, err := openEnvelope(stored, aead, other); err == nil {
+					t.Fatalf("%s: bound value opened under a different key", name)
+				}
+				if _, err := openEnvelope(stored, aead, nil); err == nil {
+					t.Fatalf("%s: bound value opened without a binding", name)
+				}
+			}
+		}
+	}
+}
+
+func TestEnvelopeCompression(t *testing.T) {
+	aead := testAEAD(t)
+	plaintext := bytes.Repeat([]byte("compressible "), 100)
+
+	plain, err := sealEnvelope(plaintext, aead, 0, nil)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	compressed, err := sealEnvelope(plaintext, aead, flagCompressed, nil)
+	if err != nil {
+		t.Fatalf("Failed to seal compressed: %v", err)
+	}
+	if len(compressed) >= len(plain) {
+		t.Fatalf("Compressed envelope is %d bytes, uncompressed is %d", len(compressed), len(plain))
+	}
+}
+
+func TestEnvelopeLegacy(t *testing.T) {
+	aead := testAEAD(t)
+
+	// Legacy values are a bare nonce followed by the ciphertext. Seal enough
+	// of them that some nonces start with the envelope version byte.
+	for i := 0; i < 1024; i++ {
+		plaintext := []byte(fmt.Sprintf("legacy-%d", i))
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			t.Fatalf("Failed to generate nonce: %v", err)
+		}
+		legacy := aead.Seal(nonce, nonce, plaintext, nil)
+
+		got, err := decryptData(legacy, aead)
+		if err != nil {
+			t.Fatalf("Failed to open legacy value %d: %v", i, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("Opened %q, expected %q", got, plaintext)
+		}
+	}
+}
+
+func TestEnvelopeRejectsUnknown(t *testing.T) {
+	aead := testAEAD(t)
+
+	if _, err := sealEnvelope([]byte("value"), aead, 0x80, nil); err == nil {
+		t.Fatalf("Sealing with unknown flags succeeded")
+	}
+	stored, err := encryptData([]byte("value"), aead)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	stored[1] = 0x80
+	if _, err := decryptData(stored, aead); err == nil {
+		t.Fatalf("Opening with unknown flags succeeded")
+	}
+	if _, err := decryptData([]byte{envelopeVersion}, aead); err == nil {
+		t.Fatalf("Opening a truncated value succeeded")
+	}
+}
+
+func TestEnvelopeTombstone(t *testing.T) {
+	aead := testAEAD(t)
+	bind := &binding{bucket: []byte("bucket"), key: []byte("key")}
+
+	if _, err := sealTombstone(1, aead, flagCompressed, nil); err == nil {
+		t.Fatalf("Sealing a tombstone with flags other than flagBound succeeded")
+	}
+	stored, err := sealTombstone(42, aead, flagBound, bind)
+	if err != nil {
+		t.Fatalf("Failed to seal tombstone: %v", err)
+	}
+	if stored[0] != tombstoneVersion {
+		t.Fatalf("Tombstone starts with %#x, expected %#x", stored[0], tombstoneVersion)
+	}
+
+	resealed, err := resealEnvelope(stored, aead, bind)
+	if err != nil {
+		t.Fatalf("Failed to reseal tombstone: %v", err)
+	}
+	if resealed[0] != tombstoneVersion {
+		t.Fatalf("Resealing turned the tombstone into version %#x", resealed[0])
+	}
+	plaintext, err := openEnvelope(resealed, aead, bind)
+	if err != nil {
+		t.Fatalf("Failed to open tombstone: %v", err)
+	}
+	if deleted, _ := ParseUint64Key(plaintext); deleted != 42 {
+		t.Fatalf("Opened deletion time %d, expected 42", deleted)
+	}
+
+	resealed[0] = envelopeVersion
+	if _, err := openEnvelope(resealed, aead, bind); err == nil {
+		t.Fatalf("Opening a tombstone relabelled as a value succeeded")
+	}
+}
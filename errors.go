@@ -0,0 +1,75 @@
+package securebolt
+
+import "errors"
+
+var (
+	// ErrFileLocked is returned by Open when the database file lock could not
+	// be acquired before Options.Timeout elapsed. It wraps bbolt's timeout error.
+	ErrFileLocked = errors.New("database file is locked by another process")
+
+	// ErrKDFResourcesUnavailable is returned by Open when the host cannot
+	// provide the memory required by the Argon2 key derivation parameters.
+	ErrKDFResourcesUnavailable = errors.New("insufficient resources for key derivation")
+
+	// ErrVersionConflict is returned by UpdateIfVersion when the stored
+	// version does not match the expected one.
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrDBClosed is returned when a database is used after Close.
+	ErrDBClosed = errors.New("database is closed")
+
+	// ErrDiffTruncated is returned by Diff, together with the entries
+	// collected so far, when the databases differ in more keys than Diff
+	// returns at once.
+	ErrDiffTruncated = errors.New("diff truncated")
+
+	// ErrInvalidReceipt is returned by VerifyReceipt when a receipt does not
+	// match the bucket, key and value it is checked against.
+	ErrInvalidReceipt = errors.New("invalid receipt")
+
+	// ErrInvalidKeyLength is returned when key material does not have a
+	// length the cipher accepts. The error message names the expected sizes.
+	ErrInvalidKeyLength = errors.New("invalid key length")
+
+	// ErrInvalidPageToken is returned by PageToken when a continuation token
+	// does not decrypt, was altered or belongs to another bucket.
+	ErrInvalidPageToken = errors.New("invalid page token")
+
+	// ErrNotADatabase is returned by Open when the file exists but is not a
+	// bbolt database, or is one whose metadata is corrupt or of an unsupported
+	// version. It wraps bbolt's error and is distinct from a wrong password
+	// or a lock timeout.
+	ErrNotADatabase = errors.New("file is not a valid database")
+
+	// ErrInsecureFilePermissions is returned by Open with
+	// Options.StrictFileMode when the database file's permissions are broader
+	// than the requested mode.
+	ErrInsecureFilePermissions = errors.New("database file permissions are too permissive")
+
+	// ErrExternalSaltRequired is returned by Open when the database was
+	// created with Options.ExternalSalt but is opened without one.
+	ErrExternalSaltRequired = errors.New("database requires an external salt")
+
+	// ErrInvalidKeyMaterial is returned by RestoreKeyMaterial when the blob is
+	// malformed, was altered, belongs to another database or predates a key
+	// rotation, or when the password does not match the database key.
+	ErrInvalidKeyMaterial = errors.New("invalid key material")
+
+	// ErrInvalidPassword is returned by Open when the derived key does not
+	// match the key-check verifier stored in the database, which means the
+	// password, or the shares or pepper it is combined with, is wrong.
+	ErrInvalidPassword = errors.New("invalid password")
+
+	// ErrWeakPassword is returned by Open when the estimated strength of the
+	// password is below Options.MinPasswordBits.
+	ErrWeakPassword = errors.New("password is too weak")
+
+	// ErrKeyUsageExceeded is returned by writes that would take the data
+	// encrypted under the current key past Options.MaxBytesPerKey, unless
+	// Options.AutoRotateOnLimit is set.
+	ErrKeyUsageExceeded = errors.New("key usage limit exceeded")
+
+	// ErrNilValue is returned by Put and the other writes when the value is
+	// nil and Options.RejectNilValue is set.
+	ErrNilValue = errors.New("value cannot be nil")
+)
@@ -0,0 +1,112 @@
+package securebolt
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExportCSV writes every entry of the bucket to w as CSV with a "key,value"
+// header row. Keys and values are base64-encoded (standard encoding) so
+// arbitrary binary data stays CSV-safe.
+//
+// The exported values are DECRYPTED. The output contains the bucket's data in
+// plaintext and must only be produced for, and delivered to, trusted parties.
+func (sb *SecureBucket) ExportCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"key", "value"}); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	err := sb.bucket.ForEach(func(k, encV []byte) error {
+		if encV == nil || sb.tombstoned(k, encV) {
+			return nil // Nested bucket or tombstone
+		}
+		v, err := sb.openValue(k, encV)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		return cw.Write([]string{
+			base64.StdEncoding.EncodeToString(k),
+			base64.StdEncoding.EncodeToString(v),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportTar writes every entry of the bucket to w as a tar stream holding one
+// regular file per key. Each file is named after its key, base64-encoded with
+// the URL-safe alphabet and no padding so any key yields a valid file name,
+// and contains the value. Nested buckets are skipped. ImportTar reads the
+// stream back.
+//
+// The exported values are DECRYPTED. The archive contains the bucket's data in
+// plaintext and must only be produced for, and delivered to, trusted parties.
+func (sb *SecureBucket) ExportTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := sb.bucket.ForEach(func(k, encV []byte) error {
+		if encV == nil || sb.tombstoned(k, encV) {
+			return nil // Nested bucket or tombstone
+		}
+		v, err := sb.openValue(k, encV)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     base64.RawURLEncoding.EncodeToString(k),
+			Mode:     0600,
+			Size:     int64(len(v)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header for key %q: %w", k, err)
+		}
+		if _, err := tw.Write(v); err != nil {
+			return fmt.Errorf("failed to write tar entry for key %q: %w", k, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ImportTar reads a tar stream produced by ExportTar and stores each file as
+// an entry of the bucket, replacing existing values with the same key. It
+// must be called within Update; on error the Update callback should return
+// it so that no part of the archive is stored.
+func (sb *SecureBucket) ImportTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected tar entry %q of type %q", hdr.Name, hdr.Typeflag)
+		}
+		key, err := base64.RawURLEncoding.DecodeString(hdr.Name)
+		if err != nil {
+			return fmt.Errorf("invalid tar entry name %q: %w", hdr.Name, err)
+		}
+		value, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry %q: %w", hdr.Name, err)
+		}
+		if err := sb.Put(key, value); err != nil {
+			return fmt.Errorf("failed to put key %q: %w", key, err)
+		}
+	}
+}
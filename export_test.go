@@ -0,0 +1,146 @@
+package securebolt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"os"
+	"testing"
+)
+
+func TestExportCSV(t *testing.T) {
+	filename := "test_export_csv.db"
+	password := "secure-test-password"
+	bucketName := []byte("ExportBucket")
+	entries := map[string][]byte{
+		"alpha":        []byte("first"),
+		"binary\x00\n": {0x00, 0xff, ',', '"', '\n'},
+		"empty":        {},
+	}
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.PutAll(entries)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.ExportCSV(&buf)
+	})
+	if err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != len(entries)+1 {
+		t.Fatalf("Got %d CSV rows, expected %d", len(records), len(entries)+1)
+	}
+	if records[0][0] != "key" || records[0][1] != "value" {
+		t.Fatalf("Unexpected header row %v", records[0])
+	}
+	for _, record := range records[1:] {
+		k, err := base64.StdEncoding.DecodeString(record[0])
+		if err != nil {
+			t.Fatalf("Failed to decode key: %v", err)
+		}
+		v, err := base64.StdEncoding.DecodeString(record[1])
+		if err != nil {
+			t.Fatalf("Failed to decode value: %v", err)
+		}
+		expected, ok := entries[string(k)]
+		if !ok {
+			t.Fatalf("Unexpected key %q in export", k)
+		}
+		if !bytes.Equal(v, expected) {
+			t.Fatalf("Value mismatch for key %q: got %q, expected %q", k, v, expected)
+		}
+	}
+}
+
+func TestExportImportTar(t *testing.T) {
+	filename := "test_export_tar.db"
+	password := "secure-test-password"
+	entries := map[string][]byte{
+		"alpha":        []byte("first"),
+		"path/like?":   []byte("second"),
+		"binary\x00\n": {0x00, 0xff},
+		"empty":        {},
+	}
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	var archive bytes.Buffer
+	err = db.Update(func(tx *SecureTx) error {
+		src, err := tx.CreateBucket([]byte("Source"))
+		if err != nil {
+			return err
+		}
+		if err := src.PutAll(entries); err != nil {
+			return err
+		}
+		if err := src.ExportTar(&archive); err != nil {
+			return err
+		}
+		dst, err := tx.CreateBucket([]byte("Restored"))
+		if err != nil {
+			return err
+		}
+		return dst.ImportTar(bytes.NewReader(archive.Bytes()))
+	})
+	if err != nil {
+		t.Fatalf("Tar round trip failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket([]byte("Restored"))
+		if err != nil {
+			return err
+		}
+		count := 0
+		err = b.ForEach(func(k, v []byte) error {
+			count++
+			want, ok := entries[string(k)]
+			if !ok || !bytes.Equal(v, want) {
+				t.Fatalf("Restored %q=%q does not match the original", k, v)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if count != len(entries) {
+			t.Fatalf("Restored %d entries, expected %d", count, len(entries))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read restored bucket: %v", err)
+	}
+}
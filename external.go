@@ -0,0 +1,71 @@
+package securebolt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// externalBucket holds values above Options.ExternalThreshold, keyed by a
+// random reference that is stored, encrypted, in the value's own bucket.
+// Each external value is bound to its reference, so an entry moved or copied
+// to another reference fails to decrypt.
+var externalBucket = []byte("securebolt_external")
+
+// externalRefLength is the length of the random reference to an external value.
+const externalRefLength = 16
+
+// storeExternal encrypts value into the external bucket and returns the
+// envelope holding its reference, carrying flags in addition to flagExternal.
+// flagCompressed and flagPadded, with blockSize, apply to the external value
+// rather than the reference, while flagBound binds the reference envelope.
+// The external value itself is always bound, with externalBinding.
+func (sb *SecureBucket) storeExternal(value []byte, flags byte, bind *binding, blockSize int) ([]byte, error) {
+	side, err := sb.tx.tx.CreateBucketIfNotExists(externalBucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create external bucket: %w", err)
+	}
+	ref := make([]byte, externalRefLength)
+	if _, err := rand.Read(ref); err != nil {
+		return nil, fmt.Errorf("failed to generate external reference: %w", err)
+	}
+	encryptedValue, err := sealEnvelopePadded(value, sb.aead, flags&(flagCompressed|flagPadded)|flagBound, externalBinding(ref), blockSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := side.Put(ref, encryptedValue); err != nil {
+		return nil, err
+	}
+	return sealEnvelope(ref, sb.aead, flags&^(flagCompressed|flagPadded)|flagExternal, bind)
+}
+
+// loadExternal decrypts the external value a reference points to.
+func (sb *SecureBucket) loadExternal(ref []byte) ([]byte, error) {
+	var encryptedValue []byte
+	if side := sb.tx.tx.Bucket(externalBucket); side != nil {
+		encryptedValue = side.Get(ref)
+	}
+	if encryptedValue == nil {
+		return nil, errors.New("external value is missing")
+	}
+	return openEnvelope(encryptedValue, sb.aead, externalBinding(ref))
+}
+
+// externalBinding returns the binding of the external value stored under
+// ref. Values written before external values were bound carry no flagBound
+// and still decrypt with it.
+func externalBinding(ref []byte) *binding {
+	return &binding{bucket: externalBucket, key: ref}
+}
+
+// releaseExternal deletes the external value a reference points to.
+func (sb *SecureBucket) releaseExternal(ref []byte) error {
+	if ref == nil {
+		return nil
+	}
+	side := sb.tx.tx.Bucket(externalBucket)
+	if side == nil {
+		return nil
+	}
+	return side.Delete(ref)
+}
@@ -0,0 +1,158 @@
+package securebolt
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestExternalThreshold(t *testing.T) {
+	filename := "test_external.db"
+	password := "secure-test-password"
+	bucketName := []byte("ExternalBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalThreshold: 64})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	small := []byte("small value")
+	large := bytes.Repeat([]byte("large value "), 100)
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("small"), small); err != nil {
+			return err
+		}
+		return b.Put([]byte("large"), large)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for key, want := range map[string][]byte{"small": small, "large": large} {
+			got, err := b.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Value for %q does not round-trip", key)
+			}
+		}
+
+		// Only the large value lives in the side bucket
+		side := tx.Bolt().Bucket(externalBucket)
+		if side == nil || side.Stats().KeyN != 1 {
+			t.Fatalf("Expected exactly one value in the external bucket")
+		}
+		if inline := tx.Bolt().Bucket(bucketName).Get([]byte("large")); len(inline) >= len(large) {
+			t.Fatalf("Large value is stored inline (%d bytes)", len(inline))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to verify values: %v", err)
+	}
+
+	// Deleting the key also removes its external value
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte("large"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete value: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		if n := tx.Bolt().Bucket(externalBucket).Stats().KeyN; n != 0 {
+			t.Fatalf("External bucket still holds %d values after delete", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to inspect external bucket: %v", err)
+	}
+}
+
+func TestExternalValuesBound(t *testing.T) {
+	filename := "test_external_bound.db"
+	password := "secure-test-password"
+	bucketName := []byte("ExternalBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalThreshold: 16})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("alice"), bytes.Repeat([]byte("a"), 64)); err != nil {
+			return err
+		}
+		return b.Put([]byte("bob"), bytes.Repeat([]byte("b"), 64))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	// Refreshing re-seals the external values under the same binding
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+
+	// Swap the two external ciphertexts behind the references
+	err = db.Update(func(tx *SecureTx) error {
+		side := tx.Bolt().Bucket(externalBucket)
+		var refs, values [][]byte
+		side.ForEach(func(k, v []byte) error {
+			refs = append(refs, append([]byte{}, k...))
+			values = append(values, append([]byte{}, v...))
+			return nil
+		})
+		if len(refs) != 2 {
+			t.Fatalf("Expected 2 external values, got %d", len(refs))
+		}
+		if err := side.Put(refs[0], values[1]); err != nil {
+			return err
+		}
+		return side.Put(refs[1], values[0])
+	})
+	if err != nil {
+		t.Fatalf("Failed to swap external values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{"alice", "bob"} {
+			if v, err := b.Get([]byte(key)); err == nil {
+				t.Errorf("Expected a swapped external value for %q to fail to decrypt, got %q", key, v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+}
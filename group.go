@@ -0,0 +1,97 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/awnumar/memguard"
+	"go.etcd.io/bbolt"
+)
+
+// DBSpec describes one database opened by OpenGroup.
+type DBSpec struct {
+	Filename string
+	Mode     fs.FileMode
+	Options  *Options // Nil for the defaults
+}
+
+// groupKey is the salt and key shared by the databases of an OpenGroup.
+type groupKey struct {
+	salt    []byte
+	keyLock *memguard.LockedBuffer // Nil until the first database derives it
+}
+
+// cloneKey returns a frozen copy of keyLock, so that each database of a
+// group destroys its own key on Close.
+func cloneKey(keyLock *memguard.LockedBuffer) *memguard.LockedBuffer {
+	c := memguard.NewBufferFromBytes(append([]byte{}, keyLock.Bytes()...))
+	c.Freeze()
+	return c
+}
+
+// destroy destroys the group's copy of the key.
+func (g *groupKey) destroy() {
+	if g.keyLock != nil {
+		g.keyLock.Destroy()
+	}
+}
+
+// OpenGroup opens or creates several databases protected by the same
+// password, such as hot, cold and archive files, running the expensive
+// Argon2 derivation only once. The databases share one salt: the first
+// database keeps its own, or generates one when it is new, and the others
+// must have been created with it. New databases in the group are created
+// with the shared salt, so each of them can still be opened on its own with
+// Open and the same password. Opening an existing database with a different
+// salt fails.
+//
+// Since the key is shared, every spec must use the same ExternalSalt and
+// Pepper options. On error, the databases opened so far are closed. The
+// password is wiped before OpenGroup returns.
+func OpenGroup(password []byte, specs []DBSpec) ([]*SecureBolt, error) {
+	defer memguard.WipeBytes(password) // Securely erase the password
+	if len(password) == 0 {
+		return nil, errors.New("password cannot be empty")
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("at least one database is required")
+	}
+	first := specs[0].Options
+	if first == nil {
+		first = &Options{}
+	}
+	for _, spec := range specs {
+		opts := spec.Options
+		if opts == nil {
+			opts = &Options{}
+		}
+		if err := checkPasswordStrength(password, opts); err != nil {
+			return nil, fmt.Errorf("%q: %w", spec.Filename, err)
+		}
+		if !bytes.Equal(opts.ExternalSalt, first.ExternalSalt) || !bytes.Equal(opts.Pepper, first.Pepper) {
+			return nil, fmt.Errorf("%q: databases of a group must share ExternalSalt and Pepper", spec.Filename)
+		}
+	}
+
+	group := &groupKey{}
+	defer group.destroy()
+	dbs := make([]*SecureBolt, 0, len(specs))
+	for _, spec := range specs {
+		s, err := open(spec.Filename, spec.Mode, spec.Options, group, func(db *bbolt.DB, salt []byte, isNewDB bool) ([]byte, error) {
+			if err := requireNotSplit(db); err != nil {
+				return nil, err
+			}
+			return append([]byte{}, password...), nil // open wipes the secret
+		})
+		if err != nil {
+			for _, opened := range dbs {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to open %q: %w", spec.Filename, err)
+		}
+		dbs = append(dbs, s)
+	}
+	return dbs, nil
+}
@@ -0,0 +1,93 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOpenGroup(t *testing.T) {
+	filenames := []string{"test_group_hot.db", "test_group_cold.db", "test_group_archive.db"}
+	password := "secure-test-password"
+	bucketName := []byte("Data")
+
+	var specs []DBSpec
+	for _, filename := range filenames {
+		defer os.Remove(filename)
+		specs = append(specs, DBSpec{Filename: filename, Mode: 0600})
+	}
+
+	dbs, err := OpenGroup([]byte(password), specs)
+	if err != nil {
+		t.Fatalf("Failed to open group: %v", err)
+	}
+	if dbs[0].OpenStats().KDFDuration == 0 {
+		t.Fatalf("Expected the first database to run the KDF")
+	}
+	for i, db := range dbs {
+		if i > 0 && db.OpenStats().KDFDuration != 0 {
+			t.Fatalf("Database %d ran the KDF again", i)
+		}
+		err := db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("file"), []byte(filenames[i]))
+		})
+		if err != nil {
+			t.Fatalf("Failed to write to database %d: %v", i, err)
+		}
+	}
+	for _, db := range dbs {
+		db.Close()
+	}
+
+	read := func(db *SecureBolt) string {
+		var value []byte
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			value, err = b.Get([]byte("file"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to read value: %v", err)
+		}
+		return string(value)
+	}
+
+	// A member opens on its own with the same password
+	db, err := Open(filenames[2], 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open a member on its own: %v", err)
+	}
+	if got := read(db); got != filenames[2] {
+		t.Fatalf("Member holds %q, expected %q", got, filenames[2])
+	}
+	db.Close()
+
+	dbs, err = OpenGroup([]byte(password), specs)
+	if err != nil {
+		t.Fatalf("Failed to reopen group: %v", err)
+	}
+	for i, db := range dbs {
+		if got := read(db); got != filenames[i] {
+			t.Fatalf("Database %d holds %q, expected %q", i, got, filenames[i])
+		}
+		db.Close()
+	}
+
+	// A database created on its own has another salt and cannot join
+	const stranger = "test_group_stranger.db"
+	defer os.Remove(stranger)
+	db, err = Open(stranger, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+	if _, err := OpenGroup([]byte(password), append(specs[:1:1], DBSpec{Filename: stranger, Mode: 0600})); err == nil {
+		t.Fatalf("Database with a different salt joined the group")
+	}
+}
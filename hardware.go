@@ -0,0 +1,42 @@
+package securebolt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"go.etcd.io/bbolt"
+)
+
+// HardwareKeySource is a hardware token, such as a YubiKey in HMAC-SHA1
+// challenge-response mode or a PIV/FIDO device, that answers a challenge with
+// a response derived from a secret that never leaves the device.
+type HardwareKeySource interface {
+	Challenge(ctx context.Context, challenge []byte) ([]byte, error)
+}
+
+// OpenWithHardware opens or creates the database at filename using a
+// hardware token instead of a password. The database salt is sent to the
+// token as the challenge and its response is used as the Argon2 input, so
+// nothing secret is stored on disk and the database can only be unlocked
+// with the token present. The response must be deterministic for a given
+// challenge, which rules out tokens producing randomized signatures.
+func OpenWithHardware(filename string, mode fs.FileMode, src HardwareKeySource) (*SecureBolt, error) {
+	if src == nil {
+		return nil, errors.New("hardware key source cannot be nil")
+	}
+	return open(filename, mode, nil, nil, func(db *bbolt.DB, salt []byte, isNewDB bool) ([]byte, error) {
+		if err := requireNotSplit(db); err != nil {
+			return nil, err
+		}
+		response, err := src.Challenge(context.Background(), append([]byte{}, salt...))
+		if err != nil {
+			return nil, fmt.Errorf("hardware challenge failed: %w", err)
+		}
+		if len(response) == 0 {
+			return nil, errors.New("hardware token returned an empty response")
+		}
+		return response, nil
+	})
+}
@@ -0,0 +1,73 @@
+package securebolt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// hmacToken emulates an HMAC-SHA1 challenge-response token.
+type hmacToken struct {
+	secret     []byte
+	challenges int
+}
+
+func (h *hmacToken) Challenge(ctx context.Context, challenge []byte) ([]byte, error) {
+	h.challenges++
+	mac := hmac.New(sha1.New, h.secret)
+	mac.Write(challenge)
+	return mac.Sum(nil), nil
+}
+
+func TestOpenWithHardware(t *testing.T) {
+	filename := "test_hardware.db"
+	bucketName := []byte("HardwareBucket")
+	token := &hmacToken{secret: []byte("token-secret")}
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithHardware(filename, 0600, token)
+	if err != nil {
+		t.Fatalf("Failed to open with hardware token: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	db.Close()
+
+	db, err = OpenWithHardware(filename, 0600, token)
+	if err != nil {
+		t.Fatalf("Failed to reopen with hardware token: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "value" {
+			return fmt.Errorf("value mismatch: got %q, expected %q", v, "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	if token.challenges != 2 {
+		t.Fatalf("Token was challenged %d times, expected 2", token.challenges)
+	}
+}
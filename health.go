@@ -0,0 +1,82 @@
+package securebolt
+
+import (
+	"bytes"
+	"math/rand/v2"
+
+	"go.etcd.io/bbolt"
+)
+
+// BucketHealth holds the SampleHealth results of one bucket.
+type BucketHealth struct {
+	Name     []byte // Bucket name
+	Keys     int    // Number of values in the bucket
+	Sampled  int    // Number of values decrypted
+	Failures int    // Number of sampled values that failed to decrypt
+}
+
+// HealthReport aggregates the results of SampleHealth.
+type HealthReport struct {
+	Sampled  int            // Number of values decrypted across all buckets
+	Failures int            // Number of sampled values that failed to decrypt
+	Buckets  []BucketHealth // Per-bucket results in key order
+}
+
+// FailureRate returns the fraction of sampled values that failed to decrypt,
+// or 0 when nothing was sampled.
+func (r HealthReport) FailureRate() float64 {
+	if r.Sampled == 0 {
+		return 0
+	}
+	return float64(r.Failures) / float64(r.Sampled)
+}
+
+// SampleHealth decrypts up to samplesPerBucket randomly chosen values of each
+// top-level bucket and reports how many failed. Buckets holding no more than
+// samplesPerBucket values are checked in full. Each bucket is scanned once
+// to pick the sample, but only the sampled values are decrypted, so the
+// check is cheap enough to run on a schedule as an early warning of
+// corruption. A decryption failure is counted rather than returned; the
+// error is only set when the scan itself fails.
+func (s *SecureBolt) SampleHealth(samplesPerBucket int) (HealthReport, error) {
+	var report HealthReport
+	err := s.View(func(tx *SecureTx) error {
+		return tx.tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if bytes.HasPrefix(name, reservedPrefix) {
+				return nil
+			}
+			h := tx.newBucket(name, b).sampleHealth(samplesPerBucket)
+			report.Sampled += h.Sampled
+			report.Failures += h.Failures
+			report.Buckets = append(report.Buckets, h)
+			return nil
+		})
+	})
+	if err != nil {
+		return HealthReport{}, err
+	}
+	return report, nil
+}
+
+// sampleHealth decrypts a uniform random sample of up to n values of the
+// bucket, chosen by reservoir sampling over a single cursor pass.
+func (sb *SecureBucket) sampleHealth(n int) BucketHealth {
+	h := BucketHealth{Name: append([]byte{}, sb.name...)}
+	var sample []KV
+	c := sb.bucket.Cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		h.Keys++
+		if len(sample) < n {
+			sample = append(sample, KV{Key: k, Value: v})
+		} else if i := rand.IntN(h.Keys); i < n {
+			sample[i] = KV{Key: k, Value: v}
+		}
+	}
+	for _, e := range sample {
+		h.Sampled++
+		if _, err := sb.openFull(e.Key, e.Value); err != nil {
+			h.Failures++
+		}
+	}
+	return h
+}
@@ -0,0 +1,83 @@
+package securebolt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestSampleHealth(t *testing.T) {
+	filename := "test_health.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket([]byte("Healthy"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 20; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		b, err = tx.CreateBucket([]byte("Damaged"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 20; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+
+		// Flip a ciphertext byte of one entry behind SecureBolt's back
+		raw := tx.Bolt().Bucket([]byte("Damaged"))
+		stored := append([]byte{}, raw.Get([]byte("key07"))...)
+		stored[len(stored)-1] ^= 1
+		return raw.Put([]byte("key07"), stored)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate buckets: %v", err)
+	}
+
+	// Sampling at least as many values as a bucket holds checks all of them
+	report, err := db.SampleHealth(50)
+	if err != nil {
+		t.Fatalf("Failed to sample health: %v", err)
+	}
+	if report.Sampled != 40 || report.Failures != 1 {
+		t.Fatalf("Expected 40 samples with 1 failure, got %d with %d", report.Sampled, report.Failures)
+	}
+	if len(report.Buckets) != 2 {
+		t.Fatalf("Expected 2 buckets in the report, got %d", len(report.Buckets))
+	}
+	for _, h := range report.Buckets {
+		want := 0
+		if string(h.Name) == "Damaged" {
+			want = 1
+		}
+		if h.Keys != 20 || h.Failures != want {
+			t.Fatalf("Bucket %q: expected 20 keys and %d failures, got %d and %d", h.Name, want, h.Keys, h.Failures)
+		}
+	}
+	if report.FailureRate() != 1.0/40 {
+		t.Fatalf("Unexpected failure rate %v", report.FailureRate())
+	}
+
+	// A smaller sample decrypts only the requested number of values
+	report, err = db.SampleHealth(5)
+	if err != nil {
+		t.Fatalf("Failed to sample health: %v", err)
+	}
+	if report.Sampled != 10 {
+		t.Fatalf("Expected 10 samples, got %d", report.Sampled)
+	}
+}
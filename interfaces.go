@@ -0,0 +1,80 @@
+package securebolt
+
+// Store, Tx and Bucket let code depend on the database through interfaces,
+// so tests can inject a fake instead of opening a real file. They cover the
+// core key-value operations; use the concrete types for everything else.
+var (
+	_ Store  = (*SecureBolt)(nil)
+	_ Tx     = storeTx{}
+	_ Bucket = (*SecureBucket)(nil)
+)
+
+// Store is the interface of a database, implemented by *SecureBolt.
+type Store interface {
+	// ViewTx runs fn in a read-only transaction, as View does.
+	ViewTx(fn func(tx Tx) error) error
+	// UpdateTx runs fn in a read-write transaction, as Update does.
+	UpdateTx(fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx is the interface of a transaction, as passed by Store methods.
+type Tx interface {
+	Bucket(name []byte) (Bucket, error)
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// Bucket is the interface of a bucket, implemented by *SecureBucket.
+type Bucket interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// ViewTx is View for callers using the Store interface.
+func (s *SecureBolt) ViewTx(fn func(tx Tx) error) error {
+	return s.View(func(tx *SecureTx) error {
+		return fn(storeTx{tx})
+	})
+}
+
+// UpdateTx is Update for callers using the Store interface.
+func (s *SecureBolt) UpdateTx(fn func(tx Tx) error) error {
+	return s.Update(func(tx *SecureTx) error {
+		return fn(storeTx{tx})
+	})
+}
+
+// storeTx adapts a *SecureTx to the Tx interface, whose methods return the
+// Bucket interface rather than *SecureBucket.
+type storeTx struct {
+	stx *SecureTx
+}
+
+func (t storeTx) Bucket(name []byte) (Bucket, error) {
+	return asBucket(t.stx.Bucket(name))
+}
+
+func (t storeTx) CreateBucket(name []byte) (Bucket, error) {
+	return asBucket(t.stx.CreateBucket(name))
+}
+
+func (t storeTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	return asBucket(t.stx.CreateBucketIfNotExists(name))
+}
+
+func (t storeTx) DeleteBucket(name []byte) error {
+	return t.stx.DeleteBucket(name)
+}
+
+// asBucket converts a bucket lookup result to the Bucket interface, keeping
+// a nil *SecureBucket a nil interface.
+func asBucket(sb *SecureBucket, err error) (Bucket, error) {
+	if sb == nil {
+		return nil, err
+	}
+	return sb, err
+}
@@ -0,0 +1,135 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// memStore is an in-memory Store for tests of code written against the
+// interfaces. It does not roll back failed updates.
+type memStore struct {
+	buckets map[string]memBucket
+}
+
+type memTx struct{ s *memStore }
+
+type memBucket map[string][]byte
+
+func (s *memStore) ViewTx(fn func(tx Tx) error) error   { return fn(memTx{s}) }
+func (s *memStore) UpdateTx(fn func(tx Tx) error) error { return fn(memTx{s}) }
+func (s *memStore) Close() error                        { return nil }
+
+func (t memTx) Bucket(name []byte) (Bucket, error) {
+	b, ok := t.s.buckets[string(name)]
+	if !ok {
+		return nil, errors.New("bucket not found")
+	}
+	return b, nil
+}
+
+func (t memTx) CreateBucket(name []byte) (Bucket, error) {
+	if _, ok := t.s.buckets[string(name)]; ok {
+		return nil, errors.New("bucket already exists")
+	}
+	return t.CreateBucketIfNotExists(name)
+}
+
+func (t memTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, ok := t.s.buckets[string(name)]
+	if !ok {
+		b = memBucket{}
+		t.s.buckets[string(name)] = b
+	}
+	return b, nil
+}
+
+func (t memTx) DeleteBucket(name []byte) error {
+	delete(t.s.buckets, string(name))
+	return nil
+}
+
+func (b memBucket) Get(key []byte) ([]byte, error) { return b[string(key)], nil }
+func (b memBucket) Put(key, value []byte) error {
+	b[string(key)] = append([]byte{}, value...)
+	return nil
+}
+func (b memBucket) Delete(key []byte) error { delete(b, string(key)); return nil }
+
+func (b memBucket) ForEach(fn func(k, v []byte) error) error {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), b[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incrementVisits is application code that only depends on Store.
+func incrementVisits(store Store, page string) (int, error) {
+	var visits int
+	err := store.UpdateTx(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("visits"))
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte(page))
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			if visits, err = strconv.Atoi(string(v)); err != nil {
+				return err
+			}
+		}
+		visits++
+		return b.Put([]byte(page), []byte(strconv.Itoa(visits)))
+	})
+	return visits, err
+}
+
+func TestStoreInterface(t *testing.T) {
+	filename := "test_interfaces.db"
+	password := "secure-test-password"
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for name, store := range map[string]Store{"fake": &memStore{buckets: map[string]memBucket{}}, "db": db} {
+		for want := 1; want <= 3; want++ {
+			got, err := incrementVisits(store, "/home")
+			if err != nil {
+				t.Fatalf("%s: Failed to increment visits: %v", name, err)
+			}
+			if got != want {
+				t.Fatalf("%s: Expected %d visits, got %d", name, want, got)
+			}
+		}
+		err := store.ViewTx(func(tx Tx) error {
+			b, err := tx.Bucket([]byte("visits"))
+			if err != nil {
+				return err
+			}
+			return b.ForEach(func(k, v []byte) error {
+				if string(k) != "/home" || string(v) != "3" {
+					t.Errorf("%s: Unexpected entry %q=%q", name, k, v)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("%s: Failed to read visits: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package securebolt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/awnumar/memcall"
+	"github.com/awnumar/memguard"
+)
+
+// Argon2id parameters used by deriveKey.
+const (
+	kdfTime      = 3          // Number of passes
+	kdfMemory    = 128 * 1024 // Memory cost in KiB
+	kdfThreads   = 4          // Degree of parallelism
+	kdfKeyLength = 32         // Derived key length in bytes
+)
+
+// OpenStats describes how the encryption key was derived when the database
+// was opened, for auditing and for tuning the Argon2 cost to a host.
+type OpenStats struct {
+	KDFDuration  time.Duration // Time spent deriving the key
+	KDFTime      uint32        // Argon2id passes
+	KDFMemoryKiB uint32        // Argon2id memory cost
+	KDFThreads   uint8         // Argon2id parallelism
+	KeyLength    int           // Derived key length in bytes
+	KeyLocked    bool          // Key pages locked against swapping, as checked by Open
+}
+
+// OpenStats returns the key derivation statistics recorded by Open.
+func (s *SecureBolt) OpenStats() OpenStats {
+	return s.stats
+}
+
+// kdfStats builds the OpenStats of a key derived in d. KeyLocked is the
+// result of locking the key's pages again with mlock, or VirtualLock on
+// Windows, rather than an assumption about how memguard allocated them;
+// locking pages that are already locked succeeds and changes nothing.
+func kdfStats(d time.Duration, keyLock *memguard.LockedBuffer) OpenStats {
+	return OpenStats{
+		KDFDuration:  d,
+		KDFTime:      kdfTime,
+		KDFMemoryKiB: kdfMemory,
+		KDFThreads:   kdfThreads,
+		KeyLength:    kdfKeyLength,
+		KeyLocked:    keyLock.IsAlive() && memcall.Lock(keyLock.Bytes()) == nil,
+	}
+}
+
+// pepperSecret mixes an Options.Pepper into the Argon2 input as
+// HMAC-SHA256(pepper, secret).
+func pepperSecret(secret, pepper []byte) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// Files the memory available to Argon2 is read from. They are variables so
+// tests can point them at fixtures.
+var (
+	meminfoPath             = "/proc/meminfo"
+	cgroupMemoryMaxPath     = "/sys/fs/cgroup/memory.max"
+	cgroupMemoryCurrentPath = "/sys/fs/cgroup/memory.current"
+)
+
+// checkKDFResources reports ErrKDFResourcesUnavailable when the host clearly
+// cannot allocate memoryKiB for Argon2. Argon2id is memory-hard by design: the
+// full memory cost is allocated for the duration of the derivation and
+// cannot be streamed, so a host below that limit can never open the database.
+// When available memory cannot be determined the check is skipped.
+func checkKDFResources(memoryKiB uint32) error {
+	available, ok := availableMemoryKiB()
+	if !ok || available >= uint64(memoryKiB) {
+		return nil
+	}
+	return fmt.Errorf("%w: argon2 requires %d KiB but only %d KiB is available; "+
+		"open the database on a host or in a container with more memory",
+		ErrKDFResourcesUnavailable, memoryKiB, available)
+}
+
+// availableMemoryKiB returns the memory available for new allocations: the
+// MemAvailable reported by /proc/meminfo, lowered to the headroom left under
+// the cgroup v2 memory limit when the process runs under one, as in most
+// containers, where allocating past the limit gets the process killed rather
+// than failing. It returns false when neither can be read.
+func availableMemoryKiB() (uint64, bool) {
+	available, ok := memAvailableKiB()
+	if limit, limited := cgroupHeadroomKiB(); limited && (!ok || limit < available) {
+		return limit, true
+	}
+	return available, ok
+}
+
+// memAvailableKiB returns MemAvailable from /proc/meminfo, and false on
+// systems without it.
+func memAvailableKiB() (uint64, bool) {
+	data, err := os.ReadFile(meminfoPath)
+	if err != nil {
+		return 0, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) < 2 || string(fields[0]) != "MemAvailable:" {
+			continue
+		}
+		n, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// cgroupHeadroomKiB returns how much memory the cgroup v2 memory limit still
+// allows, and false when there is no limit or it cannot be read.
+func cgroupHeadroomKiB() (uint64, bool) {
+	data, err := os.ReadFile(cgroupMemoryMaxPath)
+	if err != nil {
+		return 0, false
+	}
+	limit, err := strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return 0, false // "max" when unlimited
+	}
+	var used uint64
+	if data, err := os.ReadFile(cgroupMemoryCurrentPath); err == nil {
+		used, _ = strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+	}
+	if used >= limit {
+		return 0, true
+	}
+	return (limit - used) / 1024, true
+}
@@ -0,0 +1,66 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setMemoryFiles points the files checkKDFResources reads at fixtures in a
+// temporary directory, skipping those whose content is empty, and restores
+// the real paths when the test ends.
+func setMemoryFiles(t *testing.T, meminfo, memoryMax, memoryCurrent string) {
+	t.Helper()
+	saved := [3]string{meminfoPath, cgroupMemoryMaxPath, cgroupMemoryCurrentPath}
+	t.Cleanup(func() {
+		meminfoPath, cgroupMemoryMaxPath, cgroupMemoryCurrentPath = saved[0], saved[1], saved[2]
+	})
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if content == "" {
+			return path // Missing file
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	meminfoPath = write("meminfo", meminfo)
+	cgroupMemoryMaxPath = write("memory.max", memoryMax)
+	cgroupMemoryCurrentPath = write("memory.current", memoryCurrent)
+}
+
+func TestCheckKDFResources(t *testing.T) {
+	const meminfo = "MemTotal:       16384000 kB\nMemFree:         1000000 kB\nMemAvailable:    8192000 kB\n"
+	tests := []struct {
+		name          string
+		meminfo       string
+		memoryMax     string
+		memoryCurrent string
+		wantErr       bool
+	}{
+		{name: "ample memory", meminfo: meminfo},
+		{name: "low MemAvailable", meminfo: "MemAvailable:      65536 kB\n", wantErr: true},
+		{name: "unlimited cgroup", meminfo: meminfo, memoryMax: "max\n"},
+		{name: "cgroup limit below requirement", meminfo: meminfo, memoryMax: "67108864\n", wantErr: true},
+		{name: "cgroup limit mostly used", meminfo: meminfo, memoryMax: "536870912\n", memoryCurrent: "500000000\n", wantErr: true},
+		{name: "cgroup limit with headroom", meminfo: meminfo, memoryMax: "1073741824\n", memoryCurrent: "104857600\n"},
+		{name: "cgroup limit without meminfo", memoryMax: "67108864\n", wantErr: true},
+		{name: "nothing readable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMemoryFiles(t, tt.meminfo, tt.memoryMax, tt.memoryCurrent)
+			err := checkKDFResources(kdfMemory)
+			if tt.wantErr && !errors.Is(err, ErrKDFResourcesUnavailable) {
+				t.Fatalf("Expected ErrKDFResourcesUnavailable, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package securebolt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/awnumar/memguard"
+	"go.etcd.io/bbolt"
+)
+
+// keyMaterialSubkeyInfo is the HKDF info of the key that authenticates
+// exported key material.
+const keyMaterialSubkeyInfo = "securebolt key material"
+
+// keyMaterialVersion is the first byte of blobs produced by ExportKeyMaterial.
+const keyMaterialVersion = 1
+
+// ExportKeyMaterial returns a small portable blob holding everything in the
+// securebolt_meta bucket, such as the salt and the format settings, along
+// with the Argon2 parameters, so that access can be restored with
+// RestoreKeyMaterial if the metadata is lost or damaged. The blob is
+// authenticated under a key derived from the database key but not
+// encrypted; the salt it contains is not secret on its own, but store the
+// blob apart from the password. There is no separately wrapped data key in
+// this design: the key is always derived from the password and the salt.
+func (s *SecureBolt) ExportKeyMaterial() ([]byte, error) {
+	blob := []byte{keyMaterialVersion}
+	blob = binary.AppendUvarint(blob, kdfTime)
+	blob = binary.AppendUvarint(blob, kdfMemory)
+	blob = binary.AppendUvarint(blob, kdfThreads)
+	blob = binary.AppendUvarint(blob, kdfKeyLength)
+
+	var mac []byte
+	err := s.View(func(tx *SecureTx) error {
+		var entries [][]byte
+		if b := tx.tx.Bucket(metaBucket); b != nil {
+			err := b.ForEach(func(k, v []byte) error {
+				entries = append(entries, k, v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		blob = binary.AppendUvarint(blob, uint64(len(entries)/2))
+		for _, field := range entries {
+			blob = binary.AppendUvarint(blob, uint64(len(field)))
+			blob = append(blob, field...)
+		}
+		var err error
+		mac, err = keyMaterialMAC(s.keys(), blob)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, mac...), nil
+}
+
+// RestoreKeyMaterial replaces the securebolt_meta bucket of the database file
+// at filename with the contents of a blob produced by ExportKeyMaterial, so
+// that the file opens again after its metadata was lost or damaged. It works
+// on the file directly, as Open cannot open a database without its
+// metadata, so the database must not be open; it waits for the file lock
+// like Open without a Timeout. password must be the one the key was derived
+// from: the key is derived again, before the file is opened, and must
+// authenticate the blob. Databases whose key does not come from a single
+// password, such as those opened with a Pepper, an ExternalSalt, a hardware
+// token or OpenSplit, cannot be restored this way.
+//
+// It returns ErrInvalidKeyMaterial when the blob was altered or belongs to
+// another database, when the password does not match, or when the blob was
+// exported before the latest key rotation, since its key generation would
+// leave the values sealed under later key-ids unreadable. The password is
+// wiped.
+func RestoreKeyMaterial(filename string, blob []byte, password []byte) error {
+	defer memguard.WipeBytes(password) // Securely erase the password
+	if len(blob) < 1+sha256.Size || blob[0] != keyMaterialVersion {
+		return ErrInvalidKeyMaterial
+	}
+	body, mac := blob[:len(blob)-sha256.Size], blob[len(blob)-sha256.Size:]
+	entries, err := parseKeyMaterial(body[1:])
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[string(splitCountKey)]; ok {
+		return errors.New("split knowledge databases cannot be restored with a password")
+	}
+	salt, ok := entries[string(saltKey)]
+	if !ok {
+		return errors.New("databases without a stored salt cannot be restored with a password")
+	}
+	generation, err := restoredKeyGeneration(entries)
+	if err != nil {
+		return err
+	}
+
+	keyLock, err := deriveKey(password, salt)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer keyLock.Destroy()
+	want, err := keyMaterialMAC(&keyMaterial{keyLock: keyLock, salt: salt}, body)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, want) {
+		return fmt.Errorf("%w: the blob was altered or the password does not match the database key", ErrInvalidKeyMaterial)
+	}
+	root, err := restoredCipher(keyLock, entries)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+	db, err := bbolt.Open(filename, 0600, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open BoltDB: %w", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if err := checkKeyGeneration(tx, root, generation); err != nil {
+			return err
+		}
+		if tx.Bucket(metaBucket) != nil {
+			if err := tx.DeleteBucket(metaBucket); err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		for k, v := range entries {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// restoredKeyGeneration returns the key generation recorded in restored
+// metadata entries.
+func restoredKeyGeneration(entries map[string][]byte) (uint64, error) {
+	v, ok := entries[string(keyGenerationKey)]
+	if !ok {
+		return rootKeyID, nil
+	}
+	generation, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, ErrInvalidKeyMaterial
+	}
+	return generation, nil
+}
+
+// restoredCipher returns the cipher of the root key of a database whose
+// metadata holds entries, bound to its database ID if it has one.
+func restoredCipher(keyLock *memguard.LockedBuffer, entries map[string][]byte) (cipher.AEAD, error) {
+	var tagSize int
+	if v, ok := entries[string(tagSizeKey)]; ok {
+		var err error
+		if tagSize, err = strconv.Atoi(string(v)); err != nil {
+			return nil, ErrInvalidKeyMaterial
+		}
+	}
+	aead, err := newAEADWithTagSize(keyLock.Bytes(), tagSize)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := entries[string(databaseIDKey)]; ok {
+		prefix := binary.AppendUvarint(nil, uint64(len(id)))
+		aead = idAEAD{AEAD: aead, prefix: append(prefix, id...)}
+	}
+	return aead, nil
+}
+
+// checkKeyGeneration refuses to restore key generation over a database that
+// was rotated past it: one whose remaining metadata records a later
+// generation, or that holds an envelope sealed under a later key-id. A legacy
+// value whose random nonce happens to look like such an envelope is
+// recognized by opening it under the root cipher.
+func checkKeyGeneration(tx *bbolt.Tx, root cipher.AEAD, generation uint64) error {
+	if b := tx.Bucket(metaBucket); b != nil {
+		if v := b.Get(keyGenerationKey); v != nil {
+			if current, n := binary.Uvarint(v); n > 0 && current > generation {
+				return fmt.Errorf("%w: it was exported before the key was rotated to key-id %d", ErrInvalidKeyMaterial, current)
+			}
+		}
+	}
+	var visit func(b *bbolt.Bucket) error
+	visit = func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return visit(b.Bucket(k))
+			}
+			h, _, _, _, ok := parseEnvelope(v, root.NonceSize())
+			if !ok || h.keyID <= generation {
+				return nil
+			}
+			if _, err := openLegacy(nil, v, root); err == nil {
+				return nil
+			}
+			return fmt.Errorf("%w: it was exported before the key was rotated to key-id %d", ErrInvalidKeyMaterial, h.keyID)
+		})
+	}
+	return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		if bytes.Equal(name, metaBucket) {
+			return nil
+		}
+		return visit(b)
+	})
+}
+
+// keyMaterialMAC authenticates an exported key material blob.
+func keyMaterialMAC(km *keyMaterial, blob []byte) ([]byte, error) {
+	keyLock, err := km.deriveSubkey(keyMaterialSubkeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+	h := hmac.New(sha256.New, keyLock.Bytes())
+	h.Write(blob)
+	return h.Sum(nil), nil
+}
+
+// parseKeyMaterial decodes the body of a key material blob after its
+// version byte, checking that its Argon2 parameters are the ones in use.
+func parseKeyMaterial(data []byte) (map[string][]byte, error) {
+	readUvarint := func() (uint64, error) {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			return 0, ErrInvalidKeyMaterial
+		}
+		data = data[size:]
+		return n, nil
+	}
+	readField := func() ([]byte, error) {
+		n, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(data)) {
+			return nil, ErrInvalidKeyMaterial
+		}
+		field := data[:n:n]
+		data = data[n:]
+		return field, nil
+	}
+
+	for _, want := range []uint64{kdfTime, kdfMemory, kdfThreads, kdfKeyLength} {
+		got, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, errors.New("key material uses unsupported KDF parameters")
+		}
+	}
+	count, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string][]byte)
+	for i := uint64(0); i < count; i++ {
+		k, err := readField()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readField()
+		if err != nil {
+			return nil, err
+		}
+		entries[string(k)] = v
+	}
+	if len(data) != 0 {
+		return nil, ErrInvalidKeyMaterial
+	}
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// dropMetadata deletes the securebolt_meta bucket of a closed database file.
+func dropMetadata(t *testing.T, filename string) {
+	t.Helper()
+	db, err := bbolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open BoltDB: %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(metaBucket)
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete metadata: %v", err)
+	}
+}
+
+func TestRestoreKeyMaterial(t *testing.T) {
+	filename := "test_key_material.db"
+	password := "secure-test-password"
+	bucketName := []byte("Vault")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{InsertionOrder: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	blob, err := db.ExportKeyMaterial()
+	if err != nil {
+		t.Fatalf("Failed to export key material: %v", err)
+	}
+	db.Close()
+
+	// Lose the metadata bucket, after which the database no longer opens
+	dropMetadata(t, filename)
+	if db, err := Open(filename, 0600, []byte(password)); err == nil {
+		db.Close()
+		t.Fatalf("Expected Open to fail without metadata")
+	}
+
+	tampered := append([]byte{}, blob...)
+	tampered[len(tampered)/2] ^= 1
+	if err := RestoreKeyMaterial(filename, tampered, []byte(password)); !errors.Is(err, ErrInvalidKeyMaterial) {
+		t.Fatalf("Expected ErrInvalidKeyMaterial for a tampered blob, got %v", err)
+	}
+	if err := RestoreKeyMaterial(filename, blob, []byte("wrong-password")); !errors.Is(err, ErrInvalidKeyMaterial) {
+		t.Fatalf("Expected ErrInvalidKeyMaterial for a wrong password, got %v", err)
+	}
+	if err := RestoreKeyMaterial(filename, blob, []byte(password)); err != nil {
+		t.Fatalf("Failed to restore key material: %v", err)
+	}
+
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen after restore: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "value" {
+			t.Fatalf("Read %q after restore, expected %q", v, "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read after restore: %v", err)
+	}
+}
+
+func TestRestoreKeyMaterialAfterRotation(t *testing.T) {
+	filename := "test_key_material_rotation.db"
+	password := "secure-test-password"
+	bucketName := []byte("Vault")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{MaxBytesPerKey: 100, AutoRotateOnLimit: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	blob, err := db.ExportKeyMaterial()
+	if err != nil {
+		t.Fatalf("Failed to export key material: %v", err)
+	}
+
+	// Write enough to rotate the key at least once
+	for i := 0; i < 4; i++ {
+		err = db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte("v"), 40))
+		})
+		if err != nil {
+			t.Fatalf("Failed to put value: %v", err)
+		}
+	}
+	stats, err := db.KeyRingStatus()
+	if err != nil {
+		t.Fatalf("Failed to get key ring status: %v", err)
+	}
+	if stats[len(stats)-1].KeyID == rootKeyID {
+		t.Fatalf("Expected the key to rotate, got %+v", stats)
+	}
+	db.Close()
+
+	// The blob predates the rotation: restoring it would strand the values
+	// sealed under the later key-ids
+	dropMetadata(t, filename)
+	if err := RestoreKeyMaterial(filename, blob, []byte(password)); !errors.Is(err, ErrInvalidKeyMaterial) {
+		t.Fatalf("Expected ErrInvalidKeyMaterial for a blob exported before a rotation, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package securebolt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// keyGenerationKey is the securebolt_meta entry holding the key-id new values
+// are sealed under, once the key has been rotated.
+var keyGenerationKey = []byte("key_generation")
+
+// dataKeySubkeyInfo is the HKDF info, followed by the key-id, of the keys
+// that replace the root key when it is rotated.
+const dataKeySubkeyInfo = "securebolt data key"
+
+// keyRing is the cipher of a database. It seals with the key of keyID and
+// opens envelopes with the key of the key-id in their header, so values
+// written before a rotation stay readable. Key-id rootKeyID is the
+// password-derived key itself; every later key-id is a subkey of it.
+type keyRing struct {
+	cipher.AEAD // Cipher of keyID
+	keyID       uint64
+	keys        *ringCiphers // Shared by every keyRing of the database
+}
+
+// ringCiphers caches the ciphers of the key-ids in use.
+type ringCiphers struct {
+	mu      sync.Mutex
+	ciphers map[uint64]cipher.AEAD
+	derive  func(keyID uint64) (cipher.AEAD, error)
+}
+
+// newKeyRing returns the key ring of db, whose root key has the cipher root,
+// sealing under the key-id recorded in the securebolt_meta bucket. Ciphers of
+// later key-ids are derived from km and wrapped with the database ID prefix
+// of root, if any.
+func newKeyRing(db *bbolt.DB, km *keyMaterial, root cipher.AEAD, tagSize int) (*keyRing, error) {
+	var prefix []byte
+	if id, ok := root.(idAEAD); ok {
+		prefix = id.prefix
+	}
+	keys := &ringCiphers{
+		ciphers: map[uint64]cipher.AEAD{rootKeyID: root},
+		derive: func(keyID uint64) (cipher.AEAD, error) {
+			keyLock, err := km.deriveSubkey(fmt.Sprintf("%s %d", dataKeySubkeyInfo, keyID))
+			if err != nil {
+				return nil, err
+			}
+			defer keyLock.Destroy()
+			aead, err := newAEADWithTagSize(keyLock.Bytes(), tagSize)
+			if err != nil {
+				return nil, err
+			}
+			if prefix != nil {
+				aead = idAEAD{AEAD: aead, prefix: prefix}
+			}
+			return aead, nil
+		},
+	}
+
+	var keyID uint64
+	err := db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(metaBucket); b != nil {
+			if v := b.Get(keyGenerationKey); v != nil {
+				var n int
+				if keyID, n = binary.Uvarint(v); n <= 0 {
+					return fmt.Errorf("invalid key generation %x", v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key generation: %w", err)
+	}
+	return keys.ring(keyID)
+}
+
+// ring returns the key ring sealing under keyID.
+func (r *ringCiphers) ring(keyID uint64) (*keyRing, error) {
+	aead, err := r.cipher(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return &keyRing{AEAD: aead, keyID: keyID, keys: r}, nil
+}
+
+// cipher returns the cipher of keyID, deriving it on first use.
+func (r *ringCiphers) cipher(keyID uint64) (cipher.AEAD, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if aead, ok := r.ciphers[keyID]; ok {
+		return aead, nil
+	}
+	aead, err := r.derive(keyID)
+	if err != nil {
+		return nil, err
+	}
+	r.ciphers[keyID] = aead
+	return aead, nil
+}
+
+// keyIDOf returns the key-id of the key aead seals under.
+func keyIDOf(aead cipher.AEAD) uint64 {
+	if r, ok := aead.(*keyRing); ok {
+		return r.keyID
+	}
+	return rootKeyID
+}
+
+// cipherFor returns the cipher that opens envelopes carrying keyID. A key
+// ring knows every key-id up to the one it seals under; later ones were
+// never written.
+func cipherFor(aead cipher.AEAD, keyID uint64) (cipher.AEAD, error) {
+	r, ok := aead.(*keyRing)
+	if !ok {
+		if keyID != rootKeyID {
+			return nil, fmt.Errorf("unknown key id %d", keyID)
+		}
+		return aead, nil
+	}
+	if keyID == r.keyID {
+		return r.AEAD, nil
+	}
+	if keyID > r.keyID {
+		return nil, fmt.Errorf("unknown key id %d", keyID)
+	}
+	return r.keys.cipher(keyID)
+}
+
+// KeyStat is the number of stored values encrypted under one key-id.
+type KeyStat struct {
+	KeyID   uint64
+	Values  int
+	Primary bool // The key-id new values are written with
+}
+
+// KeyRingStatus tallies the encrypted values of the database by the key-id
+// recorded in their envelope header, without decrypting anything. It covers
+// the same values as RefreshNonces: the user buckets, large values in the
+// external bucket and the internal configuration buckets. The result is
+// sorted by key-id and lists every key-id in use, plus the primary one even
+// when no value uses it yet.
+//
+// Once the primary key-id accounts for every value, key rotation has
+// converged and older keys are no longer referenced. Values in the legacy
+// layout carry no key-id; they were written under the root key, key-id 0,
+// and are counted towards it.
+func (s *SecureBolt) KeyRingStatus() ([]KeyStat, error) {
+	var primary uint64
+	counts := make(map[uint64]int)
+	err := s.View(func(tx *SecureTx) error {
+		primary = keyIDOf(tx.aead)
+		counts[primary] = 0
+		names, err := tx.encryptedBucketNames()
+		if err != nil {
+			return err
+		}
+		nonceSize := tx.aead.NonceSize()
+		for _, name := range names {
+			c := tx.tx.Bucket(name).Cursor()
+			for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+				keyID := uint64(rootKeyID)
+				if h, _, _, _, ok := parseEnvelope(v, nonceSize); ok {
+					keyID = h.keyID
+				}
+				counts[keyID]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]KeyStat, 0, len(counts))
+	for keyID, n := range counts {
+		stats = append(stats, KeyStat{KeyID: keyID, Values: n, Primary: keyID == primary})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].KeyID < stats[j].KeyID })
+	return stats, nil
+}
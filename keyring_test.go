@@ -0,0 +1,58 @@
+package securebolt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestKeyRingStatus(t *testing.T) {
+	filename := "test_keyring.db"
+	password := "secure-test-password"
+	bucketName := []byte("Data")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		// An envelope written under another key-id
+		header := []byte{envelopeVersion, 0, 7}
+		nonce := make([]byte, tx.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		stored := append(append(header, nonce...), tx.aead.Seal(nil, nonce, []byte("old"), header)...)
+		return tx.Bolt().Bucket(bucketName).Put([]byte("rotated"), stored)
+	})
+	if err != nil {
+		t.Fatalf("Failed to write values: %v", err)
+	}
+
+	stats, err := db.KeyRingStatus()
+	if err != nil {
+		t.Fatalf("Failed to get key ring status: %v", err)
+	}
+	// The three values and the settings record of the bucket
+	want := []KeyStat{
+		{KeyID: rootKeyID, Values: 4, Primary: true},
+		{KeyID: 7, Values: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("Expected %+v, got %+v", want, stats)
+	}
+}
@@ -0,0 +1,79 @@
+package securebolt
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Uint64Key encodes n as an 8-byte big-endian key. Keys produced this way sort
+// in numeric order, unlike decimal strings where "10" sorts before "2".
+func Uint64Key(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+// ParseUint64Key decodes a key produced by Uint64Key.
+func ParseUint64Key(key []byte) (uint64, error) {
+	if len(key) != 8 {
+		return 0, fmt.Errorf("invalid uint64 key length %d, expected 8", len(key))
+	}
+	return binary.BigEndian.Uint64(key), nil
+}
+
+// Int64Key encodes n as an 8-byte key that sorts in numeric order, with
+// negative numbers before positive ones. The sign bit is flipped so that the
+// big-endian byte order matches signed integer order.
+func Int64Key(n int64) []byte {
+	return Uint64Key(uint64(n) ^ (1 << 63))
+}
+
+// ParseInt64Key decodes a key produced by Int64Key.
+func ParseInt64Key(key []byte) (int64, error) {
+	n, err := ParseUint64Key(key)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n ^ (1 << 63)), nil
+}
+
+// compositeLengthSize is the size of the length prefix of each composite key part.
+const compositeLengthSize = 4
+
+// CompositeKey joins parts into a single key, prefixing each part with its
+// 4-byte big-endian length. Unlike joining with a separator byte, the
+// encoding stays unambiguous whatever bytes the parts contain. Keys that
+// share leading parts sort by their next part, so fixed-width parts such as
+// Uint64Key or Int64Key timestamps sort in numeric order within a common
+// prefix; variable-length parts sort by length before content.
+func CompositeKey(parts ...[]byte) []byte {
+	size := 0
+	for _, p := range parts {
+		size += compositeLengthSize + len(p)
+	}
+	key := make([]byte, 0, size)
+	for _, p := range parts {
+		key = binary.BigEndian.AppendUint32(key, uint32(len(p)))
+		key = append(key, p...)
+	}
+	return key
+}
+
+// SplitCompositeKey returns the parts of a key produced by CompositeKey. It
+// returns nil when k is not a valid composite key. The parts alias k.
+func SplitCompositeKey(k []byte) [][]byte {
+	var parts [][]byte
+	for len(k) > 0 {
+		if len(k) < compositeLengthSize {
+			return nil
+		}
+		n := binary.BigEndian.Uint32(k)
+		k = k[compositeLengthSize:]
+		if uint64(n) > uint64(len(k)) {
+			return nil
+		}
+		parts = append(parts, k[:n:n])
+		k = k[n:]
+	}
+	return parts
+}
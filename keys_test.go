@@ -0,0 +1,253 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestUint64KeyOrdering(t *testing.T) {
+	filename := "test_uint64_keys.db"
+	password := "secure-test-password"
+	bucketName := []byte("NumericBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		// Insert in reverse to make sure ordering comes from the key encoding
+		for n := uint64(20); n >= 1; n-- {
+			if err := b.Put(Uint64Key(n), []byte(fmt.Sprintf("value-%d", n))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		expected := uint64(1)
+		c := b.Cursor()
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			n, err := ParseUint64Key(k)
+			if err != nil {
+				return err
+			}
+			if n != expected {
+				return fmt.Errorf("out of order key: got %d, expected %d", n, expected)
+			}
+			if !bytes.Equal(v, []byte(fmt.Sprintf("value-%d", n))) {
+				return fmt.Errorf("value mismatch for key %d: got %s", n, v)
+			}
+			expected++
+		}
+		if expected != 21 {
+			return fmt.Errorf("iterated %d keys, expected 20", expected-1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Cursor iteration failed: %v", err)
+	}
+}
+
+func TestInt64KeyOrdering(t *testing.T) {
+	values := []int64{-1 << 63, -1000, -1, 0, 1, 1000, 1<<63 - 1}
+	for i := 1; i < len(values); i++ {
+		if bytes.Compare(Int64Key(values[i-1]), Int64Key(values[i])) >= 0 {
+			t.Fatalf("Int64Key(%d) does not sort before Int64Key(%d)", values[i-1], values[i])
+		}
+	}
+	for _, n := range values {
+		got, err := ParseInt64Key(Int64Key(n))
+		if err != nil {
+			t.Fatalf("Failed to parse key for %d: %v", n, err)
+		}
+		if got != n {
+			t.Fatalf("Round-trip mismatch: got %d, expected %d", got, n)
+		}
+	}
+	if _, err := ParseUint64Key([]byte("short")); err == nil {
+		t.Fatalf("Expected error for short key")
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	filename := "test_composite_keys.db"
+	password := "secure-test-password"
+	bucketName := []byte("CompositeBucket")
+
+	defer os.Remove(filename)
+
+	// A separator byte inside a part must not confuse the encoding
+	parts := [][]byte{[]byte("us\x00east"), Int64Key(-5), {}}
+	split := SplitCompositeKey(CompositeKey(parts...))
+	if len(split) != len(parts) {
+		t.Fatalf("Split returned %d parts, expected %d", len(split), len(parts))
+	}
+	for i := range parts {
+		if !bytes.Equal(split[i], parts[i]) {
+			t.Fatalf("Part %d: got %q, expected %q", i, split[i], parts[i])
+		}
+	}
+	if SplitCompositeKey([]byte{0, 0, 0, 9, 'x'}) != nil {
+		t.Fatalf("Expected nil for a truncated composite key")
+	}
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, region := range []string{"us", "usa", "eu"} {
+			for _, ts := range []int64{30, -10, 20} {
+				value := []byte(fmt.Sprintf("%s@%d", region, ts))
+				if err := b.Put(CompositeKey([]byte(region), Int64Key(ts)), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		entries, err := b.ScanComposite([]byte("us"))
+		if err != nil {
+			return err
+		}
+		expected := []string{"us@-10", "us@20", "us@30"}
+		if len(entries) != len(expected) {
+			t.Fatalf("Got %d entries, expected %d", len(entries), len(expected))
+		}
+		for i, e := range entries {
+			if string(e.Value) != expected[i] {
+				t.Fatalf("Entry %d: got %q, expected %q", i, e.Value, expected[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan composite keys: %v", err)
+	}
+}
+
+func TestBinaryKeys(t *testing.T) {
+	filename := "test_binary_keys.db"
+	password := "secure-test-password"
+	bucketName := []byte("Binary\x00Bucket")
+
+	defer os.Remove(filename)
+
+	// Keys that collide if truncated at a null byte or decoded as text
+	keys := [][]byte{
+		{0x00},
+		{0x00, 0x00},
+		[]byte("a\x00b"),
+		[]byte("a\x00c"),
+		[]byte("a"),
+		{0xff, 0xfe, 0x80},
+		{0xc3, 0x28}, // Invalid UTF-8
+	}
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			if err := b.Put(k, []byte(fmt.Sprintf("value-%d", i))); err != nil {
+				return err
+			}
+		}
+		return b.Put(CompositeKey([]byte("a\x00"), []byte{0xff}), []byte("composite"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put binary keys: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			v, err := b.Get(k)
+			if err != nil {
+				return err
+			}
+			if want := fmt.Sprintf("value-%d", i); string(v) != want {
+				t.Fatalf("Get(%q) = %q, expected %q", k, v, want)
+			}
+		}
+
+		// Seek lands exactly on a key containing a null byte
+		k, v, err := b.Cursor().Seek([]byte("a\x00"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(k, []byte("a\x00b")) || string(v) != "value-2" {
+			t.Fatalf("Seek returned %q=%q, expected \"a\\x00b\"", k, v)
+		}
+
+		entries, err := b.ScanComposite([]byte("a\x00"))
+		if err != nil {
+			return err
+		}
+		if len(entries) != 1 || string(entries[0].Value) != "composite" {
+			t.Fatalf("ScanComposite returned %d entries", len(entries))
+		}
+
+		// Deleting one key leaves its null-extended neighbor alone
+		if err := b.Delete([]byte{0x00}); err != nil {
+			return err
+		}
+		if v, err := b.Get([]byte{0x00, 0x00}); err != nil || string(v) != "value-1" {
+			t.Fatalf("Neighbor of deleted key changed: %q, %v", v, err)
+		}
+		if v, err := b.Get([]byte{0x00}); err != nil || v != nil {
+			t.Fatalf("Deleted key still present: %q, %v", v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read binary keys: %v", err)
+	}
+}
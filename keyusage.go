@@ -0,0 +1,63 @@
+package securebolt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// keyUsageKey is the securebolt_meta entry counting the bytes sealed under
+// the current key, maintained when Options.MaxBytesPerKey is set.
+var keyUsageKey = []byte("key_usage")
+
+// chargeKeyUsage adds n bytes about to be sealed under the current key to
+// the usage counter. Past Options.MaxBytesPerKey it returns
+// ErrKeyUsageExceeded, or marks the transaction to rotate the key when it
+// commits with Options.AutoRotateOnLimit.
+func (stx *SecureTx) chargeKeyUsage(n int) error {
+	limit := stx.db.opts.MaxBytesPerKey
+	if limit <= 0 {
+		return nil
+	}
+	b, err := stx.tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	var used uint64
+	if v := b.Get(keyUsageKey); len(v) == 8 {
+		used = binary.BigEndian.Uint64(v)
+	}
+	used += uint64(n)
+	if used > uint64(limit) {
+		if !stx.db.opts.AutoRotateOnLimit {
+			return fmt.Errorf("%w: %d of %d bytes", ErrKeyUsageExceeded, used, limit)
+		}
+		stx.rotate = true
+	}
+	return b.Put(keyUsageKey, Uint64Key(used))
+}
+
+// rotateKey records the key-id after the one of km as the key new values are
+// sealed under and resets the usage counter, and returns the key material
+// to install once the transaction commits.
+func (stx *SecureTx) rotateKey(km *keyMaterial) (*keyMaterial, error) {
+	ring, ok := km.aead.(*keyRing)
+	if !ok {
+		return nil, errors.New("database key cannot be rotated")
+	}
+	next, err := ring.keys.ring(ring.keyID + 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate key: %w", err)
+	}
+	b, err := stx.tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Put(keyGenerationKey, binary.AppendUvarint(nil, next.keyID)); err != nil {
+		return nil, err
+	}
+	if err := b.Put(keyUsageKey, Uint64Key(0)); err != nil {
+		return nil, err
+	}
+	return &keyMaterial{keyLock: km.keyLock, aead: next, salt: km.salt}, nil
+}
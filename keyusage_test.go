@@ -0,0 +1,108 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMaxBytesPerKey(t *testing.T) {
+	filename := "test_key_usage.db"
+	password := "secure-test-password"
+	bucketName := []byte("Data")
+	value := bytes.Repeat([]byte("v"), 40)
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{MaxBytesPerKey: 100})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	put := func(db *SecureBolt, keys ...string) error {
+		return db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := b.Put([]byte(key), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := put(db, "key0", "key1"); err != nil {
+		t.Fatalf("Failed to put values under the limit: %v", err)
+	}
+	if err := put(db, "key2"); !errors.Is(err, ErrKeyUsageExceeded) {
+		t.Fatalf("Expected ErrKeyUsageExceeded past the limit, got %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		v, err := tx.Get(bucketName, []byte("key2"))
+		if v != nil {
+			t.Errorf("Expected the rejected value not to be stored")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	db.Close()
+
+	// With rotation the same write commits and switches to a new key
+	db, err = OpenWithOptions(filename, 0600, []byte(password), &Options{MaxBytesPerKey: 100, AutoRotateOnLimit: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if err := put(db, "key2"); err != nil {
+		t.Fatalf("Failed to put value with rotation: %v", err)
+	}
+	if err := put(db, "key3"); err != nil {
+		t.Fatalf("Failed to put value after rotation: %v", err)
+	}
+	status := func() []KeyStat {
+		stats, err := db.KeyRingStatus()
+		if err != nil {
+			t.Fatalf("Failed to get key ring status: %v", err)
+		}
+		return stats
+	}
+	// Key 0 also sealed the settings record of the bucket
+	want := []KeyStat{{KeyID: 0, Values: 4}, {KeyID: 1, Values: 1, Primary: true}}
+	if got := status(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("KeyRingStatus() = %+v, expected %+v", got, want)
+	}
+	db.Close()
+
+	// Values under both keys stay readable after reopening
+	db, err = OpenWithOptions(filename, 0600, []byte(password), &Options{MaxBytesPerKey: 1000, AutoRotateOnLimit: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		for i := 0; i < 4; i++ {
+			v, err := tx.Get(bucketName, []byte(fmt.Sprintf("key%d", i)))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(v, value) {
+				t.Errorf("Unexpected value %q for key%d", v, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+	want = []KeyStat{{KeyID: 1, Values: 5, Primary: true}}
+	if got := status(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("KeyRingStatus() after RefreshNonces = %+v, expected %+v", got, want)
+	}
+}
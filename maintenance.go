@@ -0,0 +1,147 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultCompactThreshold is the free page ratio above which maintenance
+// compacts the database when MaintenanceConfig.CompactThreshold is zero.
+const defaultCompactThreshold = 0.5
+
+// MaintenanceConfig selects the tasks StartMaintenance runs. A task with a
+// zero interval is disabled.
+type MaintenanceConfig struct {
+	// ReapInterval is how often ReapExpired deletes expired keys.
+	ReapInterval time.Duration
+
+	// NonceAuditInterval is how often AuditNonces checks for reused nonces.
+	// Any reuse is reported to the logger as an error.
+	NonceAuditInterval time.Duration
+
+	// CompactInterval is how often the free page ratio is checked. When it
+	// is above CompactThreshold, zero meaning 0.5, and CompactWindow allows
+	// it, the database is compacted in place. Compaction holds the write
+	// lock, so every transaction waits until it is done, and it is skipped
+	// while snapshots are open. The file lock is released briefly while the
+	// compacted copy replaces the file. CompactWindow nil allows compaction
+	// at any time; use it to restrict compaction to low-traffic hours.
+	CompactInterval  time.Duration
+	CompactThreshold float64
+	CompactWindow    func(now time.Time) bool
+}
+
+// StartMaintenance runs the tasks enabled in cfg on a background goroutine,
+// each on its own interval, until the returned stop function is called or
+// the database is closed. Tasks take the same locks as ordinary
+// transactions and keep them only as long as one task takes, so the
+// application keeps running between them; errors are reported to
+// Options.Logger. stop waits for a running task to finish, so call it
+// before Close to halt maintenance cleanly. Calling stop more than once is
+// safe.
+func (s *SecureBolt) StartMaintenance(cfg MaintenanceConfig) (stop func()) {
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+
+	ticker := func(interval time.Duration) (<-chan time.Time, func()) {
+		if interval <= 0 {
+			return nil, func() {}
+		}
+		t := time.NewTicker(interval)
+		return t.C, t.Stop
+	}
+	reap, stopReap := ticker(cfg.ReapInterval)
+	audit, stopAudit := ticker(cfg.NonceAuditInterval)
+	compact, stopCompact := ticker(cfg.CompactInterval)
+
+	go func() {
+		defer close(finished)
+		defer stopReap()
+		defer stopAudit()
+		defer stopCompact()
+		for {
+			var task string
+			var err error
+			select {
+			case <-quit:
+				return
+			case <-s.done:
+				return
+			case <-reap:
+				task = "reap expired"
+				var n int
+				if n, err = s.ReapExpired(); err == nil && n > 0 {
+					s.logger().Debug("securebolt maintenance reaped expired keys", "count", n)
+				}
+			case <-audit:
+				task = "audit nonces"
+				var reused int
+				if reused, err = s.AuditNonces(); err == nil && reused > 0 {
+					err = fmt.Errorf("%d values reuse a nonce; run RefreshNonces", reused)
+				}
+			case now := <-compact:
+				task = "compact"
+				if cfg.CompactWindow == nil || cfg.CompactWindow(now) {
+					err = s.compactOnline(cfg.CompactThreshold)
+				}
+			}
+			if errors.Is(err, ErrDBClosed) {
+				return
+			}
+			if err != nil {
+				s.logger().Error("securebolt maintenance task failed", "task", task, "err", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+		<-finished
+	}
+}
+
+// compactOnline compacts the database in place under the write lock when its
+// free page ratio is above threshold, or defaultCompactThreshold when
+// threshold is zero. When the compaction fails after the file was closed and
+// it cannot be reopened, the database is shut down as by Close, so later
+// calls return ErrDBClosed rather than use the closed handle.
+func (s *SecureBolt) compactOnline(threshold float64) error {
+	if threshold == 0 {
+		threshold = defaultCompactThreshold
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
+	s.snapMu.Lock()
+	snapshots := len(s.snapshots)
+	s.snapMu.Unlock()
+	if snapshots > 0 {
+		return nil // Open snapshots keep read transactions on the current file
+	}
+
+	ratio, err := freePageRatio(s.db)
+	if err != nil || ratio <= threshold {
+		return err
+	}
+	path := s.db.Path()
+	db, err := compactInPlace(s.db, &s.opts)
+	if db == nil {
+		s.logger().Error("securebolt closed after online compaction failed", "path", path, "err", err)
+		s.closed.Store(true)
+		s.closeLocked() // Closing the already closed handle again does nothing
+		return err
+	}
+	s.db = db
+	return err
+}
+
+// logger returns the logger set in Options.Logger, or slog.Default.
+func (s *SecureBolt) logger() *slog.Logger {
+	return s.opts.logger()
+}
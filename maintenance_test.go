@@ -0,0 +1,223 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// lockedBuffer is a bytes.Buffer safe to log to from the maintenance goroutine.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStartMaintenance(t *testing.T) {
+	filename := "test_maintenance.db"
+	password := "secure-test-password"
+	bucketName := []byte("Secrets")
+	defer os.Remove(filename)
+
+	var logged lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logged, nil))
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 1024)
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 500; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("bulk%04d", i)), large); err != nil {
+				return err
+			}
+		}
+		if err := b.PutWithTTL([]byte("expiring"), []byte("soon"), time.Millisecond); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("alice"), []byte("alice-secret")); err != nil {
+			return err
+		}
+		// Copy a ciphertext under another key, reusing its nonce
+		raw := tx.Bolt().Bucket(bucketName)
+		return raw.Put([]byte("copy"), append([]byte{}, raw.Get([]byte("alice"))...))
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 500; i++ {
+			if err := b.Delete([]byte(fmt.Sprintf("bulk%04d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete values: %v", err)
+	}
+	before, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+
+	stop := db.StartMaintenance(MaintenanceConfig{
+		ReapInterval:       5 * time.Millisecond,
+		NonceAuditInterval: 5 * time.Millisecond,
+		CompactInterval:    5 * time.Millisecond,
+		CompactThreshold:   0.1,
+	})
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	stop()
+
+	err = db.View(func(tx *SecureTx) error {
+		if tx.Bolt().Bucket(bucketName).Get([]byte("expiring")) != nil {
+			t.Errorf("Expected the expired key to be reaped")
+		}
+		v, err := tx.Get(bucketName, []byte("alice"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "alice-secret" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read after maintenance: %v", err)
+	}
+	after, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("Expected compaction to shrink the file from %d bytes, got %d", before.Size(), after.Size())
+	}
+	if out := logged.String(); !strings.Contains(out, "audit nonces") {
+		t.Errorf("Expected the nonce reuse to be logged, got %q", out)
+	}
+
+	// Maintenance stops on its own once the database is closed
+	stop = db.StartMaintenance(MaintenanceConfig{ReapInterval: time.Millisecond})
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+	stop()
+}
+
+func TestCompactOnlineReopenFailure(t *testing.T) {
+	filename := "test_compact_online_failure.db"
+	password := "secure-test-password"
+	bucketName := []byte("Secrets")
+	defer os.Remove(filename)
+
+	var logged lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logged, nil))
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 1024)
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 200; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("bulk%04d", i)), large); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte("alice"), []byte("alice-secret"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 200; i++ {
+			if err := b.Delete([]byte(fmt.Sprintf("bulk%04d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete values: %v", err)
+	}
+
+	errReopen := errors.New("reopen failed")
+	reopenBolt = func(string, os.FileMode, *bbolt.Options) (*bbolt.DB, error) {
+		return nil, errReopen
+	}
+	defer func() { reopenBolt = bbolt.Open }()
+
+	if err := db.compactOnline(0.1); !errors.Is(err, errReopen) {
+		t.Fatalf("Expected the reopen error, got %v", err)
+	}
+	if err := db.View(func(*SecureTx) error { return nil }); !errors.Is(err, ErrDBClosed) {
+		t.Errorf("Expected ErrDBClosed after the failed compaction, got %v", err)
+	}
+	if err := db.Close(); !errors.Is(err, ErrDBClosed) {
+		t.Errorf("Expected Close to report ErrDBClosed, got %v", err)
+	}
+	if !strings.Contains(logged.String(), "online compaction failed") {
+		t.Errorf("Expected the shutdown to be logged, got %q", logged.String())
+	}
+
+	// The compacted copy was renamed into place before the reopen failed
+	reopenBolt = bbolt.Open
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		v, err := tx.Get(bucketName, []byte("alice"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "alice-secret" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read after reopening: %v", err)
+	}
+}
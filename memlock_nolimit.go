@@ -0,0 +1,13 @@
+//go:build aix || solaris
+
+package securebolt
+
+// lockMemorySupported reports whether bbolt can lock its memory map on this
+// platform.
+const lockMemorySupported = true
+
+// memlockLimit returns false, as RLIMIT_MEMLOCK cannot be read on this
+// platform.
+func memlockLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package securebolt
+
+// lockMemorySupported reports whether bbolt can lock its memory map on this
+// platform.
+const lockMemorySupported = false
+
+// memlockLimit returns false, as there is no memory to lock on this
+// platform. Open rejects Options.LockMemory as unsupported.
+func memlockLimit() (uint64, bool) {
+	return 0, false
+}
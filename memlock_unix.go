@@ -0,0 +1,19 @@
+//go:build unix && !aix && !solaris
+
+package securebolt
+
+import "golang.org/x/sys/unix"
+
+// lockMemorySupported reports whether bbolt can lock its memory map on this
+// platform.
+const lockMemorySupported = true
+
+// memlockLimit returns the RLIMIT_MEMLOCK soft limit of the process, and
+// false when it is unlimited or cannot be read.
+func memlockLimit() (uint64, bool) {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &rl); err != nil || uint64(rl.Cur) == uint64(unix.RLIM_INFINITY) {
+		return 0, false
+	}
+	return uint64(rl.Cur), true
+}
@@ -0,0 +1,11 @@
+package securebolt
+
+// lockMemorySupported reports whether bbolt can lock its memory map on this
+// platform.
+const lockMemorySupported = false
+
+// memlockLimit returns the RLIMIT_MEMLOCK soft limit of the process, and
+// false when it is unlimited or cannot be read.
+func memlockLimit() (uint64, bool) {
+	return 0, false
+}
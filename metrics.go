@@ -0,0 +1,47 @@
+package securebolt
+
+import "sync/atomic"
+
+// Metrics counts the operations performed through a database handle since
+// it was opened or since the last ResetMetrics. Operations are counted when
+// they succeed, including those in write transactions that later roll back.
+type Metrics struct {
+	Gets            uint64 // SecureBucket.Get calls, including cache hits
+	Puts            uint64 // Values stored by any Put variant
+	Deletes         uint64 // Keys deleted
+	DecryptFailures uint64 // Gets whose stored value failed to decrypt
+}
+
+// metricCounters holds the counters behind Metrics.
+type metricCounters struct {
+	gets            atomic.Uint64
+	puts            atomic.Uint64
+	deletes         atomic.Uint64
+	decryptFailures atomic.Uint64
+}
+
+// Metrics returns the operation counters. It is safe to call concurrently
+// with any operation, and after Close.
+func (s *SecureBolt) Metrics() Metrics {
+	return Metrics{
+		Gets:            s.metrics.gets.Load(),
+		Puts:            s.metrics.puts.Load(),
+		Deletes:         s.metrics.deletes.Load(),
+		DecryptFailures: s.metrics.decryptFailures.Load(),
+	}
+}
+
+// ResetMetrics zeroes the operation counters and returns their values just
+// before the reset, for scrape-and-reset reporting over fixed intervals.
+// Each counter is swapped atomically, so an operation running concurrently
+// is counted either in the returned values or in the next interval, never
+// lost; the returned values are not a single point-in-time snapshot across
+// counters. The database stays usable throughout.
+func (s *SecureBolt) ResetMetrics() Metrics {
+	return Metrics{
+		Gets:            s.metrics.gets.Swap(0),
+		Puts:            s.metrics.puts.Swap(0),
+		Deletes:         s.metrics.deletes.Swap(0),
+		DecryptFailures: s.metrics.decryptFailures.Swap(0),
+	}
+}
@@ -0,0 +1,60 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestResetMetrics(t *testing.T) {
+	filename := "test_metrics.db"
+	password := "secure-test-password"
+	bucketName := []byte("Counted")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	work := func() {
+		err := db.Update(func(tx *SecureTx) error {
+			if err := tx.Put(bucketName, []byte("a"), []byte("1")); err != nil {
+				return err
+			}
+			if err := tx.Put(bucketName, []byte("b"), []byte("2")); err != nil {
+				return err
+			}
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			if _, err := b.Get([]byte("a")); err != nil {
+				return err
+			}
+			return b.Delete([]byte("b"))
+		})
+		if err != nil {
+			t.Fatalf("Failed to run operations: %v", err)
+		}
+	}
+
+	work()
+	want := Metrics{Gets: 1, Puts: 2, Deletes: 1}
+	if got := db.Metrics(); got != want {
+		t.Fatalf("Expected metrics %+v, got %+v", want, got)
+	}
+	if got := db.ResetMetrics(); got != want {
+		t.Fatalf("Expected ResetMetrics to return %+v, got %+v", want, got)
+	}
+	if got := db.Metrics(); got != (Metrics{}) {
+		t.Fatalf("Expected zero metrics after reset, got %+v", got)
+	}
+
+	// The database keeps working and counting after the reset
+	work()
+	if got := db.Metrics(); got != want {
+		t.Fatalf("Expected metrics %+v after reset, got %+v", want, got)
+	}
+}
@@ -0,0 +1,96 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// MigrateFromBolt copies the plaintext bbolt database at srcPath into a new
+// SecureBolt database created at dstPath with mode and password, encrypting
+// every value on the way. Buckets keep their names, nesting and sequence
+// numbers; keys are copied as they are, since SecureBolt stores keys
+// unencrypted. The source is opened read-only and left untouched, so once
+// the copy is verified it should be securely deleted: its plaintext stays
+// on disk until then.
+//
+// Each top-level bucket is copied in its own write transaction. dstPath must
+// not exist, and the source must not use bucket names starting with the
+// reserved securebolt_ prefix. On error the partial destination is removed.
+func MigrateFromBolt(srcPath, dstPath string, mode fs.FileMode, password []byte) (err error) {
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("%q already exists", dstPath)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	src, err := bbolt.Open(srcPath, 0600, &bbolt.Options{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer src.Close()
+
+	var names [][]byte
+	err = src.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			if bytes.HasPrefix(name, reservedPrefix) {
+				return fmt.Errorf("source bucket %q uses the reserved %q prefix", name, reservedPrefix)
+			}
+			names = append(names, append([]byte{}, name...))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	dst, err := Open(dstPath, mode, password)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	return src.View(func(srcTx *bbolt.Tx) error {
+		for _, name := range names {
+			err := dst.Update(func(tx *SecureTx) error {
+				sb, err := tx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return migrateBucket(sb, srcTx.Bucket(name))
+			})
+			if err != nil {
+				return fmt.Errorf("failed to migrate bucket %q: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// migrateBucket encrypts the values of the plaintext bucket src into sb,
+// recursing into nested buckets.
+func migrateBucket(sb *SecureBucket, src *bbolt.Bucket) error {
+	if err := sb.bucket.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return sb.Put(k, v)
+		}
+		child, err := sb.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+		return migrateBucket(child, src.Bucket(k))
+	})
+}
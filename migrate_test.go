@@ -0,0 +1,98 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestMigrateFromBolt(t *testing.T) {
+	srcPath := "test_migrate_plain.db"
+	dstPath := "test_migrate_secure.db"
+	password := "secure-test-password"
+
+	defer os.Remove(srcPath)
+	defer os.Remove(dstPath)
+
+	src, err := bbolt.Open(srcPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to create source database: %v", err)
+	}
+	err = src.Update(func(tx *bbolt.Tx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		if err := users.Put([]byte("alice"), []byte("alice@example.com")); err != nil {
+			return err
+		}
+		if err := users.Put([]byte("empty"), []byte{}); err != nil {
+			return err
+		}
+		if err := users.SetSequence(42); err != nil {
+			return err
+		}
+		admins, err := users.CreateBucket([]byte("admins"))
+		if err != nil {
+			return err
+		}
+		return admins.Put([]byte("root"), []byte("root@example.com"))
+	})
+	src.Close()
+	if err != nil {
+		t.Fatalf("Failed to populate source database: %v", err)
+	}
+
+	if err := MigrateFromBolt(srcPath, dstPath, 0600, []byte(password)); err != nil {
+		t.Fatalf("MigrateFromBolt failed: %v", err)
+	}
+	if err := MigrateFromBolt(srcPath, dstPath, 0600, []byte(password)); err == nil {
+		t.Fatalf("Expected migrating onto an existing destination to fail")
+	}
+
+	db, err := Open(dstPath, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open migrated database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *SecureTx) error {
+		users, err := tx.Bucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		if seq := users.bucket.Sequence(); seq != 42 {
+			t.Errorf("Expected sequence 42, got %d", seq)
+		}
+		raw := tx.Bolt().Bucket([]byte("users")).Get([]byte("alice"))
+		if string(raw) == "alice@example.com" {
+			t.Errorf("Expected the migrated value to be encrypted")
+		}
+		for key, want := range map[string]string{"alice": "alice@example.com", "empty": ""} {
+			v, err := users.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if v == nil || string(v) != want {
+				t.Errorf("users/%s: expected %q, got %q", key, want, v)
+			}
+		}
+
+		admins, err := users.Bucket([]byte("admins"))
+		if err != nil {
+			return err
+		}
+		v, err := admins.Get([]byte("root"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "root@example.com" {
+			t.Errorf("users/admins/root: expected %q, got %q", "root@example.com", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to verify migrated database: %v", err)
+	}
+}
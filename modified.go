@@ -0,0 +1,30 @@
+package securebolt
+
+import "time"
+
+// modifiedHeaderLength is the size of the last-modified time recorded in
+// values written with Options.TrackTimestamps.
+const modifiedHeaderLength = 8
+
+// LastModified returns when the value of key was last written. The time is
+// decrypted along with the value; it is only present when the value was
+// written with Options.TrackTimestamps, and ok is false for a value without
+// one or a key that does not exist or has expired. Rewrites that keep the
+// value, such as RefreshNonces, do not change it.
+func (sb *SecureBucket) LastModified(key []byte) (modified time.Time, ok bool, err error) {
+	if err := sb.checkKey(key); err != nil {
+		return time.Time{}, false, err
+	}
+	encryptedValue := sb.bucket.Get(key)
+	if encryptedValue == nil {
+		return time.Time{}, false, nil
+	}
+	rec, err := sb.openFull(key, encryptedValue)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if rec.modified == 0 || rec.expired(time.Now()) {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(0, rec.modified), true, nil
+}
@@ -0,0 +1,85 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLastModified(t *testing.T) {
+	filename := "test_last_modified.db"
+	password := "secure-test-password"
+	bucketName := []byte("Synced")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{TrackTimestamps: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	put := func(value string) {
+		err := db.Update(func(tx *SecureTx) error {
+			return tx.Put(bucketName, []byte("key"), []byte(value))
+		})
+		if err != nil {
+			t.Fatalf("Failed to put value: %v", err)
+		}
+	}
+	lastModified := func(key string) (time.Time, bool) {
+		var modified time.Time
+		var ok bool
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			modified, ok, err = b.LastModified([]byte(key))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to get last-modified time: %v", err)
+		}
+		return modified, ok
+	}
+
+	before := time.Now()
+	put("first")
+	first, ok := lastModified("key")
+	if !ok || first.Before(before) || first.After(time.Now()) {
+		t.Fatalf("LastModified() = %v, %v, expected a time after %v", first, ok, before)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	put("second")
+	second, ok := lastModified("key")
+	if !ok || !second.After(first) {
+		t.Fatalf("LastModified() after overwrite = %v, %v, expected a time after %v", second, ok, first)
+	}
+
+	// Refreshing nonces rewrites the value without modifying it
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+	if refreshed, _ := lastModified("key"); !refreshed.Equal(second) {
+		t.Fatalf("LastModified() after RefreshNonces = %v, expected %v", refreshed, second)
+	}
+	if _, ok := lastModified("missing"); ok {
+		t.Fatalf("Expected no last-modified time for a missing key")
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		v, err := tx.Get(bucketName, []byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "second" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+}
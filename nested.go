@@ -0,0 +1,163 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// nestedBucketPrefix starts the internal name of nested buckets, which
+// identifies them to the cache, bucket settings and key binding. The rest of
+// the name is the CompositeKey of the bucket's path, so it differs from the
+// name of every top-level bucket and every other nested bucket.
+var nestedBucketPrefix = []byte("securebolt_nested")
+
+// Bucket returns the bucket nested in this one under name. Values in nested
+// buckets are encrypted like any other and support the same reads and
+// writes. DeleteBucket, ErasePrefix, ReapExpired, Purge, RefreshNonces and
+// the other maintenance that rewrites values descend into nested buckets at
+// any depth, while SampleHealth and Diff only look at top-level buckets.
+func (sb *SecureBucket) Bucket(name []byte) (*SecureBucket, error) {
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	bucket := sb.bucket.Bucket(name)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %q not found", name)
+	}
+	return sb.nested(name, bucket), nil
+}
+
+// CreateBucketIfNotExists creates the bucket nested in this one under name
+// if it does not exist yet, recording the settings it adopts from the
+// current options as SecureTx.CreateBucket does, and returns it. See Bucket.
+func (sb *SecureBucket) CreateBucketIfNotExists(name []byte) (*SecureBucket, error) {
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	if bucket := sb.bucket.Bucket(name); bucket != nil {
+		return sb.nested(name, bucket), nil
+	}
+	bucket, err := sb.bucket.CreateBucket(name)
+	if err != nil {
+		return nil, err
+	}
+	child := sb.nested(name, bucket)
+	if err := child.recordDefaults(); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// nested wraps the bbolt bucket nested in this one under name.
+func (sb *SecureBucket) nested(name []byte, bucket *bbolt.Bucket) *SecureBucket {
+	path := sb.path
+	if path == nil {
+		path = [][]byte{sb.name}
+	}
+	path = append(append([][]byte{}, path...), append([]byte{}, name...))
+	child := sb.tx.newBucket(append(append([]byte{}, nestedBucketPrefix...), CompositeKey(path...)...), bucket)
+	child.path = path
+	return child
+}
+
+// walkNested calls fn for every bucket nested in this one, at any depth,
+// visiting each bucket before the buckets nested in it. The names are
+// collected first, so fn may modify the bucket it is given.
+func (sb *SecureBucket) walkNested(fn func(child *SecureBucket) error) error {
+	var names [][]byte
+	err := sb.bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			names = append(names, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		bucket := sb.bucket.Bucket(name)
+		if bucket == nil {
+			continue
+		}
+		child := sb.nested(name, bucket)
+		if err := fn(child); err != nil {
+			return err
+		}
+		if err := child.walkNested(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkUserBuckets calls fn for every top-level bucket not reserved for
+// internal use and for every bucket nested in them.
+func (stx *SecureTx) walkUserBuckets(fn func(sb *SecureBucket) error) error {
+	var names [][]byte
+	err := stx.tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+		if !bytes.HasPrefix(name, reservedPrefix) {
+			names = append(names, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		sb := stx.newBucket(name, stx.tx.Bucket(name))
+		if err := fn(sb); err != nil {
+			return err
+		}
+		if err := sb.walkNested(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketNamed returns the bucket with the given internal name, either a
+// top-level bucket or a nested one identified by nestedBucketPrefix and its
+// path, or nil when it does not exist.
+func (stx *SecureTx) bucketNamed(name []byte) *SecureBucket {
+	if bucket := stx.tx.Bucket(name); bucket != nil {
+		return stx.newBucket(name, bucket)
+	}
+	if !bytes.HasPrefix(name, nestedBucketPrefix) {
+		return nil
+	}
+	path := SplitCompositeKey(name[len(nestedBucketPrefix):])
+	if len(path) < 2 {
+		return nil
+	}
+	bucket := stx.tx.Bucket(path[0])
+	if bucket == nil {
+		return nil
+	}
+	sb := stx.newBucket(path[0], bucket)
+	for _, p := range path[1:] {
+		if bucket = sb.bucket.Bucket(p); bucket == nil {
+			return nil
+		}
+		sb = sb.nested(p, bucket)
+	}
+	return sb
+}
+
+// release deletes the external values, expiry index entries, settings and
+// cached plaintext of the bucket and of every bucket nested in it, ahead of
+// deleting the bucket.
+func (sb *SecureBucket) release() error {
+	release := func(b *SecureBucket) error {
+		if err := b.releaseAllSideEntries(); err != nil {
+			return err
+		}
+		b.tx.db.cache.invalidateBucket(b.name)
+		return b.tx.deleteBucketConfig(b.name)
+	}
+	if err := release(sb); err != nil {
+		return err
+	}
+	return sb.walkNested(release)
+}
@@ -0,0 +1,220 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNestedBucketCleanup(t *testing.T) {
+	filename := "test_nested_cleanup.db"
+	password := "secure-test-password"
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalThreshold: 16, ExpiryIndex: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 64)
+	err = db.Update(func(tx *SecureTx) error {
+		users, err := tx.CreateBucket([]byte("Users"))
+		if err != nil {
+			return err
+		}
+		for _, subject := range []string{"user:42/docs", "user:7/docs"} {
+			docs, err := users.CreateBucketIfNotExists([]byte(subject))
+			if err != nil {
+				return err
+			}
+			if err := docs.Put([]byte("passport"), large); err != nil {
+				return err
+			}
+			scans, err := docs.CreateBucketIfNotExists([]byte("scans"))
+			if err != nil {
+				return err
+			}
+			if err := scans.PutWithTTL([]byte("page-1"), large, time.Hour); err != nil {
+				return err
+			}
+		}
+		if err := users.Put([]byte("user:42/name"), []byte("alice")); err != nil {
+			return err
+		}
+
+		archive, err := tx.CreateBucket([]byte("Archive"))
+		if err != nil {
+			return err
+		}
+		old, err := archive.CreateBucketIfNotExists([]byte("old"))
+		if err != nil {
+			return err
+		}
+		return old.PutWithTTL([]byte("report"), large, time.Hour)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate buckets: %v", err)
+	}
+
+	// leftovers returns the number of external values and expiry index
+	// entries, and the internal names of the nested buckets with settings
+	leftovers := func(tx *SecureTx) (external, expiries int, nested []string) {
+		count := func(name []byte) int {
+			n := 0
+			if b := tx.Bolt().Bucket(name); b != nil {
+				b.ForEach(func(_, _ []byte) error {
+					n++
+					return nil
+				})
+			}
+			return n
+		}
+		external, expiries = count(externalBucket), count(expiryIndexBucket)
+		if b := tx.Bolt().Bucket(bucketConfigBucket); b != nil {
+			b.ForEach(func(k, _ []byte) error {
+				if bytes.HasPrefix(k, nestedBucketPrefix) {
+					nested = append(nested, string(k))
+				}
+				return nil
+			})
+		}
+		return external, expiries, nested
+	}
+
+	var erased int
+	err = db.Update(func(tx *SecureTx) error {
+		users, err := tx.Bucket([]byte("Users"))
+		if err != nil {
+			return err
+		}
+		erased, err = users.ErasePrefix([]byte("user:42/"))
+		if err != nil {
+			return err
+		}
+		if users.bucket.Bucket([]byte("user:42/docs")) != nil {
+			t.Errorf("Expected ErasePrefix to delete the nested bucket under the prefix")
+		}
+		if users.bucket.Bucket([]byte("user:7/docs")) == nil {
+			t.Errorf("Expected ErasePrefix to keep the nested bucket outside the prefix")
+		}
+		external, expiries, nested := leftovers(tx)
+		if external != 3 || expiries != 2 || len(nested) != 3 {
+			t.Errorf("Expected 3 external values, 2 expiry entries and 3 nested settings after ErasePrefix, got %d, %d and %v", external, expiries, nested)
+		}
+
+		if err := tx.DeleteBucket([]byte("Archive")); err != nil {
+			return err
+		}
+		external, expiries, nested = leftovers(tx)
+		if external != 2 || expiries != 1 || len(nested) != 2 {
+			t.Errorf("Expected 2 external values, 1 expiry entry and 2 nested settings after DeleteBucket, got %d, %d and %v", external, expiries, nested)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to erase nested buckets: %v", err)
+	}
+	if erased != 3 {
+		t.Errorf("Expected 3 values erased, got %d", erased)
+	}
+}
+
+func TestNestedBucketMaintenance(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index=%v", indexed), func(t *testing.T) {
+			filename := fmt.Sprintf("test_nested_maintenance_%v.db", indexed)
+			password := "secure-test-password"
+			defer os.Remove(filename)
+
+			db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExpiryIndex: indexed})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			nested := func(tx *SecureTx) (*SecureBucket, error) {
+				b, err := tx.Bucket([]byte("Users"))
+				if err != nil {
+					return nil, err
+				}
+				docs, err := b.Bucket([]byte("docs"))
+				if err != nil {
+					return nil, err
+				}
+				return docs.Bucket([]byte("scans"))
+			}
+			var before []byte
+			err = db.Update(func(tx *SecureTx) error {
+				b, err := tx.CreateBucket([]byte("Users"))
+				if err != nil {
+					return err
+				}
+				docs, err := b.CreateBucketIfNotExists([]byte("docs"))
+				if err != nil {
+					return err
+				}
+				scans, err := docs.CreateBucketIfNotExists([]byte("scans"))
+				if err != nil {
+					return err
+				}
+				if err := scans.PutWithTTL([]byte("expiring"), []byte("a"), time.Millisecond); err != nil {
+					return err
+				}
+				if err := scans.Put([]byte("deleted"), []byte("b")); err != nil {
+					return err
+				}
+				if err := scans.SoftDelete([]byte("deleted")); err != nil {
+					return err
+				}
+				if err := scans.Put([]byte("kept"), []byte("c")); err != nil {
+					return err
+				}
+				before = append([]byte{}, scans.bucket.Get([]byte("kept"))...)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to populate nested bucket: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			if n, err := db.ReapExpired(); err != nil || n != 1 {
+				t.Fatalf("Expected ReapExpired to delete 1 nested key, got %d, %v", n, err)
+			}
+			if n, err := db.Purge(0); err != nil || n != 1 {
+				t.Fatalf("Expected Purge to remove 1 nested tombstone, got %d, %v", n, err)
+			}
+			if _, err := db.RefreshNonces(); err != nil {
+				t.Fatalf("Failed to refresh nonces: %v", err)
+			}
+
+			err = db.View(func(tx *SecureTx) error {
+				scans, err := nested(tx)
+				if err != nil {
+					return err
+				}
+				for _, k := range []string{"expiring", "deleted"} {
+					if scans.bucket.Get([]byte(k)) != nil {
+						t.Errorf("Expected %q to be removed from the nested bucket", k)
+					}
+				}
+				if bytes.Equal(scans.bucket.Get([]byte("kept")), before) {
+					t.Errorf("Expected RefreshNonces to rewrite the nested value")
+				}
+				v, err := scans.Get([]byte("kept"))
+				if err != nil {
+					return err
+				}
+				if string(v) != "c" {
+					t.Errorf("Unexpected refreshed value %q", v)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to read nested bucket: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package securebolt
+
+import "time"
+
+// Observer receives latency measurements, so that SecureBolt can feed an
+// external metrics library such as Prometheus histograms without depending
+// on one. Set it with Options.Observer.
+type Observer interface {
+	// ObserveView is called with the wall-clock duration of each View
+	// callback.
+	ObserveView(d time.Duration)
+	// ObserveUpdate is called with the wall-clock duration of each Update
+	// callback. It excludes the commit that follows a successful callback.
+	ObserveUpdate(d time.Duration)
+	// ObserveKDF is called once by Open with the time the Argon2 key
+	// derivation took. Databases opened by OpenGroup after the first reuse
+	// its key and report nothing.
+	ObserveKDF(d time.Duration)
+}
@@ -0,0 +1,72 @@
+package securebolt
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver keeps every duration it observes.
+type recordingObserver struct {
+	mu                  sync.Mutex
+	views, updates, kdf []time.Duration
+}
+
+func (o *recordingObserver) ObserveView(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.views = append(o.views, d)
+}
+
+func (o *recordingObserver) ObserveUpdate(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.updates = append(o.updates, d)
+}
+
+func (o *recordingObserver) ObserveKDF(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.kdf = append(o.kdf, d)
+}
+
+func TestObserver(t *testing.T) {
+	filename := "test_observer.db"
+	password := "secure-test-password"
+	defer os.Remove(filename)
+
+	obs := &recordingObserver{}
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Observer: obs})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if len(obs.kdf) != 1 || obs.kdf[0] != db.OpenStats().KDFDuration {
+		t.Fatalf("Expected the KDF duration %v to be observed once, got %v", db.OpenStats().KDFDuration, obs.kdf)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		time.Sleep(5 * time.Millisecond)
+		return tx.Put([]byte("bucket"), []byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = db.View(func(tx *SecureTx) error {
+			_, err := tx.Get([]byte("bucket"), []byte("key"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to view: %v", err)
+		}
+	}
+
+	if len(obs.updates) != 1 || obs.updates[0] < 5*time.Millisecond {
+		t.Fatalf("Expected one update of at least 5ms, got %v", obs.updates)
+	}
+	if len(obs.views) != 2 {
+		t.Fatalf("Expected two views, got %v", obs.views)
+	}
+}
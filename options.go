@@ -0,0 +1,156 @@
+package securebolt
+
+import (
+	"log/slog"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Options configures how OpenWithOptions opens a SecureBolt database. A nil
+// *Options is equivalent to the zero value, which matches the behavior of Open.
+// Options that change how values are written are recorded per value, so values
+// written under one setting stay readable when the option is later changed.
+type Options struct {
+	// ExternalSalt is used directly as the key derivation salt, of at least 16
+	// bytes, instead of the salt stored in securebolt_meta. A database created
+	// with one fails to open without it with ErrExternalSaltRequired.
+	ExternalSalt []byte
+
+	// Timeout is how long to wait for a file lock held by another process
+	// before failing with ErrFileLocked. Zero waits indefinitely.
+	Timeout time.Duration
+
+	// ReadOnly opens an existing database for reading only, under a shared
+	// file lock that excludes a writer for as long as either is open.
+	ReadOnly bool
+
+	// ChangeSink receives a ChangeEvent for every Put and Delete once Update
+	// has committed, synchronously and under the write lock, so it must not block.
+	ChangeSink func(event ChangeEvent)
+
+	// ChangeValues includes the decrypted new value in OpPut events. The
+	// value is plaintext; only enable it when the sink is trusted.
+	ChangeValues bool
+
+	// InsertionOrder records a sequence number in every value for
+	// ForEachInsertionOrder. It can only be enabled when the database is created.
+	InsertionOrder bool
+
+	// TrackTimestamps records the time of every write in the encrypted value,
+	// for SecureBucket.LastModified.
+	TrackTimestamps bool
+
+	// TagSize is the AES-GCM tag size in bytes, between 12 and 16, of a new
+	// database. Zero selects 16; existing databases use the recorded size.
+	TagSize int
+
+	// ExternalThreshold, when positive, moves values longer than this many
+	// bytes to the internal securebolt_external bucket. Zero disables it.
+	ExternalThreshold int
+
+	// CacheSize, when positive, keeps up to this many decrypted values in an
+	// in-memory LRU cache filled by reads. Cached plaintext lives outside
+	// memguard. SecureBolt.CacheStats reports hits and misses.
+	CacheSize int
+
+	// CacheTTL bounds how long a value stays in the cache. Zero keeps values
+	// until they are evicted or invalidated.
+	CacheTTL time.Duration
+
+	// MmapFlags and InitialMmapSize are passed through to bbolt, for
+	// filesystems where its memory map misbehaves.
+	MmapFlags       int
+	InitialMmapSize int
+
+	// LockMemory mlocks the memory map of the database file so its pages are
+	// never swapped. The locked memory is charged against RLIMIT_MEMLOCK;
+	// it is unsupported outside Unix.
+	LockMemory bool
+
+	// NoSync skips the fsync on every commit, trading durability for speed.
+	// Call SecureBolt.Checkpoint after writes that must survive a crash.
+	NoSync bool
+
+	// WipeInputAfterPut zeroes the caller's value slice once Put, PutAll or
+	// PutSigned has stored it.
+	WipeInputAfterPut bool
+
+	// RejectNilValue makes writes return ErrNilValue for a nil value instead
+	// of storing it as an empty value.
+	RejectNilValue bool
+
+	// ExpiryIndex maintains the internal securebolt_expiry bucket so that
+	// ReapExpired only visits keys written with PutWithTTL that have expired.
+	ExpiryIndex bool
+
+	// KeyValidator, when set, is called with the key at the start of every
+	// SecureBucket method that takes one, and its error is returned unchanged.
+	KeyValidator func(key []byte) error
+
+	// Compression DEFLATE-compresses values before encrypting them. Leave it
+	// off for secrets stored next to attacker-influenced data.
+	Compression bool
+
+	// StrictFileMode makes Open fail with ErrInsecureFilePermissions when the
+	// file grants a permission bit that the mode argument does not.
+	StrictFileMode bool
+
+	// Pepper is a server-wide secret mixed into the key derivation and never
+	// written to the file. A database created with one cannot be read without it.
+	Pepper []byte
+
+	// StrictSecurity binds values to their bucket and key, records a
+	// key-check verifier, requires the key's memory to be locked and
+	// defaults MinPasswordBits to 60.
+	StrictSecurity bool
+
+	// AutoCompactThreshold makes Open compact the file in place when more
+	// than this fraction of its pages is free. Zero disables it.
+	AutoCompactThreshold float64
+
+	// DatabaseID is mixed into the additional authenticated data of
+	// everything the database encrypts. It is recorded when the database is
+	// created and cannot be added or changed later.
+	DatabaseID []byte
+
+	// Observer receives the duration of every View and Update callback and
+	// of the key derivation. Nil measures nothing.
+	Observer Observer
+
+	// Logger receives the errors of background work such as
+	// StartMaintenance. Nil uses slog.Default.
+	Logger *slog.Logger
+
+	// MinPasswordBits rejects passwords whose EstimatePasswordStrength is
+	// below it with ErrWeakPassword. Zero disables the check.
+	MinPasswordBits float64
+
+	// MaxBytesPerKey bounds the plaintext sealed under one key; writes past
+	// it fail with ErrKeyUsageExceeded. Zero disables the check.
+	MaxBytesPerKey int64
+
+	// AutoRotateOnLimit makes a write that reaches MaxBytesPerKey switch the
+	// database to a new subkey instead of failing.
+	AutoRotateOnLimit bool
+}
+
+// logger returns the logger set in Logger, or slog.Default.
+func (o *Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+// boltOptions translates the options into the bbolt options used to open the file.
+func (o *Options) boltOptions() *bbolt.Options {
+	bo := *bbolt.DefaultOptions
+	bo.Timeout = o.Timeout
+	bo.ReadOnly = o.ReadOnly
+	bo.MmapFlags = o.MmapFlags
+	bo.InitialMmapSize = o.InitialMmapSize
+	bo.Mlock = o.LockMemory
+	bo.NoSync = o.NoSync
+	return &bo
+}
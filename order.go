@@ -0,0 +1,86 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// seqHeaderLength is the size of the insertion sequence prefixed to values
+// when Options.InsertionOrder is enabled.
+const seqHeaderLength = 8
+
+// ForEachInsertionOrder calls fn with each key and decrypted value in the
+// bucket, ordered by when the key was last written rather than by key. It
+// requires a database created with Options.InsertionOrder.
+//
+// The whole bucket is decrypted and buffered in memory before fn is first
+// called, so memory use grows with the bucket size. For large or unbounded
+// feeds, write entries to a dedicated bucket keyed by Uint64Key of
+// NextSequence instead, which a cursor iterates in insertion order directly.
+func (sb *SecureBucket) ForEachInsertionOrder(fn func(k, v []byte) error) error {
+	if !sb.tx.db.opts.InsertionOrder {
+		return errors.New("database does not track insertion order")
+	}
+
+	type entry struct {
+		seq   uint64
+		key   []byte
+		value []byte
+	}
+	var entries []entry
+	err := sb.bucket.ForEach(func(k, encV []byte) error {
+		if encV == nil || sb.tombstoned(k, encV) {
+			return nil // Nested bucket or tombstone
+		}
+		seq, value, err := sb.openRecord(k, encV)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{seq: seq, key: k, value: value})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	for _, e := range entries {
+		if err := fn(e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SortedByValue calls fn with each key and decrypted value in the bucket,
+// ordered by less applied to the values, for example by a priority field
+// inside them. Entries that less considers equal keep their key order.
+//
+// Like ForEachInsertionOrder, the whole bucket is decrypted and buffered in
+// memory and sorted before fn is first called, so it suits moderate-sized
+// buckets. For large buckets, or an order needed often, maintain a secondary
+// index bucket whose keys encode the sort field, such as CompositeKey of
+// Uint64Key(priority) and the primary key, and iterate it with a cursor.
+func (sb *SecureBucket) SortedByValue(less func(aVal, bVal []byte) bool, fn func(k, v []byte) error) error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	var entries []KV
+	c := sb.cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		entries = append(entries, KV{Key: k, Value: value})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i].Value, entries[j].Value) })
+	for _, e := range entries {
+		if err := fn(e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package securebolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestForEachInsertionOrder(t *testing.T) {
+	filename := "test_insertion_order.db"
+	password := "secure-test-password"
+	bucketName := []byte("FeedBucket")
+	keys := []string{"zulu", "alpha", "mike", "bravo"}
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{InsertionOrder: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Put([]byte(k), []byte("value-"+k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// The setting is persisted, so reopening without the option keeps it
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("mike"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "value-mike" {
+			return fmt.Errorf("value mismatch: got %q, expected %q", v, "value-mike")
+		}
+
+		var got []string
+		err = b.ForEachInsertionOrder(func(k, v []byte) error {
+			if string(v) != "value-"+string(k) {
+				return fmt.Errorf("value mismatch for key %s: got %s", k, v)
+			}
+			got = append(got, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if fmt.Sprint(got) != fmt.Sprint(keys) {
+			return fmt.Errorf("order mismatch: got %v, expected %v", got, keys)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}
+
+func TestSortedByValue(t *testing.T) {
+	filename := "test_sorted_by_value.db"
+	password := "secure-test-password"
+	bucketName := []byte("Tasks")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.PutAll(map[string][]byte{
+			"backup":  []byte(`{"priority":3}`),
+			"deploy":  []byte(`{"priority":1}`),
+			"email":   []byte(`{"priority":2}`),
+			"archive": []byte(`{"priority":3}`),
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	priority := func(v []byte) int {
+		var task struct{ Priority int }
+		if err := json.Unmarshal(v, &task); err != nil {
+			t.Fatalf("Failed to decode %q: %v", v, err)
+		}
+		return task.Priority
+	}
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		var got []string
+		err = b.SortedByValue(func(a, b []byte) bool { return priority(a) < priority(b) }, func(k, v []byte) error {
+			got = append(got, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		want := []string{"deploy", "email", "archive", "backup"} // Ties keep key order
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Got order %v, expected %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SortedByValue failed: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package securebolt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// pageTokenNamespace is the binding namespace of continuation tokens, which
+// are bound to it and to the name of their bucket. No value is stored in a
+// bucket of that name, so a token can neither be replayed against another
+// bucket nor be confused with a value.
+var pageTokenNamespace = []byte("securebolt_page_token")
+
+// PageToken returns up to limit entries in key order, starting after the
+// position encoded in token; an empty token starts at the first key. It also
+// returns the token for the next page, which is empty once the bucket has
+// been read to the end. Tokens are the last returned key encrypted under the
+// database key and bound to this bucket, then base64 encoded, so clients
+// handling them learn nothing about the keys and cannot alter them. Invalid
+// or tampered tokens return ErrInvalidPageToken. Nested buckets are skipped.
+func (sb *SecureBucket) PageToken(token string, limit int) (items []KV, nextToken string, err error) {
+	if limit <= 0 {
+		return nil, "", errors.New("limit must be positive")
+	}
+	if err := sb.checkOpen(); err != nil {
+		return nil, "", err
+	}
+
+	c := sb.cursor()
+	var k, v []byte
+	if token == "" {
+		k, v = c.First()
+	} else {
+		after, err := sb.openPageToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		k, v = c.Seek(after)
+		if k != nil && bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+	}
+
+	for ; k != nil; k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		if len(items) == limit {
+			last := items[len(items)-1].Key
+			if nextToken, err = sb.sealPageToken(last); err != nil {
+				return nil, "", err
+			}
+			return items, nextToken, nil
+		}
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		items = append(items, KV{Key: append([]byte{}, k...), Value: value})
+	}
+	return items, "", nil
+}
+
+// sealPageToken encrypts key into a continuation token.
+func (sb *SecureBucket) sealPageToken(key []byte) (string, error) {
+	sealed, err := sealEnvelope(key, sb.aead, flagBound, sb.pageTokenBinding())
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openPageToken decrypts a continuation token back into a key.
+func (sb *SecureBucket) openPageToken(token string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	key, flags, err := openEnvelopeFlags(sealed, sb.aead, sb.pageTokenBinding())
+	if err != nil || flags != flagBound {
+		return nil, ErrInvalidPageToken
+	}
+	return key, nil
+}
+
+// pageTokenBinding returns the binding of the bucket's continuation tokens.
+func (sb *SecureBucket) pageTokenBinding() *binding {
+	return &binding{bucket: pageTokenNamespace, key: sb.name}
+}
@@ -0,0 +1,164 @@
+package securebolt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPageToken(t *testing.T) {
+	filename := "test_page_token.db"
+	password := "secure-test-password"
+	bucketName := []byte("PagedBucket")
+	const total = 25
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < total; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%02d", i))); err != nil {
+				return err
+			}
+		}
+		_, err = tx.CreateBucket([]byte("OtherBucket"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	var seen []string
+	var firstToken string
+	token, pages := "", 0
+	for {
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			items, next, err := b.PageToken(token, 10)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				seen = append(seen, string(item.Key))
+			}
+			if strings.Contains(next, "key-") {
+				t.Fatalf("Token exposes the key: %q", next)
+			}
+			token = next
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("PageToken failed: %v", err)
+		}
+		pages++
+		if pages == 1 {
+			firstToken = token
+		}
+		if token == "" {
+			break
+		}
+	}
+
+	if pages != 3 || len(seen) != total {
+		t.Fatalf("Read %d keys in %d pages, expected %d keys in 3 pages", len(seen), pages, total)
+	}
+	for i, k := range seen {
+		if want := fmt.Sprintf("key-%02d", i); k != want {
+			t.Fatalf("Key %d is %q, expected %q", i, k, want)
+		}
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		tampered := []byte(firstToken)
+		tampered[len(tampered)/2] ^= 1
+		if _, _, err := b.PageToken(string(tampered), 10); !errors.Is(err, ErrInvalidPageToken) {
+			t.Fatalf("Expected ErrInvalidPageToken for a tampered token, got %v", err)
+		}
+		other, err := tx.Bucket([]byte("OtherBucket"))
+		if err != nil {
+			return err
+		}
+		if _, _, err := other.PageToken(firstToken, 10); !errors.Is(err, ErrInvalidPageToken) {
+			t.Fatalf("Expected ErrInvalidPageToken for another bucket's token, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to check invalid tokens: %v", err)
+	}
+}
+
+func TestPageTokenIsNotAValue(t *testing.T) {
+	filename := "test_page_token_value.db"
+	password := "secure-test-password"
+	bucketName := []byte("PagedBucket")
+	tokenKey := []byte("securebolt page token")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{StrictSecurity: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "b", "c"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		if err := b.Put(tokenKey, []byte("b")); err != nil {
+			return err
+		}
+
+		// A bound value is not accepted as a token
+		forged := base64.RawURLEncoding.EncodeToString(b.bucket.Get(tokenKey))
+		if _, _, err := b.PageToken(forged, 1); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("Expected ErrInvalidPageToken for a stored value, got %v", err)
+		}
+
+		// Nor is a token accepted as a bound value
+		_, next, err := b.PageToken("", 1)
+		if err != nil {
+			return err
+		}
+		sealed, err := base64.RawURLEncoding.DecodeString(next)
+		if err != nil {
+			return err
+		}
+		if err := b.bucket.Put(tokenKey, sealed); err != nil {
+			return err
+		}
+		if v, err := b.Get(tokenKey); err == nil {
+			t.Errorf("Expected a token stored as a value to fail to decrypt, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to check page tokens: %v", err)
+	}
+}
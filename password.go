@@ -0,0 +1,79 @@
+package securebolt
+
+import (
+	"fmt"
+	"math"
+)
+
+// strictMinPasswordBits is the password entropy estimate StrictSecurity
+// requires when Options.MinPasswordBits is not set.
+const strictMinPasswordBits = 60
+
+// checkPasswordStrength returns ErrWeakPassword when opts enforce a minimum
+// password strength that password does not reach.
+func checkPasswordStrength(password []byte, opts *Options) error {
+	if opts == nil {
+		return nil
+	}
+	required := opts.MinPasswordBits
+	if required == 0 && opts.StrictSecurity {
+		required = strictMinPasswordBits
+	}
+	if required <= 0 {
+		return nil
+	}
+	if bits := EstimatePasswordStrength(password); bits < required {
+		return fmt.Errorf("%w: estimated %.0f bits, at least %.0f required", ErrWeakPassword, bits, required)
+	}
+	return nil
+}
+
+// EstimatePasswordStrength estimates the entropy of password in bits, as
+// enforced by Options.MinPasswordBits. Every byte is worth log2 of the size
+// of the alphabet spanned by the character classes the password uses, except
+// bytes that repeat the previous one or continue an ascending or descending
+// run, such as "aaaa" or "1234", which are worth a single bit. The estimate
+// knows nothing of dictionary words or common passwords, so it is an upper
+// bound: "password" scores about 38 bits although it is among the first
+// guesses of any attacker. password is only read, never retained.
+func EstimatePasswordStrength(password []byte) (bits float64) {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range password {
+		switch {
+		case 'a' <= c && c <= 'z':
+			lower = true
+		case 'A' <= c && c <= 'Z':
+			upper = true
+		case '0' <= c && c <= '9':
+			digit = true
+		case c >= 0x20 && c < 0x7f:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	alphabet := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 128}} {
+		if class.used {
+			alphabet += class.size
+		}
+	}
+	if alphabet == 0 {
+		return 0
+	}
+
+	perByte := math.Log2(float64(alphabet))
+	for i, c := range password {
+		if i > 0 {
+			if d := int(c) - int(password[i-1]); d >= -1 && d <= 1 {
+				bits++
+				continue
+			}
+		}
+		bits += perByte
+	}
+	return bits
+}
@@ -0,0 +1,31 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMinPasswordBits(t *testing.T) {
+	filename := "test_password_strength.db"
+	defer os.Remove(filename)
+	opts := &Options{MinPasswordBits: 50}
+
+	strong := "violet-Harbor-47-quietly-Spins"
+	weak := "1234"
+	if bits := EstimatePasswordStrength([]byte(strong)); bits < opts.MinPasswordBits {
+		t.Fatalf("Expected %q to reach %v bits, estimated %v", strong, opts.MinPasswordBits, bits)
+	}
+	if bits := EstimatePasswordStrength([]byte(weak)); bits >= opts.MinPasswordBits {
+		t.Fatalf("Expected %q to stay below %v bits, estimated %v", weak, opts.MinPasswordBits, bits)
+	}
+
+	if _, err := OpenWithOptions(filename, 0600, []byte(weak), opts); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("Expected ErrWeakPassword, got %v", err)
+	}
+	db, err := OpenWithOptions(filename, 0600, []byte(strong), opts)
+	if err != nil {
+		t.Fatalf("Failed to open database with a strong password: %v", err)
+	}
+	db.Close()
+}
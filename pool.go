@@ -0,0 +1,59 @@
+package securebolt
+
+import (
+	"fmt"
+
+	"github.com/awnumar/memguard"
+)
+
+// BufferPool supplies the reusable plaintext buffers used by ForEachPooled.
+// Get returns a buffer whose length is ignored and whose capacity is reused;
+// Put hands a buffer back once SecureBolt is done with it, wiped. A
+// sync.Pool of byte slices wrapped in these two methods is a typical
+// implementation. The pool must be safe for concurrent use if it is shared
+// between goroutines.
+type BufferPool interface {
+	Get() []byte
+	Put(buf []byte)
+}
+
+// ForEachPooled is ForEach decrypting each value into a buffer taken from
+// pool instead of a fresh allocation, bounding allocation churn and peak
+// memory during scans of large buckets. The value passed to fn is only valid
+// during that call: the buffer is wiped and returned to the pool as soon as
+// fn returns, so fn must copy anything it retains. Keys are valid for the
+// life of the transaction, as with ForEach. Compressed and external values
+// still need an allocation of their own. Nested buckets are skipped.
+func (sb *SecureBucket) ForEachPooled(pool BufferPool, fn func(k, v []byte) error) error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	c := sb.cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		buf := pool.Get()[:0]
+		rec, plaintext, err := sb.openFullInto(buf, k, v)
+		if err != nil {
+			releasePooled(pool, buf, plaintext, len(v))
+			return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		err = fn(k, rec.value)
+		releasePooled(pool, buf, plaintext, len(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releasePooled wipes a buffer taken from pool and returns it, keeping the
+// plaintext's storage instead when decryption had to grow it. Decryption
+// writes at most storedLen bytes to buf, including intermediate plaintext
+// such as compressed data.
+func releasePooled(pool BufferPool, buf, plaintext []byte, storedLen int) {
+	memguard.WipeBytes(plaintext)
+	memguard.WipeBytes(buf[:min(storedLen, cap(buf))])
+	if cap(plaintext) > cap(buf) {
+		buf = plaintext
+	}
+	pool.Put(buf[:0])
+}
@@ -0,0 +1,87 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// countingPool is a BufferPool that hands out a single buffer and counts
+// how often it is taken.
+type countingPool struct {
+	buf  []byte
+	gets int
+	puts int
+}
+
+func (p *countingPool) Get() []byte {
+	p.gets++
+	return p.buf
+}
+
+func (p *countingPool) Put(buf []byte) {
+	p.puts++
+	p.buf = buf
+}
+
+func TestForEachPooled(t *testing.T) {
+	filename := "test_foreach_pooled.db"
+	password := "secure-test-password"
+	bucketName := []byte("ScanBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	entries := map[string][]byte{
+		"a": []byte("short"),
+		"b": bytes.Repeat([]byte("long value "), 100),
+		"c": {},
+		"d": []byte("another"),
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.PutAll(entries)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	pool := &countingPool{}
+	var last []byte
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.ForEachPooled(pool, func(k, v []byte) error {
+			if want := entries[string(k)]; !bytes.Equal(v, want) {
+				return fmt.Errorf("value of %q is %q, expected %q", k, v, want)
+			}
+			last = v
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("ForEachPooled failed: %v", err)
+	}
+	if pool.gets != len(entries) || pool.puts != len(entries) {
+		t.Fatalf("Pool used %d gets and %d puts, expected %d each", pool.gets, pool.puts, len(entries))
+	}
+
+	// The buffer grew to the largest value and was wiped after each callback
+	if cap(pool.buf) < len(entries["b"]) {
+		t.Fatalf("Pool buffer has capacity %d, expected at least %d", cap(pool.buf), len(entries["b"]))
+	}
+	if !bytes.Equal(last, make([]byte, len(last))) {
+		t.Fatalf("Pooled value was not wiped after the callback")
+	}
+}
@@ -0,0 +1,94 @@
+package securebolt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"time"
+)
+
+// receiptSubkeyInfo is the HKDF info of the key that signs receipts.
+const receiptSubkeyInfo = "securebolt receipt"
+
+// A receipt is the issue time in Unix nanoseconds followed by an
+// HMAC-SHA256 over the bucket, key, time and plaintext.
+const (
+	receiptTimeLength = 8
+	receiptLength     = receiptTimeLength + sha256.Size
+)
+
+// GetWithReceipt returns the value of key together with a receipt proving
+// that the bucket held exactly this value under this key when the receipt
+// was issued. The receipt is an HMAC under a key derived from the master key,
+// so it can be archived outside the database and later checked with
+// VerifyReceipt by anyone who can open the database, even after the record
+// has changed or been deleted. It reveals nothing about the value on its own.
+// A missing key returns a nil value and a nil receipt.
+func (sb *SecureBucket) GetWithReceipt(key []byte) (value []byte, receipt []byte, err error) {
+	value, err = sb.Get(key)
+	if err != nil || value == nil {
+		return nil, nil, err
+	}
+	issued := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	mac, err := sb.receiptMAC(key, value, issued)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, append(issued, mac...), nil
+}
+
+// VerifyReceipt checks that receipt was issued by GetWithReceipt for this
+// bucket, key and value. It returns ErrInvalidReceipt when it was not.
+func (sb *SecureBucket) VerifyReceipt(key, value, receipt []byte) error {
+	if err := sb.checkKey(key); err != nil {
+		return err
+	}
+	if len(receipt) != receiptLength {
+		return ErrInvalidReceipt
+	}
+	mac, err := sb.receiptMAC(key, value, receipt[:receiptTimeLength])
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, receipt[receiptTimeLength:]) {
+		return ErrInvalidReceipt
+	}
+	return nil
+}
+
+// ReceiptTime returns the time a receipt was issued. The time is only
+// trustworthy once VerifyReceipt has accepted the receipt.
+func ReceiptTime(receipt []byte) (time.Time, error) {
+	if len(receipt) != receiptLength {
+		return time.Time{}, ErrInvalidReceipt
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(receipt))), nil
+}
+
+// receiptMAC computes the receipt HMAC for a record at the given issue time.
+func (sb *SecureBucket) receiptMAC(key, value, issued []byte) ([]byte, error) {
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	// The write or read lock held by the transaction keeps the key material stable
+	keyLock, err := sb.tx.db.keys().deriveSubkey(receiptSubkeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+
+	mac := hmac.New(sha256.New, keyLock.Bytes())
+	writeField(mac, sb.name)
+	writeField(mac, key)
+	mac.Write(issued)
+	mac.Write(value)
+	return mac.Sum(nil), nil
+}
+
+// writeField writes a length-prefixed field so that adjacent fields cannot
+// be shifted into one another.
+func writeField(h hash.Hash, field []byte) {
+	h.Write(binary.AppendUvarint(nil, uint64(len(field))))
+	h.Write(field)
+}
@@ -0,0 +1,75 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReceipts(t *testing.T) {
+	filename := "test_receipt.db"
+	password := "secure-test-password"
+	bucketName := []byte("HoldBucket")
+	key := []byte("record")
+	value := []byte("contract v1")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	var receipt []byte
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key, value); err != nil {
+			return err
+		}
+		_, receipt, err = b.GetWithReceipt(key)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if issued, err := ReceiptTime(receipt); err != nil || time.Since(issued) > time.Minute {
+		t.Fatalf("Unexpected receipt time %v: %v", issued, err)
+	}
+	db.Close()
+
+	// Receipts verify across reopen, independent of the live record
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.VerifyReceipt(key, value, receipt); err != nil {
+			t.Fatalf("Valid receipt rejected: %v", err)
+		}
+		if err := b.VerifyReceipt(key, []byte("contract v2"), receipt); !errors.Is(err, ErrInvalidReceipt) {
+			t.Fatalf("Expected ErrInvalidReceipt for altered value, got %v", err)
+		}
+		if err := b.VerifyReceipt([]byte("other"), value, receipt); !errors.Is(err, ErrInvalidReceipt) {
+			t.Fatalf("Expected ErrInvalidReceipt for other key, got %v", err)
+		}
+		forged := append([]byte{}, receipt...)
+		forged[0] ^= 1 // Backdate the receipt
+		if err := b.VerifyReceipt(key, value, forged); !errors.Is(err, ErrInvalidReceipt) {
+			t.Fatalf("Expected ErrInvalidReceipt for altered time, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to verify receipts: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// rewriteBatchSize is the number of values RefreshNonces and
+// MigrateCiphertextFormat visit per write transaction.
+const rewriteBatchSize = 1000
+
+// RefreshNonces decrypts and re-encrypts every encrypted value in the
+// database under a fresh random nonce and returns how many were rewritten.
+// The key stays the same, so this is a remediation for a suspected weakness
+// of the nonce random source rather than a rekey, except that values
+// written before Options.AutoRotateOnLimit rotated the key move to the
+// current one. Values keep their flags,
+// expiry, signature, padding and insertion order; values in the legacy
+// layout are rewritten as envelopes. Large values stored in the external
+// bucket, the internal configuration buckets and nested buckets at any depth
+// are refreshed too.
+//
+// The work is split into write transactions of rewriteBatchSize values so a
+// large database does not need one huge transaction. If an error occurs,
+// the batches committed before it stay refreshed and running RefreshNonces
+// again is safe.
+func (s *SecureBolt) RefreshNonces() (int, error) {
+	n, _, err := s.rewriteValues(func(stx *SecureTx, stored []byte, bind *binding) ([]byte, error) {
+		if err := stx.chargeKeyUsage(len(stored)); err != nil {
+			return nil, err
+		}
+		return resealEnvelope(stored, stx.aead, bind)
+	})
+	return n, err
+}
+
+// MigrateCiphertextFormat rewrites every value still stored in the legacy
+// layout, a bare nonce followed by the ciphertext, as a versioned envelope
+// under the same key. Values already in the envelope format are left
+// untouched. It returns how many values were migrated and how many were
+// already current. Legacy values are read transparently, so migrating is
+// never required; it lets an existing database be brought to the current
+// format at a chosen time. It visits the same values as RefreshNonces, in
+// batches of write transactions, and can safely be run again after an error.
+func (s *SecureBolt) MigrateCiphertextFormat() (migrated int, alreadyCurrent int, err error) {
+	migrated, visited, err := s.rewriteValues(func(stx *SecureTx, stored []byte, bind *binding) ([]byte, error) {
+		plaintext, _, legacy, err := openEnvelopeFormat(stored, stx.aead, bind)
+		if err != nil || !legacy {
+			return nil, err
+		}
+		if err := stx.chargeKeyUsage(len(plaintext)); err != nil {
+			return nil, err
+		}
+		return sealEnvelope(plaintext, stx.aead, 0, nil)
+	})
+	return migrated, visited - migrated, err
+}
+
+// rewriteFunc returns the new stored form of a value, or nil to leave it
+// unchanged. bind is the binding the value was sealed with.
+type rewriteFunc func(stx *SecureTx, stored []byte, bind *binding) ([]byte, error)
+
+// rewriteValues calls rewrite for every encrypted value in the user buckets
+// and in the internal buckets holding encrypted values, in write
+// transactions of rewriteBatchSize values. It returns the number of values
+// rewritten and the number visited.
+func (s *SecureBolt) rewriteValues(rewrite rewriteFunc) (rewritten, visited int, err error) {
+	var names [][]byte
+	err = s.View(func(tx *SecureTx) error {
+		names, err = tx.encryptedBucketNames()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, name := range names {
+		var after []byte
+		for {
+			var n, seen int
+			err := s.Update(func(tx *SecureTx) error {
+				var err error
+				n, seen, after, err = tx.rewriteBatch(name, after, rewrite)
+				return err
+			})
+			if err != nil {
+				return rewritten, visited, err
+			}
+			rewritten += n
+			visited += seen
+			if after == nil {
+				break
+			}
+		}
+	}
+	return rewritten, visited, nil
+}
+
+// encryptedBucketNames returns the names of the internal buckets holding
+// encrypted values and the internal names of the user buckets, nested
+// buckets included.
+func (stx *SecureTx) encryptedBucketNames() ([][]byte, error) {
+	var names [][]byte
+	err := stx.tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+		if bytes.Equal(name, externalBucket) ||
+			bytes.Equal(name, configBucket) ||
+			bytes.Equal(name, bucketConfigBucket) {
+			names = append(names, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = stx.walkUserBuckets(func(sb *SecureBucket) error {
+		names = append(names, append([]byte{}, sb.name...))
+		return nil
+	})
+	return names, err
+}
+
+// readBatch returns copies of up to rewriteBatchSize values of the named
+// bucket that sort after the key after, or from the start when after is nil,
+// together with the key to continue after, which is nil once the bucket is
+// done. name is an internal bucket name as returned by encryptedBucketNames.
+// A bucket that does not exist is done.
+func (stx *SecureTx) readBatch(name, after []byte) ([]KV, []byte) {
+	sb := stx.bucketNamed(name)
+	if sb == nil {
+		return nil, nil
+	}
+
+	var batch []KV
+	c := sb.bucket.Cursor()
+	var k, v []byte
+	if after == nil {
+		k, v = nextValue(c, true)
+	} else {
+		k, v = c.Seek(after)
+		if bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+		for k != nil && v == nil {
+			k, v = c.Next()
+		}
+	}
+	for ; k != nil && len(batch) < rewriteBatchSize; k, v = nextValue(c, false) {
+		batch = append(batch, KV{Key: append([]byte{}, k...), Value: append([]byte{}, v...)})
+	}
+	if len(batch) < rewriteBatchSize {
+		return batch, nil
+	}
+	return batch, batch[len(batch)-1].Key
+}
+
+// rewriteBatch applies rewrite to the values of the named bucket returned by
+// readBatch. It returns the number of values rewritten and visited and the
+// key to continue after, or nil once the bucket is done.
+func (stx *SecureTx) rewriteBatch(name, after []byte, rewrite rewriteFunc) (int, int, []byte, error) {
+	batch, next := stx.readBatch(name, after)
+	sb := stx.bucketNamed(name) // Only nil when the batch is empty
+	n := 0
+	for _, e := range batch {
+		var bind *binding
+		switch {
+		case bytes.Equal(name, bucketConfigBucket):
+			bind = &binding{bucket: e.Key, key: bucketConfigKey}
+		case bytes.Equal(name, externalBucket):
+			bind = externalBinding(e.Key)
+		case bytes.Equal(name, configBucket),
+			bytes.HasPrefix(name, nestedBucketPrefix),
+			!bytes.HasPrefix(name, reservedPrefix):
+			bind = &binding{bucket: name, key: e.Key}
+		}
+		sealed, err := rewrite(stx, e.Value, bind)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to rewrite value for key %q in bucket %q: %w", e.Key, name, err)
+		}
+		if sealed == nil {
+			continue
+		}
+		if err := sb.bucket.Put(e.Key, sealed); err != nil {
+			return 0, 0, nil, err
+		}
+		n++
+	}
+	return n, len(batch), next, nil
+}
+
+// AuditNonces checks that no two encrypted values in the database share a
+// nonce, which would break the confidentiality guarantees of AES-GCM, and
+// returns how many values reuse a nonce already seen. Nothing is decrypted.
+// It visits the same values as RefreshNonces, in read transactions of
+// rewriteBatchSize values so that writers are not held off for the whole
+// scan; values written during the audit may or may not be included. Run
+// RefreshNonces if the count is not zero.
+func (s *SecureBolt) AuditNonces() (int, error) {
+	var names [][]byte
+	err := s.View(func(tx *SecureTx) error {
+		var err error
+		names, err = tx.encryptedBucketNames()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]struct{})
+	reused := 0
+	for _, name := range names {
+		var after []byte
+		for {
+			err := s.View(func(tx *SecureTx) error {
+				nonceSize := tx.aead.NonceSize()
+				var batch []KV
+				batch, after = tx.readBatch(name, after)
+				for _, e := range batch {
+					nonce := e.Value
+					if _, _, n, _, ok := parseEnvelope(e.Value, nonceSize); ok {
+						nonce = n
+					} else if len(nonce) > nonceSize {
+						nonce = nonce[:nonceSize] // Legacy layout
+					}
+					if _, dup := seen[string(nonce)]; dup {
+						reused++
+					}
+					seen[string(nonce)] = struct{}{}
+				}
+				return nil
+			})
+			if err != nil {
+				return reused, err
+			}
+			if after == nil {
+				break
+			}
+		}
+	}
+	return reused, nil
+}
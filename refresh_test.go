@@ -0,0 +1,248 @@
+package securebolt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRefreshNonces(t *testing.T) {
+	filename := "test_refresh_nonces.db"
+	password := "secure-test-password"
+	bucketName := []byte("Secrets")
+	count := rewriteBatchSize + 10 // Spans two batches
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalThreshold: 64})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 100)
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.SetCompression(CompressionDeflate); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%05d", i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+				return err
+			}
+		}
+		if err := b.Put([]byte("large"), large); err != nil {
+			return err
+		}
+		return b.PutWithTTL([]byte("expiring"), []byte("soon"), time.Hour)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	if err := db.PutConfig([]byte("schema"), []byte("3")); err != nil {
+		t.Fatalf("Failed to put config: %v", err)
+	}
+
+	snapshot := func() map[string][]byte {
+		stored := make(map[string][]byte)
+		err := db.View(func(tx *SecureTx) error {
+			return tx.Bolt().Bucket(bucketName).ForEach(func(k, v []byte) error {
+				stored[string(k)] = append([]byte{}, v...)
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("Failed to read stored values: %v", err)
+		}
+		return stored
+	}
+	before := snapshot()
+
+	n, err := db.RefreshNonces()
+	if err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+	// Every user value, the external payload, the config and the bucket settings
+	if want := count + 2 + 3; n != want {
+		t.Fatalf("Refreshed %d values, expected %d", n, want)
+	}
+
+	for k, v := range snapshot() {
+		if bytes.Equal(v, before[k]) {
+			t.Fatalf("Stored value of %q was not re-encrypted", k)
+		}
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			v, err := b.Get([]byte(fmt.Sprintf("key%05d", i)))
+			if err != nil {
+				return err
+			}
+			if want := fmt.Sprintf("value%d", i); string(v) != want {
+				t.Fatalf("key%05d = %q, expected %q", i, v, want)
+			}
+		}
+		if v, err := b.Get([]byte("large")); err != nil || !bytes.Equal(v, large) {
+			t.Fatalf("Large value did not survive the refresh: %q, %v", v, err)
+		}
+		if v, err := b.Get([]byte("expiring")); err != nil || string(v) != "soon" {
+			t.Fatalf("Expiring value did not survive the refresh: %q, %v", v, err)
+		}
+		if ok, err := b.compresses(); err != nil || !ok {
+			t.Fatalf("Bucket settings did not survive the refresh: %v, %v", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read refreshed values: %v", err)
+	}
+	if v, err := db.GetConfig([]byte("schema")); err != nil || string(v) != "3" {
+		t.Fatalf("Config did not survive the refresh: %q, %v", v, err)
+	}
+}
+
+func TestMigrateCiphertextFormat(t *testing.T) {
+	filename := "test_migrate_format.db"
+	password := "secure-test-password"
+	bucketName := []byte("Mixed")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("current%d", i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+				return err
+			}
+		}
+		// Write values the way versions before the envelope did
+		raw := tx.Bolt().Bucket(bucketName)
+		for i := 0; i < 5; i++ {
+			nonce := make([]byte, tx.aead.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return err
+			}
+			legacy := tx.aead.Seal(nonce, nonce, []byte(fmt.Sprintf("value%d", i)), nil)
+			if err := raw.Put([]byte(fmt.Sprintf("legacy%d", i)), legacy); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	migrated, current, err := db.MigrateCiphertextFormat()
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	// The settings record of the bucket is current as well
+	if migrated != 5 || current != 4 {
+		t.Fatalf("Migrated %d and found %d current, expected 5 and 4", migrated, current)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 5; i++ {
+			key := []byte(fmt.Sprintf("legacy%d", i))
+			_, _, legacy, err := openEnvelopeFormat(tx.Bolt().Bucket(bucketName).Get(key), tx.aead, nil)
+			if err != nil || legacy {
+				t.Fatalf("%s was not migrated: legacy=%v, err=%v", key, legacy, err)
+			}
+			v, err := b.Get(key)
+			if err != nil {
+				return err
+			}
+			if want := fmt.Sprintf("value%d", i); string(v) != want {
+				t.Fatalf("%s = %q after migration, expected %q", key, v, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read migrated values: %v", err)
+	}
+
+	// A second run finds nothing left to migrate
+	migrated, current, err = db.MigrateCiphertextFormat()
+	if err != nil {
+		t.Fatalf("Failed to migrate again: %v", err)
+	}
+	if migrated != 0 || current != 9 {
+		t.Fatalf("Second run migrated %d and found %d current, expected 0 and 9", migrated, current)
+	}
+}
+
+func TestAuditNonces(t *testing.T) {
+	filename := "test_audit_nonces.db"
+	password := "secure-test-password"
+	bucketName := []byte("Secrets")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < rewriteBatchSize+10; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%05d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	if n, err := db.AuditNonces(); err != nil || n != 0 {
+		t.Fatalf("AuditNonces() = %d, %v, expected 0", n, err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		raw := tx.Bolt().Bucket(bucketName)
+		return raw.Put([]byte("copy"), append([]byte{}, raw.Get([]byte("key00000"))...))
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy ciphertext: %v", err)
+	}
+	if n, err := db.AuditNonces(); err != nil || n != 1 {
+		t.Fatalf("AuditNonces() = %d, %v, expected 1", n, err)
+	}
+
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+	if n, err := db.AuditNonces(); err != nil || n != 0 {
+		t.Fatalf("AuditNonces() after RefreshNonces = %d, %v, expected 0", n, err)
+	}
+}
@@ -0,0 +1,132 @@
+package securebolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelScan splits the keys of the named bucket into at most ranges
+// contiguous shards of about the same size and scans them concurrently, each
+// in its own goroutine with its own read transaction and cursor. fn is called
+// with the shard number, from 0, and each key and decrypted value of the
+// shard in key order; it is called from several goroutines at once and must
+// be safe for concurrent use. Values are fresh allocations the caller may
+// retain, while keys are only valid for the duration of the call.
+//
+// Writes wait until the scan is done, so every shard sees the same version
+// of the database; fn must therefore not start transactions of its own,
+// which could wait on it. Nested buckets and tombstones are skipped, as with
+// ForEach. The first error, from fn or from decrypting a value, stops the
+// other shards and is returned.
+//
+// The shards run under the read lock taken here rather than each taking
+// their own, so s.db is the same handle for the whole scan only because every
+// path that replaces it, such as compactOnline, holds s.mu for writing. Any
+// new path that swaps s.db must do the same.
+func (s *SecureBolt) ParallelScan(bucket []byte, ranges int, fn func(shard int, k, v []byte) error) error {
+	if ranges <= 0 {
+		return errors.New("ranges must be positive")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
+
+	var starts [][]byte
+	err := s.viewLocked(func(tx *SecureTx) error {
+		var err error
+		starts, err = shardStarts(tx, bucket, ranges)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		stopped  atomic.Bool
+	)
+	fail := func(err error) {
+		once.Do(func() { firstErr = err })
+		stopped.Store(true)
+	}
+	for shard, start := range starts {
+		var end []byte
+		if shard+1 < len(starts) {
+			end = starts[shard+1]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.viewLocked(func(tx *SecureTx) error {
+				b, err := tx.Bucket(bucket)
+				if err != nil {
+					return err
+				}
+				c := b.cursor()
+				k, v := c.Seek(start)
+				for ; k != nil && (end == nil || bytes.Compare(k, end) < 0); k, v = nextValue(c, false) {
+					if stopped.Load() {
+						return nil
+					}
+					rec, err := b.openFull(k, v)
+					if err != nil {
+						return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+					}
+					if rec.deleted != 0 {
+						continue
+					}
+					if err := fn(shard, k, rec.value); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// shardStarts returns copies of the first key of each of at most ranges
+// shards of about the same number of values in the named bucket. It walks
+// the keys without decrypting any value.
+func shardStarts(tx *SecureTx, bucket []byte, ranges int) ([][]byte, error) {
+	b, err := tx.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	c := b.cursor()
+	var n int
+	for k, _ := nextValue(c, true); k != nil; k, _ = nextValue(c, false) {
+		n++
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if ranges > n {
+		ranges = n
+	}
+
+	starts := make([][]byte, 0, ranges)
+	var i int
+	for k, _ := nextValue(c, true); k != nil; k, _ = nextValue(c, false) {
+		if i == len(starts)*n/ranges {
+			starts = append(starts, append([]byte{}, k...))
+			if len(starts) == ranges {
+				break
+			}
+		}
+		i++
+	}
+	return starts, nil
+}
@@ -0,0 +1,154 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelScan(t *testing.T) {
+	filename := "test_parallel_scan.db"
+	password := "secure-test-password"
+	bucketName := []byte("Events")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	const count = 100
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i))); err != nil {
+				return err
+			}
+		}
+		if _, err := b.CreateBucketIfNotExists([]byte("nested")); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	last := make(map[int]string)
+	err = db.ParallelScan(bucketName, 4, func(shard int, k, v []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(v) != "value-"+string(k[len("key-"):]) {
+			t.Errorf("Unexpected value %q for key %q", v, k)
+		}
+		if prev, ok := last[shard]; ok && prev >= string(k) {
+			t.Errorf("Shard %d returned %q after %q", shard, k, prev)
+		}
+		last[shard] = string(k)
+		seen[string(k)]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan bucket: %v", err)
+	}
+	if len(seen) != count {
+		t.Errorf("Expected %d keys, got %d", count, len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("Key %q was scanned %d times", k, n)
+		}
+	}
+	if len(last) != 4 {
+		t.Errorf("Expected 4 shards, got %d", len(last))
+	}
+
+	errStop := errors.New("stop")
+	err = db.ParallelScan(bucketName, 4, func(shard int, k, v []byte) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+
+	if err := db.ParallelScan([]byte("Missing"), 4, func(int, []byte, []byte) error { return nil }); err == nil {
+		t.Errorf("Expected an error for a missing bucket")
+	}
+	if err := db.ParallelScan(bucketName, 0, func(int, []byte, []byte) error { return nil }); err == nil {
+		t.Errorf("Expected an error for zero ranges")
+	}
+}
+
+func TestParallelScanStopsOnError(t *testing.T) {
+	filename := "test_parallel_scan_stop.db"
+	password := "secure-test-password"
+	bucketName := []byte("Events")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	const count, ranges = 1000, 4
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	// Shard 0 fails on its first key. The other shards wait for it on their
+	// first key, if they get that far, so each would still have most of its
+	// keys left if the failure did not stop it
+	errStop := errors.New("stop")
+	failed := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	calls := make(map[int]int)
+	err = db.ParallelScan(bucketName, ranges, func(shard int, k, v []byte) error {
+		mu.Lock()
+		calls[shard]++
+		n := calls[shard]
+		mu.Unlock()
+		if shard == 0 {
+			once.Do(func() { close(failed) })
+			return errStop
+		}
+		if n == 1 {
+			<-failed
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	if calls[0] != 1 {
+		t.Errorf("Expected the failing shard to stop after 1 call, got %d", calls[0])
+	}
+	for shard := 1; shard < ranges; shard++ {
+		if n := calls[shard]; n >= count/ranges/2 {
+			t.Errorf("Expected shard %d to stop early after the error, got %d calls", shard, n)
+		}
+	}
+}
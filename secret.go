@@ -0,0 +1,32 @@
+package securebolt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// GetOrCreateSecret returns the secret stored under key, generating and
+// storing byteLen random bytes first when the key is absent. Called within
+// Update, the check and the write happen in the same transaction, so
+// concurrent callers all get the same secret. An existing secret is returned
+// as is, even if its length differs from byteLen. Within View it returns an
+// existing secret and fails for an absent key.
+func (sb *SecureBucket) GetOrCreateSecret(key []byte, byteLen int) ([]byte, error) {
+	if byteLen <= 0 {
+		return nil, errors.New("secret length must be positive")
+	}
+	secret, err := sb.Get(key)
+	if err != nil || secret != nil {
+		return secret, err
+	}
+
+	secret = make([]byte, byteLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	if err := sb.put(key, append([]byte{}, secret...), nil, 0); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
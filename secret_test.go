@@ -0,0 +1,67 @@
+package securebolt
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGetOrCreateSecret(t *testing.T) {
+	filename := "test_secret.db"
+	password := "secure-test-password"
+	bucketName := []byte("Secrets")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	getOrCreate := func() []byte {
+		var secret []byte
+		err := db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			secret, err = b.GetOrCreateSecret([]byte("session-key"), 32)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("GetOrCreateSecret failed: %v", err)
+		}
+		return secret
+	}
+
+	first := getOrCreate()
+	if len(first) != 32 {
+		t.Fatalf("Secret has %d bytes, expected 32", len(first))
+	}
+	if bytes.Equal(first, make([]byte, 32)) {
+		t.Fatalf("Secret is all zeros")
+	}
+	if second := getOrCreate(); !bytes.Equal(first, second) {
+		t.Fatalf("Second call returned a different secret")
+	}
+
+	// A read-only transaction returns the stored secret but cannot create one
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		secret, err := b.GetOrCreateSecret([]byte("session-key"), 32)
+		if err != nil || !bytes.Equal(secret, first) {
+			t.Fatalf("View returned %x, %v, expected the stored secret", secret, err)
+		}
+		if _, err := b.GetOrCreateSecret([]byte("other-key"), 32); err == nil {
+			t.Fatalf("Secret created in a read-only transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+}
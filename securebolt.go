@@ -1,6 +1,7 @@
 package securebolt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -8,64 +9,217 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/awnumar/memguard"
 	"go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
 	"golang.org/x/crypto/argon2"
 )
 
 // SecureBolt wraps a bbolt.DB and manages encryption for SecureBucket.
 type SecureBolt struct {
-	db      *bbolt.DB
+	db     *bbolt.DB                   // Underlying database, only replaced with mu held for writing
+	key    atomic.Pointer[keyMaterial] // Current key material, replaced as a whole on rekey
+	opts   Options                     // Options the database was opened with
+	mu     sync.RWMutex                // Mutex for thread safety
+	closed atomic.Bool                 // Set once Close has been called
+	done   chan struct{}               // Closed when Close completes
+	cache  *valueCache                 // Decrypted values, nil unless Options.CacheSize is set
+	stats  OpenStats                   // Key derivation statistics reported by OpenStats
+
+	metrics metricCounters // Operation counts reported by Metrics
+
+	watchMu  sync.Mutex            // Guards watchers
+	watchers map[*watcher]struct{} // Subscriptions created by SecureBucket.Watch
+
+	snapMu    sync.Mutex                   // Guards snapshots
+	snapshots map[*SecureSnapshot]struct{} // Snapshots not yet released
+
+	bufMu            sync.Mutex                          // Guards buffers and buffersDestroyed
+	buffers          map[*memguard.LockedBuffer]struct{} // Secrets Close destroys, such as context keys
+	buffersDestroyed bool                                // Set by Close once buffers are destroyed
+}
+
+// keyMaterial is the key, cipher and salt derived from the password. It is
+// never modified after construction: operations that change the key build a
+// new keyMaterial and install it with swapKeys, and every transaction loads
+// the pointer once, so a transaction never mixes an old cipher with a new key.
+type keyMaterial struct {
 	keyLock *memguard.LockedBuffer // Encryption key securely stored in memguard
 	aead    cipher.AEAD            // AES-GCM cipher for encryption/decryption
 	salt    []byte                 // Salt used for key derivation
-	mu      sync.RWMutex           // Mutex for thread safety
 }
 
+// keys returns the current key material.
+func (s *SecureBolt) keys() *keyMaterial {
+	return s.key.Load()
+}
+
+// swapKeys installs new key material and destroys the previous key. The
+// caller must hold the write lock, so that no transaction is still using the
+// previous key when it is destroyed.
+func (s *SecureBolt) swapKeys(km *keyMaterial) {
+	if old := s.key.Swap(km); old != nil {
+		old.keyLock.Destroy()
+	}
+}
+
+var (
+	reservedPrefix    = []byte("securebolt_")     // Prefix of the buckets used internally
+	metaBucket        = []byte("securebolt_meta") // Bucket holding unencrypted metadata
+	saltKey           = []byte("salt")            // Key of the salt within metaBucket
+	insertionOrderKey = []byte("insertion_order") // Present when values carry an insertion sequence
+	tagSizeKey        = []byte("tag_size")        // GCM tag size, when not the standard one
+	externalSaltKey   = []byte("external_salt")   // Present when the salt is supplied by the caller
+)
+
+// saltLength is the size of generated salts and the minimum size of external salts.
+const saltLength = 16
+
+// GCM tag sizes accepted by Options.TagSize.
+const (
+	gcmMinTagSize      = 12
+	gcmStandardTagSize = 16
+)
+
 func init() {
 	memguard.CatchInterrupt()
 }
 
+// Open opens or creates the database at filename using the default options.
 func Open(filename string, mode fs.FileMode, password []byte) (*SecureBolt, error) {
+	return OpenWithOptions(filename, mode, password, nil)
+}
+
+// OpenWithOptions opens or creates the database at filename, configured by opts.
+// A nil opts is equivalent to calling Open.
+func OpenWithOptions(filename string, mode fs.FileMode, password []byte, opts *Options) (*SecureBolt, error) {
+	if len(password) == 0 {
+		return nil, errors.New("password cannot be empty")
+	}
+	if err := checkPasswordStrength(password, opts); err != nil {
+		return nil, err
+	}
+	return open(filename, mode, opts, nil, func(db *bbolt.DB, salt []byte, isNewDB bool) ([]byte, error) {
+		if err := requireNotSplit(db); err != nil {
+			return nil, err
+		}
+		return password, nil
+	})
+}
+
+// keySource produces the secret used as Argon2 input once the salt of the
+// database is known. open wipes the returned secret after key derivation.
+type keySource func(db *bbolt.DB, salt []byte, isNewDB bool) ([]byte, error)
+
+// open opens or creates the database at filename and derives its encryption
+// key from the secret provided by source. When group is not nil the database
+// joins it: it must use the group's salt, new databases are created with it,
+// and the key is derived only if the group has none yet.
+func open(filename string, mode fs.FileMode, opts *Options, group *groupKey, source keySource) (*SecureBolt, error) {
 
 	// Validate inputs
 	if filename == "" {
 		return nil, errors.New("filename cannot be empty")
 	}
-	if len(password) == 0 {
-		return nil, errors.New("password cannot be empty")
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.ExternalSalt != nil && len(opts.ExternalSalt) < saltLength {
+		return nil, fmt.Errorf("external salt must be at least %d bytes", saltLength)
+	}
+	if opts.AutoCompactThreshold < 0 || opts.AutoCompactThreshold > 1 {
+		return nil, errors.New("auto-compact threshold must be between 0 and 1")
+	}
+	if opts.MaxBytesPerKey < 0 {
+		return nil, errors.New("key usage limit cannot be negative")
+	}
+	if opts.DatabaseID != nil && len(opts.DatabaseID) == 0 {
+		return nil, errors.New("database ID cannot be empty")
+	}
+	if opts.TagSize != 0 && (opts.TagSize < gcmMinTagSize || opts.TagSize > gcmStandardTagSize) {
+		return nil, fmt.Errorf("tag size must be between %d and %d bytes", gcmMinTagSize, gcmStandardTagSize)
 	}
 
 	var isNewDB bool
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		isNewDB = true
 	}
+	if isNewDB && opts.ReadOnly {
+		return nil, fmt.Errorf("cannot create %q in read-only mode", filename)
+	}
+
+	if opts.LockMemory {
+		if !lockMemorySupported {
+			return nil, errors.New("locking database memory is not supported on this platform")
+		}
+		warnMemlockLimit(filename, opts)
+	}
 
 	// Open the BoltDB file with the provided file mode
-	db, err := bbolt.Open(filename, mode, nil)
+	db, err := bbolt.Open(filename, mode, opts.boltOptions())
+	if errors.Is(err, berrors.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %w", ErrFileLocked, err)
+	}
+	if errors.Is(err, berrors.ErrInvalid) || errors.Is(err, berrors.ErrVersionMismatch) || errors.Is(err, berrors.ErrChecksum) {
+		return nil, fmt.Errorf("%w: %w", ErrNotADatabase, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open BoltDB: %w", err)
 	}
+	if opts.StrictFileMode {
+		if err := checkFileMode(filename, mode); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if opts.AutoCompactThreshold > 0 && !isNewDB && !opts.ReadOnly {
+		if db, err = compactIfFragmented(db, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// A file that holds no data at all was left behind by a creation that
+	// was interrupted before the salt was stored; initialize it as a new one.
+	if !isNewDB && !opts.ReadOnly {
+		uninitialized, err := isUninitialized(db)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to inspect database: %w", err)
+		}
+		isNewDB = uninitialized
+	}
 
 	var salt []byte
 
-	if isNewDB {
-		// Generate a new random salt
-		salt = make([]byte, 16)
-		if _, err := rand.Read(salt); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("failed to generate salt: %w", err)
+	if opts.ExternalSalt != nil {
+		// Use the caller-provided salt; nothing is stored in the database
+		salt = append([]byte{}, opts.ExternalSalt...)
+	} else if isNewDB {
+		if group != nil && group.salt != nil {
+			// Share the salt of the group the database is created in
+			salt = append([]byte{}, group.salt...)
+		} else {
+			// Generate a new random salt
+			salt = make([]byte, saltLength)
+			if _, err := rand.Read(salt); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("failed to generate salt: %w", err)
+			}
 		}
 
 		// Store the salt in a dedicated bucket
 		err = db.Update(func(tx *bbolt.Tx) error {
-			b, err := tx.CreateBucketIfNotExists([]byte("securebolt_meta"))
+			b, err := tx.CreateBucketIfNotExists(metaBucket)
 			if err != nil {
 				return err
 			}
-			return b.Put([]byte("salt"), salt)
+			return b.Put(saltKey, salt)
 		})
 		if err != nil {
 			db.Close()
@@ -74,11 +228,14 @@ func Open(filename string, mode fs.FileMode, password []byte) (*SecureBolt, erro
 	} else {
 		// Retrieve the salt from the database
 		err = db.View(func(tx *bbolt.Tx) error {
-			b := tx.Bucket([]byte("securebolt_meta"))
+			b := tx.Bucket(metaBucket)
 			if b == nil {
 				return errors.New("metadata bucket not found")
 			}
-			s := b.Get([]byte("salt"))
+			if b.Get(externalSaltKey) != nil {
+				return ErrExternalSaltRequired
+			}
+			s := b.Get(saltKey)
 			if s == nil {
 				return errors.New("salt not found in metadata")
 			}
@@ -91,80 +248,381 @@ func Open(filename string, mode fs.FileMode, password []byte) (*SecureBolt, erro
 		}
 	}
 
-	// Derive encryption key using Argon2id
-	// Use password directly as []byte
-	keyLock, err := deriveKey(password, salt)
+	if group != nil && group.salt != nil && !bytes.Equal(salt, group.salt) {
+		db.Close()
+		return nil, fmt.Errorf("%q does not share the salt of the group", filename)
+	}
+
+	// Settings that change the stored value format are fixed at creation
+	if err := initFormat(db, opts, isNewDB); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	secret, err := source(db, salt, isNewDB)
 	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to derive key: %w", err)
+		return nil, err
+	}
+	if len(opts.Pepper) > 0 {
+		peppered := pepperSecret(secret, opts.Pepper)
+		memguard.WipeBytes(secret)
+		secret = peppered
+	}
+
+	// Derive encryption key using Argon2id, unless the group already did
+	var keyLock *memguard.LockedBuffer
+	var kdfDuration time.Duration
+	if group != nil && group.keyLock != nil {
+		keyLock = cloneKey(group.keyLock)
+	} else {
+		started := time.Now()
+		keyLock, err = deriveKey(secret, salt)
+		kdfDuration = time.Since(started)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		if group != nil {
+			group.salt = append([]byte{}, salt...)
+			group.keyLock = cloneKey(keyLock)
+		}
 	}
-	memguard.WipeBytes(password) // Securely erase the password
+	memguard.WipeBytes(secret) // Securely erase the password
 
 	// Melt the key to access its bytes
 	keyLock.Melt()
 	defer keyLock.Freeze()
 
 	// Initialize AES-GCM
-	block, err := aes.NewCipher(keyLock.Bytes())
+	aead, err := newAEADWithTagSize(keyLock.Bytes(), opts.TagSize)
 	if err != nil {
 		keyLock.Destroy()
 		db.Close()
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, err
+	}
+
+	stats := kdfStats(kdfDuration, keyLock)
+	if opts.StrictSecurity && !stats.KeyLocked {
+		keyLock.Destroy()
+		db.Close()
+		return nil, errors.New("encryption key is not held in locked memory")
 	}
-	aead, err := cipher.NewGCM(block)
+
+	// Reject a wrong password before any value is read
+	km := &keyMaterial{keyLock: keyLock, aead: aead, salt: salt}
+	if err := verifyKeyCheck(db, km, opts, isNewDB); err != nil {
+		keyLock.Destroy()
+		db.Close()
+		return nil, err
+	}
+	if aead, err = withDatabaseID(db, km, opts, isNewDB); err != nil {
+		keyLock.Destroy()
+		db.Close()
+		return nil, err
+	}
+	ring, err := newKeyRing(db, km, aead, opts.TagSize)
 	if err != nil {
 		keyLock.Destroy()
 		db.Close()
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
+	}
+	km = &keyMaterial{keyLock: keyLock, aead: ring, salt: salt}
+	if err := adoptKeyCheck(db, km, ring, opts); err != nil {
+		keyLock.Destroy()
+		db.Close()
+		return nil, err
 	}
 
 	// Create and return the SecureBolt instance
-	return &SecureBolt{
-		db:      db,
-		aead:    aead,
-		keyLock: keyLock,
-		salt:    salt,
-	}, nil
+	s := &SecureBolt{
+		db:    db,
+		opts:  *opts,
+		done:  make(chan struct{}),
+		cache: newValueCache(opts.CacheSize, opts.CacheTTL),
+		stats: stats,
+	}
+	s.opts.Pepper = nil // Not needed after key derivation; do not retain it
+	s.key.Store(km)
+	if opts.Observer != nil && kdfDuration != 0 {
+		opts.Observer.ObserveKDF(kdfDuration)
+	}
+	return s, nil
+}
+
+// warnMemlockLimit logs a warning when the RLIMIT_MEMLOCK limit is too low
+// for Options.LockMemory to lock the file at filename.
+func warnMemlockLimit(filename string, opts *Options) {
+	limit, ok := memlockLimit()
+	if !ok {
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil || uint64(info.Size()) <= limit {
+		return
+	}
+	opts.logger().Warn("securebolt: RLIMIT_MEMLOCK is below the database size; locking its memory may fail",
+		"file", filename, "size", info.Size(), "limit", limit)
+}
+
+// checkFileMode returns ErrInsecureFilePermissions when the file at filename
+// grants permission bits outside mode.
+func checkFileMode(filename string, mode fs.FileMode) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("failed to stat database file: %w", err)
+	}
+	if extra := info.Mode().Perm() &^ mode.Perm(); extra != 0 {
+		return fmt.Errorf("%w: %q is %v, expected at most %v", ErrInsecureFilePermissions, filename, info.Mode().Perm(), mode.Perm())
+	}
+	return nil
+}
+
+// isUninitialized reports whether db contains no buckets other than an
+// empty metadata bucket.
+func isUninitialized(db *bbolt.DB) (bool, error) {
+	uninitialized := true
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if !bytes.Equal(name, metaBucket) {
+				uninitialized = false
+			} else if k, _ := b.Cursor().First(); k != nil {
+				uninitialized = false
+			}
+			return nil
+		})
+	})
+	return uninitialized, err
+}
+
+// initFormat records the value format settings of a new database in the
+// metadata bucket, or loads them into opts for an existing one.
+func initFormat(db *bbolt.DB, opts *Options, isNewDB bool) error {
+	if isNewDB {
+		settings := make(map[string][]byte)
+		if opts.InsertionOrder {
+			settings[string(insertionOrderKey)] = []byte{1}
+		}
+		if opts.TagSize != 0 {
+			settings[string(tagSizeKey)] = []byte(strconv.Itoa(opts.TagSize))
+		}
+		if opts.ExternalSalt != nil {
+			settings[string(externalSaltKey)] = []byte{1}
+		}
+		if len(settings) == 0 {
+			return nil
+		}
+		err := db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			for k, v := range settings {
+				if err := b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store format settings: %w", err)
+		}
+		return nil
+	}
+
+	var insertionOrder bool
+	var tagSize []byte
+	err := db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(metaBucket); b != nil {
+			insertionOrder = b.Get(insertionOrderKey) != nil
+			if v := b.Get(tagSizeKey); v != nil {
+				tagSize = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read format settings: %w", err)
+	}
+	if opts.InsertionOrder && !insertionOrder {
+		return errors.New("insertion order can only be enabled when the database is created")
+	}
+	opts.InsertionOrder = insertionOrder
+
+	// Databases without a recorded tag size use the one requested, which
+	// allows opening foreign databases written with truncated tags
+	if tagSize != nil {
+		n, err := strconv.Atoi(string(tagSize))
+		if err != nil {
+			return fmt.Errorf("invalid tag size in metadata: %w", err)
+		}
+		if opts.TagSize != 0 && opts.TagSize != n {
+			return fmt.Errorf("database uses %d-byte tags, %d requested", n, opts.TagSize)
+		}
+		opts.TagSize = n
+	}
+	return nil
+}
+
+// newAEAD creates the AES-GCM cipher used to encrypt values under key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	return newAEADWithTagSize(key, 0)
+}
+
+// newAEADWithTagSize creates an AES-GCM cipher producing tagSize-byte tags.
+// A tagSize of zero selects the standard 16-byte tag.
+func newAEADWithTagSize(key []byte, tagSize int) (cipher.AEAD, error) {
+	if tagSize == 0 {
+		tagSize = gcmStandardTagSize
+	}
+	if err := checkKeyLength(len(key)); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aead, err := cipher.NewGCMWithTagSize(block, tagSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// checkKeyLength verifies that n is a valid AES key length (16, 24 or 32
+// bytes), so that a key of the wrong size is reported as such rather than as
+// an opaque cipher construction failure.
+func checkKeyLength(n int) error {
+	switch n {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("%w: got %d bytes, AES requires 16, 24 or 32", ErrInvalidKeyLength, n)
+	}
 }
 
 func deriveKey(password, salt []byte) (*memguard.LockedBuffer, error) {
-	const time = 3
-	const memory = 128 * 1024
-	const threads = 4
-	const keyLength = 32
+	if err := checkKeyLength(kdfKeyLength); err != nil {
+		return nil, err
+	}
+
+	// Argon2 needs its whole memory cost at once; refuse up front rather
+	// than letting the allocation take the process down.
+	if err := checkKDFResources(kdfMemory); err != nil {
+		return nil, err
+	}
 
-	keyLock := memguard.NewBuffer(keyLength)
+	keyLock := memguard.NewBuffer(kdfKeyLength)
 	keyLock.Melt()
 	defer keyLock.Freeze()
 
-	derivedKey := argon2.IDKey(password, salt, time, memory, threads, keyLength)
+	derivedKey := argon2.IDKey(password, salt, kdfTime, kdfMemory, kdfThreads, kdfKeyLength)
 	copy(keyLock.Bytes(), derivedKey)
 	memguard.WipeBytes(derivedKey) // Ensure the derivedKey slice is wiped
 	return keyLock, nil
 }
 
 // Close securely destroys the encryption key and closes the database.
+// Cached plaintext is wiped and the keys of contexts from DeriveContext that
+// were not destroyed yet are destroyed with it, making them unusable.
+// Transactions still running when Close is called are allowed to finish
+// first; any use of the database afterwards returns ErrDBClosed.
 func (s *SecureBolt) Close() error {
-	s.keyLock.Destroy() // Securely destroy the encryption key
+	if !s.closed.CompareAndSwap(false, true) {
+		return ErrDBClosed
+	}
+
+	// Wait for in-flight transactions before the key goes away
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+// closeLocked tears down a database already marked closed, whose s.mu the
+// caller holds for writing.
+func (s *SecureBolt) closeLocked() error {
+	defer close(s.done)
+
+	s.closeWatchers()
+	s.releaseSnapshots()
+	s.cache.purge()
+	s.destroyBuffers()
+	s.keys().keyLock.Destroy() // Securely destroy the encryption key
 	return s.db.Close()
 }
 
+// Checkpoint flushes all committed transactions to stable storage with
+// fdatasync. It is only needed when the database was opened with
+// Options.NoSync, where it marks a point that survives a crash; without
+// NoSync every commit is already synced.
+func (s *SecureBolt) Checkpoint() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
+	return s.db.Sync()
+}
+
+// Reset deletes every bucket in the database except the securebolt_meta
+// bucket, so the database stays usable with the same password. All buckets
+// are deleted within a single write transaction.
+func (s *SecureBolt) Reset() error {
+	return s.Update(func(tx *SecureTx) error {
+		var names [][]byte
+		err := tx.tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			if !bytes.Equal(name, metaBucket) {
+				names = append(names, append([]byte{}, name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.tx.DeleteBucket(name); err != nil {
+				return fmt.Errorf("failed to delete bucket %q: %w", name, err)
+			}
+		}
+		s.cache.purge()
+		return nil
+	})
+}
+
 // SecureTx wraps a bbolt.Tx and provides methods to access SecureBucket.
 type SecureTx struct {
 	tx      *bbolt.Tx
+	db      *SecureBolt
 	aead    cipher.AEAD
 	keyLock *memguard.LockedBuffer
+	changes []ChangeEvent // Changes published once the transaction commits
+	rotate  bool          // Set when the key usage limit was reached; see Options.AutoRotateOnLimit
+
+	snapshot bool // Long-lived transaction of a SecureSnapshot, which bypasses the cache
 }
 
 func (s *SecureBolt) View(fn func(tx *SecureTx) error) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
+	return s.viewLocked(fn)
+}
 
+// viewLocked is View for callers already holding s.mu for reading.
+func (s *SecureBolt) viewLocked(fn func(tx *SecureTx) error) error {
+	km := s.keys()
 	return s.db.View(func(tx *bbolt.Tx) error {
+		if obs := s.opts.Observer; obs != nil {
+			started := time.Now()
+			defer func() { obs.ObserveView(time.Since(started)) }()
+		}
 		return fn(&SecureTx{
 			tx:      tx,
-			aead:    s.aead,
-			keyLock: s.keyLock, // Pass keyLock
+			db:      s,
+			aead:    km.aead,
+			keyLock: km.keyLock, // Pass keyLock
 		})
 	})
 }
@@ -172,44 +630,124 @@ func (s *SecureBolt) View(fn func(tx *SecureTx) error) error {
 func (s *SecureBolt) Update(fn func(tx *SecureTx) error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrDBClosed
+	}
 
-	return s.db.Update(func(tx *bbolt.Tx) error {
-
-		return fn(&SecureTx{
+	km := s.keys()
+	var stx *SecureTx
+	var rotated *keyMaterial
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if obs := s.opts.Observer; obs != nil {
+			started := time.Now()
+			defer func() { obs.ObserveUpdate(time.Since(started)) }()
+		}
+		stx = &SecureTx{
 			tx:      tx,
-			aead:    s.aead,    // Pass AEAD cipher
-			keyLock: s.keyLock, // Pass keyLock
-		})
+			db:      s,
+			aead:    km.aead,    // Pass AEAD cipher
+			keyLock: km.keyLock, // Pass keyLock
+		}
+		if err := fn(stx); err != nil {
+			return err
+		}
+		if stx.rotate {
+			var err error
+			rotated, err = stx.rotateKey(km)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if rotated != nil {
+		s.key.Store(rotated) // The key bytes are shared, so nothing is destroyed
+	}
+
+	// Only committed changes are published
+	s.publishChanges(stx.changes)
+	return nil
+}
+
+// EnsureBuckets creates each named bucket that does not exist yet, all in
+// one write transaction, so the schema is either fully set up or, on error,
+// left as it was. Existing buckets and their contents are left alone, so it
+// is safe to call on every startup. Names using the reserved securebolt_
+// prefix are rejected, as by CreateBucket.
+func (s *SecureBolt) EnsureBuckets(names ...[]byte) error {
+	return s.Update(func(tx *SecureTx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket %q: %w", name, err)
+			}
+		}
+		return nil
 	})
 }
 
-// DeleteBucket deletes the bucket with the given name.
+// Bolt returns the underlying bbolt transaction as an escape hatch for
+// features the wrapper does not expose.
+//
+// WARNING: the raw transaction bypasses encryption entirely. Values written
+// through it are stored in plaintext and values read through it are returned
+// as ciphertext. Never write to SecureBolt buckets directly, and never modify
+// the securebolt_meta bucket, or the database may become unreadable.
+func (stx *SecureTx) Bolt() *bbolt.Tx {
+	return stx.tx
+}
+
+// DeleteBucket deletes the bucket with the given name, along with any of its
+// values stored in the securebolt_external bucket, its expiry index entries
+// and its settings, and those of every bucket nested in it.
 func (stx *SecureTx) DeleteBucket(name []byte) error {
+	if bucket := stx.tx.Bucket(name); bucket != nil {
+		if err := stx.newBucket(name, bucket).release(); err != nil {
+			return err
+		}
+	}
 	return stx.tx.DeleteBucket(name)
 }
 
+// CreateBucket creates a new bucket with the given name and records the
+// settings it adopts from the current options, such as the key binding of
+// Options.StrictSecurity. Names using the reserved securebolt_ prefix are
+// rejected, since they could shadow the internal buckets.
 func (stx *SecureTx) CreateBucket(name []byte) (*SecureBucket, error) {
+	if err := checkBucketName(name); err != nil {
+		return nil, err
+	}
 	bucket, err := stx.tx.CreateBucket(name)
 	if err != nil {
 		return nil, err
 	}
-	return &SecureBucket{
-		bucket:  bucket,
-		aead:    stx.aead,    // Use AEAD from SecureTx
-		keyLock: stx.keyLock, // Pass keyLock from SecureTx
-	}, nil
+	sb := stx.newBucket(name, bucket)
+	if err := sb.recordDefaults(); err != nil {
+		return nil, err
+	}
+	return sb, nil
 }
 
+// CreateBucketIfNotExists returns the bucket with the given name, creating it
+// as CreateBucket does if it does not exist yet. Like CreateBucket, it
+// rejects names using the reserved securebolt_ prefix.
 func (stx *SecureTx) CreateBucketIfNotExists(name []byte) (*SecureBucket, error) {
-	bucket, err := stx.tx.CreateBucketIfNotExists(name)
-	if err != nil {
+	if err := checkBucketName(name); err != nil {
 		return nil, err
 	}
-	return &SecureBucket{
-		bucket:  bucket,
-		aead:    stx.aead,    // Use AEAD from SecureTx
-		keyLock: stx.keyLock, // Pass keyLock from SecureTx
-	}, nil
+	if bucket := stx.tx.Bucket(name); bucket != nil {
+		return stx.newBucket(name, bucket), nil
+	}
+	return stx.CreateBucket(name)
+}
+
+// checkBucketName rejects names of top-level buckets using the reserved
+// securebolt_ prefix.
+func checkBucketName(name []byte) error {
+	if bytes.HasPrefix(name, reservedPrefix) {
+		return fmt.Errorf("bucket %q uses the reserved %q prefix", name, reservedPrefix)
+	}
+	return nil
 }
 
 func (stx *SecureTx) Bucket(name []byte) (*SecureBucket, error) {
@@ -217,40 +755,150 @@ func (stx *SecureTx) Bucket(name []byte) (*SecureBucket, error) {
 	if bucket == nil {
 		return nil, fmt.Errorf("bucket %q not found", name)
 	}
+	return stx.newBucket(name, bucket), nil
+}
+
+// Put encrypts and stores value under key in the named bucket, creating the
+// bucket if it does not exist. It is a shortcut for a single write; obtain
+// the bucket with CreateBucketIfNotExists for several writes to one bucket.
+func (stx *SecureTx) Put(bucket, key, value []byte) error {
+	b, err := stx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// Get decrypts and returns the value stored under key in the named bucket.
+// A missing bucket, like a missing key, yields nil and no error, so use
+// Bucket when the two must be told apart.
+func (stx *SecureTx) Get(bucket, key []byte) ([]byte, error) {
+	b := stx.tx.Bucket(bucket)
+	if b == nil {
+		return nil, nil
+	}
+	return stx.newBucket(bucket, b).Get(key)
+}
+
+// newBucket wraps a bbolt bucket belonging to this transaction.
+func (stx *SecureTx) newBucket(name []byte, bucket *bbolt.Bucket) *SecureBucket {
 	return &SecureBucket{
 		bucket:  bucket,
-		aead:    stx.aead,
+		tx:      stx,
+		name:    name,
+		aead:    stx.aead,    // Use AEAD from SecureTx
 		keyLock: stx.keyLock, // Pass keyLock from SecureTx
-	}, nil
+	}
 }
 
+// SecureBucket wraps a bbolt.Bucket, encrypting values on write and
+// decrypting them on read.
+//
+// Keys are opaque byte strings. They may contain any byte, including 0x00
+// and bytes above 0x7f, are never converted to strings, terminated or
+// normalized, and sort bytewise as with bytes.Compare. Empty keys are
+// rejected, and bbolt limits keys to 32768 bytes. Keys are stored in
+// plaintext; only values are encrypted.
 type SecureBucket struct {
 	bucket  *bbolt.Bucket
+	tx      *SecureTx
+	name    []byte
 	aead    cipher.AEAD
 	keyLock *memguard.LockedBuffer
+	config  *bucketConfig // Loaded on first use by bucketSettings
+	path    [][]byte      // Names from the top-level bucket down, nil for top-level buckets
+
+	validator func(key, value []byte) error // Set by SetValueValidator
 }
 
 // Put encrypts the value and stores it in the underlying bucket with the given key.
+// A nil value is stored as an empty one, unless Options.RejectNilValue is set.
 func (sb *SecureBucket) Put(key, value []byte) error {
-	if len(key) == 0 {
-		return errors.New("key cannot be empty")
+	return sb.put(key, value, nil, 0)
+}
+
+// put stores value under key, appending signature to the encrypted payload
+// when it is not nil and recording an expiry time when expires is not zero.
+func (sb *SecureBucket) put(key, value, signature []byte, expires int64) error {
+	if err := sb.checkKey(key); err != nil {
+		return err
 	}
 	if value == nil {
+		if sb.tx.db.opts.RejectNilValue {
+			return ErrNilValue
+		}
 		value = []byte{}
 	}
+	if sb.validator != nil {
+		if err := sb.validator(key, value); err != nil {
+			return err
+		}
+	}
 
-	encryptedValue, err := encryptData(value, sb.aead)
+	encryptedValue, err := sb.sealValue(key, value, signature, expires)
 	if err != nil {
 		return err
 	}
 
-	return sb.bucket.Put(key, encryptedValue)
+	old, err := sb.sideEntriesOf(key, sb.bucket.Get(key))
+	if err != nil {
+		return err
+	}
+	if err := sb.bucket.Put(key, encryptedValue); err != nil {
+		return err
+	}
+	if err := sb.releaseSideEntries(key, old); err != nil {
+		return err
+	}
+	if expires != 0 {
+		if err := sb.indexExpiry(key, expires); err != nil {
+			return err
+		}
+	}
+	sb.tx.db.cache.invalidate(sb.name, key)
+	sb.tx.recordChange(OpPut, sb.name, key, value)
+	sb.tx.db.metrics.puts.Add(1)
+	if sb.tx.db.opts.WipeInputAfterPut {
+		memguard.WipeBytes(value)
+	}
+	return nil
+}
+
+// PutAll encrypts and stores every entry of m within the current write
+// transaction. Entries are written in sorted key order. If any entry fails the
+// error is returned and, once the Update callback returns it, bbolt rolls back
+// the whole transaction so none of the entries are stored.
+func (sb *SecureBucket) PutAll(m map[string][]byte) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := sb.Put([]byte(k), m[k]); err != nil {
+			return fmt.Errorf("failed to put key %q: %w", k, err)
+		}
+	}
+	return nil
 }
 
-// Get retrieves the encrypted value for a given key and decrypts it.
+// Get retrieves the encrypted value for a given key and decrypts it. The
+// returned value is a fresh allocation owned by the caller that stays valid
+// after the transaction ends.
 func (sb *SecureBucket) Get(key []byte) ([]byte, error) {
-	if len(key) == 0 {
-		return nil, errors.New("key cannot be empty")
+	if err := sb.checkKey(key); err != nil {
+		return nil, err
+	}
+
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	sb.tx.db.metrics.gets.Add(1)
+	if !sb.tx.snapshot {
+		if value, ok := sb.tx.db.cache.get(sb.name, key); ok {
+			return value, nil
+		}
 	}
 
 	encryptedValue := sb.bucket.Get(key)
@@ -258,26 +906,264 @@ func (sb *SecureBucket) Get(key []byte) ([]byte, error) {
 		return nil, nil
 	}
 
-	value, err := decryptData(encryptedValue, sb.aead)
+	rec, err := sb.openFull(key, encryptedValue)
 	if err != nil {
+		sb.tx.db.metrics.decryptFailures.Add(1)
 		return nil, err
 	}
+	if rec.expired(time.Now()) || rec.deleted != 0 {
+		return nil, nil
+	}
 
-	return value, nil
+	// Uncommitted, snapshot and expiring values never enter the cache
+	if !sb.tx.tx.Writable() && !sb.tx.snapshot && rec.expires == 0 {
+		sb.tx.db.cache.put(sb.name, key, rec.value)
+	}
+	return rec.value, nil
+}
+
+// GetMulti retrieves and decrypts the values of keys, returning them keyed by
+// string(key). Keys that are absent or expired are omitted, so the map can be
+// smaller than keys. Binary keys are safe to use: converting a []byte to a
+// string preserves every byte, so two keys share a map entry only if they
+// are identical. The first failure to decrypt a value is returned.
+func (sb *SecureBucket) GetMulti(keys [][]byte) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := sb.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key %q: %w", key, err)
+		}
+		if value != nil {
+			values[string(key)] = value
+		}
+	}
+	return values, nil
 }
 
 // Delete removes the key and its value from the bucket.
 func (sb *SecureBucket) Delete(key []byte) error {
-	if len(key) == 0 {
-		return errors.New("key cannot be empty")
+	if err := sb.checkKey(key); err != nil {
+		return err
+	}
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	old, err := sb.sideEntriesOf(key, sb.bucket.Get(key))
+	if err != nil {
+		return err
+	}
+	if err := sb.bucket.Delete(key); err != nil {
+		return err
+	}
+	if err := sb.releaseSideEntries(key, old); err != nil {
+		return err
+	}
+	sb.tx.db.cache.invalidate(sb.name, key)
+	sb.tx.recordChange(OpDelete, sb.name, key, nil)
+	sb.tx.db.metrics.deletes.Add(1)
+	return nil
+}
+
+// SwapValues exchanges the values of keyA and keyB within the current write
+// transaction, re-encrypting both with fresh nonces. Both keys must exist.
+// Values are swapped as if written with Put, so an expiry or PutSigned
+// signature on either value is dropped.
+func (sb *SecureBucket) SwapValues(keyA, keyB []byte) error {
+	valueA, err := sb.Get(keyA)
+	if err != nil {
+		return err
+	}
+	valueB, err := sb.Get(keyB)
+	if err != nil {
+		return err
+	}
+	if valueA == nil {
+		return fmt.Errorf("key %q not found", keyA)
 	}
-	return sb.bucket.Delete(key)
+	if valueB == nil {
+		return fmt.Errorf("key %q not found", keyB)
+	}
+	if err := sb.Put(keyA, valueB); err != nil {
+		return err
+	}
+	return sb.Put(keyB, valueA)
+}
+
+// RenameKey moves the value of oldKey to newKey within the current write
+// transaction, re-encrypting it with a fresh nonce, and deletes oldKey.
+// oldKey must exist and newKey must not, as reported by Get: a tombstone or
+// an expired value left at newKey is replaced, releasing its external value
+// and expiry index entry as Put does. An expiry set with PutWithTTL is kept,
+// while a PutSigned signature covers the key and is dropped.
+func (sb *SecureBucket) RenameKey(oldKey, newKey []byte) error {
+	if err := sb.checkKey(oldKey); err != nil {
+		return err
+	}
+	if err := sb.checkKey(newKey); err != nil {
+		return err
+	}
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	encryptedValue := sb.bucket.Get(oldKey)
+	if encryptedValue == nil {
+		return fmt.Errorf("key %q not found", oldKey)
+	}
+	if stored := sb.bucket.Get(newKey); stored != nil {
+		dst, err := sb.openFull(newKey, stored)
+		if err != nil {
+			return err
+		}
+		if !dst.expired(time.Now()) && dst.deleted == 0 {
+			return fmt.Errorf("key %q already exists", newKey)
+		}
+	}
+	rec, err := sb.openFull(oldKey, encryptedValue)
+	if err != nil {
+		return err
+	}
+	if rec.expired(time.Now()) || rec.deleted != 0 {
+		return fmt.Errorf("key %q not found", oldKey)
+	}
+	if err := sb.put(newKey, rec.value, nil, rec.expires); err != nil {
+		return err
+	}
+	return sb.Delete(oldKey)
+}
+
+// Truncate deletes every key in the bucket within the current write
+// transaction, keeping the bucket itself, its sequence counter and any
+// nested buckets. It deletes keys one at a time, so its cost grows with the
+// size of the bucket; when resetting the sequence is acceptable, deleting
+// and recreating the bucket is cheaper for large buckets.
+func (sb *SecureBucket) Truncate() error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	var keys [][]byte
+	c := sb.bucket.Cursor()
+	for k, _ := nextValue(c, true); k != nil; k, _ = nextValue(c, false) {
+		keys = append(keys, append([]byte{}, k...))
+	}
+	for _, k := range keys {
+		if err := sb.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErasePrefix deletes every key starting with prefix within the current
+// write transaction, together with its external value and expiry index
+// entry and any cached plaintext, and returns how many keys were erased, for
+// example to record the outcome of an erasure request. An empty prefix
+// erases every key, like Truncate. Nested buckets whose name starts with
+// prefix are deleted along with everything in them, at any depth, including
+// their external values, expiry index entries and settings, and their values
+// count as erased.
+//
+// bbolt never updates pages in place: a committed delete frees the pages
+// holding the old ciphertext, which stay in the file until later writes
+// reuse them, so overwriting a value before deleting it would not scrub
+// them either. The erased values remain encrypted under the database key
+// until then. To remove them from disk, follow the erasure with CompactTo or
+// CloseWithCompaction, which write a new file without the free pages.
+func (sb *SecureBucket) ErasePrefix(prefix []byte) (int, error) {
+	if err := sb.checkOpen(); err != nil {
+		return 0, err
+	}
+	var keys, buckets [][]byte
+	c := sb.bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if v != nil {
+			keys = append(keys, append([]byte{}, k...))
+		} else {
+			buckets = append(buckets, append([]byte{}, k...))
+		}
+	}
+	for i, k := range keys {
+		if err := sb.Delete(k); err != nil {
+			return i, err
+		}
+	}
+
+	erased := len(keys)
+	countValues := func(b *SecureBucket) error {
+		return b.bucket.ForEach(func(_, v []byte) error {
+			if v != nil {
+				erased++
+			}
+			return nil
+		})
+	}
+	for _, name := range buckets {
+		child := sb.nested(name, sb.bucket.Bucket(name))
+		n := erased
+		if err := countValues(child); err != nil {
+			return n, err
+		}
+		if err := child.walkNested(countValues); err != nil {
+			return n, err
+		}
+		if err := child.release(); err != nil {
+			return n, err
+		}
+		if err := sb.bucket.DeleteBucket(name); err != nil {
+			return n, err
+		}
+	}
+	return erased, nil
+}
+
+// DeleteWhere deletes every key for which pred returns true within the
+// current write transaction and returns how many were deleted. It decrypts
+// and tests every value first and only deletes once the scan is over,
+// since deleting through a cursor while iterating can make bbolt skip or
+// repeat keys. pred sees values as ForEach does; an error from it stops the
+// scan before anything is deleted and is returned. Nested buckets are left
+// alone.
+func (sb *SecureBucket) DeleteWhere(pred func(k, v []byte) (bool, error)) (int, error) {
+	if err := sb.checkOpen(); err != nil {
+		return 0, err
+	}
+	var keys [][]byte
+	c := sb.cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		match, err := pred(k, value)
+		if err != nil {
+			return 0, err
+		}
+		if match {
+			keys = append(keys, append([]byte{}, k...))
+		}
+	}
+	for i, k := range keys {
+		if err := sb.Delete(k); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
 }
 
 // ForEach calls the provided function with each key and decrypted value in the bucket.
+// Each value is a fresh allocation the caller may retain. Keys point into the
+// database's memory map, as in bbolt, and are only valid for the life of the
+// transaction; copy them to keep them. Keys left as tombstones by SoftDelete
+// are skipped.
 func (sb *SecureBucket) ForEach(fn func(k, v []byte) error) error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
 	return sb.bucket.ForEach(func(k, encV []byte) error {
-		value, err := decryptData(encV, sb.aead)
+		if sb.tombstoned(k, encV) {
+			return nil
+		}
+		value, err := sb.openValue(k, encV)
 		if err != nil {
 			return err
 		}
@@ -285,28 +1171,338 @@ func (sb *SecureBucket) ForEach(fn func(k, v []byte) error) error {
 	})
 }
 
+// ForEachBatch calls fn with the entries of the bucket in key order, in
+// batches of at most batchSize decrypted entries, so a scan of a large bucket
+// only holds one batch of plaintext at a time. Values are fresh allocations
+// the caller may retain, while keys are only valid for the life of the
+// transaction, as with ForEach. Nested buckets and tombstones are skipped.
+// An error from fn stops the iteration and is returned.
+func (sb *SecureBucket) ForEachBatch(batchSize int, fn func(batch []KV) error) error {
+	if batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	batch := make([]KV, 0, batchSize)
+	c := sb.cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		value, err := sb.openValue(k, v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
+		}
+		batch = append(batch, KV{Key: k, Value: value})
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([]KV, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
 // Cursor creates a new cursor associated with the bucket.
 func (sb *SecureBucket) Cursor() *SecureCursor {
 	return &SecureCursor{
-		cursor:  sb.bucket.Cursor(),
+		cursor:  sb.cursor(),
+		bucket:  sb,
 		aead:    sb.aead,    // Add this line to initialize aead
 		keyLock: sb.keyLock, // Pass keyLock
 	}
 }
 
+// checkOpen returns ErrDBClosed once the database key has been destroyed.
+// Transactions that were in flight when Close was called keep working until
+// they finish, since Close waits for them before destroying the key.
+func (sb *SecureBucket) checkOpen() error {
+	if !sb.keyLock.IsAlive() {
+		return ErrDBClosed
+	}
+	return nil
+}
+
+// SetValueValidator makes every write through this bucket handle call fn
+// with the key and the plaintext value before encrypting it. An error from
+// fn aborts the write and is returned unchanged. It applies to Put and every
+// method built on it, such as PutAll and PutWithTTL; PutVersioned passes the
+// value with its 8-byte version prefix. The validator is not stored: it
+// only applies to this handle, so set it again on handles obtained in later
+// transactions. A nil fn removes the validator.
+func (sb *SecureBucket) SetValueValidator(fn func(key, value []byte) error) {
+	sb.validator = fn
+}
+
+// checkKey rejects empty keys and keys refused by Options.KeyValidator.
+func (sb *SecureBucket) checkKey(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	if validate := sb.tx.db.opts.KeyValidator; validate != nil {
+		return validate(key)
+	}
+	return nil
+}
+
+// sealValue encrypts a plaintext value into its stored form. The plaintext
+// is laid out as
+//
+//	[expiry time][last-modified time][insertion sequence][value][signature]
+//
+// where the expiry time is present when expires is not zero, the
+// last-modified time with Options.TrackTimestamps, the insertion sequence
+// when the database tracks insertion order and the signature when it is not
+// nil; envelope flags record which optional parts are present and
+// whether the plaintext was compressed and padded. With
+// Options.StrictSecurity the envelope is bound to the bucket and key. Values
+// above the external threshold are moved to the securebolt_external bucket.
+func (sb *SecureBucket) sealValue(key, value, signature []byte, expires int64) ([]byte, error) {
+	if err := sb.checkOpen(); err != nil {
+		return nil, err
+	}
+	var flags byte
+	var plaintext []byte
+	if expires != 0 {
+		plaintext = Uint64Key(uint64(expires))
+		flags |= flagExpiry
+	}
+	if sb.tx.db.opts.TrackTimestamps {
+		plaintext = append(plaintext, Uint64Key(uint64(time.Now().UnixNano()))...)
+		flags |= flagModified
+	}
+	if sb.tx.db.opts.InsertionOrder {
+		seq, err := sb.bucket.NextSequence()
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate insertion sequence: %w", err)
+		}
+		plaintext = append(plaintext, Uint64Key(seq)...)
+	}
+	plaintext = append(plaintext, value...)
+	if signature != nil {
+		plaintext = append(plaintext, signature...)
+		flags |= flagSigned
+	}
+	compress, err := sb.compresses()
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		flags |= flagCompressed
+	}
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return nil, err
+	}
+	if sb.tx.db.opts.StrictSecurity || cfg.bound {
+		flags |= flagBound
+	}
+	if cfg.padding != 0 {
+		flags |= flagPadded
+	}
+	if err := sb.tx.chargeKeyUsage(len(plaintext)); err != nil {
+		return nil, err
+	}
+	if t := sb.tx.db.opts.ExternalThreshold; t > 0 && len(plaintext) > t {
+		return sb.storeExternal(plaintext, flags, sb.bindingOf(key), cfg.padding)
+	}
+	return sealEnvelopePadded(plaintext, sb.aead, flags, sb.bindingOf(key), cfg.padding)
+}
+
+// bindingOf returns the binding of the value stored under key. It only
+// affects values sealed with flagBound.
+func (sb *SecureBucket) bindingOf(key []byte) *binding {
+	return &binding{bucket: sb.name, key: key}
+}
+
+// record is a decrypted stored value split into its parts.
+type record struct {
+	seq       uint64 // Insertion sequence, zero unless the database tracks insertion order
+	expires   int64  // Expiry in Unix nanoseconds, zero when the value never expires
+	modified  int64  // Last write in Unix nanoseconds, zero unless written with Options.TrackTimestamps
+	deleted   int64  // SoftDelete time in Unix nanoseconds, zero unless the value is a tombstone
+	value     []byte
+	signature []byte // PutSigned signature, nil for unsigned values
+}
+
+// expired reports whether the record has an expiry time that is before now.
+func (r record) expired(now time.Time) bool {
+	return r.expires != 0 && now.UnixNano() >= r.expires
+}
+
+// openValue decrypts a stored value back into its plaintext.
+func (sb *SecureBucket) openValue(key, encryptedValue []byte) ([]byte, error) {
+	rec, err := sb.openFull(key, encryptedValue)
+	return rec.value, err
+}
+
+// openRecord decrypts a stored value and also returns its insertion sequence,
+// which is zero when the database does not track insertion order.
+func (sb *SecureBucket) openRecord(key, encryptedValue []byte) (uint64, []byte, error) {
+	rec, err := sb.openFull(key, encryptedValue)
+	return rec.seq, rec.value, err
+}
+
+// openFull decrypts a stored value and splits it into the parts laid out by
+// sealValue.
+func (sb *SecureBucket) openFull(key, encryptedValue []byte) (record, error) {
+	rec, _, err := sb.openFullInto(nil, key, encryptedValue)
+	return rec, err
+}
+
+// openFullInto is openFull decrypting into the storage of dst when it has
+// enough capacity. It also returns the whole decrypted plaintext, which the
+// parts of the record point into.
+func (sb *SecureBucket) openFullInto(dst, key, encryptedValue []byte) (record, []byte, error) {
+	if err := sb.checkOpen(); err != nil {
+		return record{}, nil, err
+	}
+	plaintext, flags, legacy, err := openEnvelopeInto(dst, encryptedValue, sb.aead, sb.bindingOf(key))
+	if err == nil && flags&flagExternal != 0 {
+		plaintext, err = sb.loadExternal(plaintext)
+	}
+	if err != nil || plaintext == nil {
+		return record{value: plaintext}, plaintext, err
+	}
+	full := plaintext
+
+	var rec record
+	if !legacy && encryptedValue[0] == tombstoneVersion {
+		if len(plaintext) != tombstoneLength {
+			return record{}, nil, errors.New("tombstone is malformed")
+		}
+		deleted, _ := ParseUint64Key(plaintext)
+		return record{deleted: int64(deleted), value: plaintext[:0]}, full, nil
+	}
+	if flags&flagExpiry != 0 {
+		if len(plaintext) < expiryHeaderLength {
+			return record{}, nil, errors.New("value is missing its expiry time")
+		}
+		expires, _ := ParseUint64Key(plaintext[:expiryHeaderLength])
+		rec.expires = int64(expires)
+		plaintext = plaintext[expiryHeaderLength:]
+	}
+	if flags&flagModified != 0 {
+		if len(plaintext) < modifiedHeaderLength {
+			return record{}, nil, errors.New("value is missing its last-modified time")
+		}
+		modified, _ := ParseUint64Key(plaintext[:modifiedHeaderLength])
+		rec.modified = int64(modified)
+		plaintext = plaintext[modifiedHeaderLength:]
+	}
+	if sb.tx.db.opts.InsertionOrder {
+		if len(plaintext) < seqHeaderLength {
+			return record{}, nil, errors.New("value is missing its insertion sequence")
+		}
+		rec.seq, _ = ParseUint64Key(plaintext[:seqHeaderLength])
+		plaintext = plaintext[seqHeaderLength:]
+	}
+	if flags&flagSigned != 0 {
+		if len(plaintext) < signatureLength {
+			return record{}, nil, errors.New("value is missing its signature")
+		}
+		cut := len(plaintext) - signatureLength
+		plaintext, rec.signature = plaintext[:cut:cut], plaintext[cut:]
+	}
+	rec.value = plaintext
+	return rec, full, nil
+}
+
+// sideEntries are the entries outside a value's own bucket that belong to
+// a stored value and must be removed along with it.
+type sideEntries struct {
+	ref     []byte // Reference into the securebolt_external bucket
+	expires int64  // Expiry time indexed in the securebolt_expiry bucket
+}
+
+// sideEntriesOf returns the side entries of a stored value. Values without
+// any are recognized from the envelope header without being decrypted.
+func (sb *SecureBucket) sideEntriesOf(key, stored []byte) (sideEntries, error) {
+	h, _, _, _, ok := parseEnvelope(stored, sb.aead.NonceSize())
+	if !ok || h.flags&(flagExternal|flagExpiry) == 0 {
+		return sideEntries{}, nil
+	}
+	plaintext, flags, err := openEnvelopeFlags(stored, sb.aead, sb.bindingOf(key))
+	if err != nil {
+		return sideEntries{}, err
+	}
+	var e sideEntries
+	if flags&flagExternal != 0 {
+		e.ref = plaintext
+	}
+	if flags&flagExpiry != 0 {
+		rec, err := sb.openFull(key, stored)
+		if err != nil {
+			return sideEntries{}, err
+		}
+		e.expires = rec.expires
+	}
+	return e, nil
+}
+
+// releaseSideEntries deletes the side entries of the value that was stored
+// under key.
+func (sb *SecureBucket) releaseSideEntries(key []byte, e sideEntries) error {
+	if err := sb.releaseExternal(e.ref); err != nil {
+		return err
+	}
+	if e.expires != 0 {
+		return sb.unindexExpiry(key, e.expires)
+	}
+	return nil
+}
+
+// releaseAllSideEntries deletes the side entries of every value in the bucket.
+func (sb *SecureBucket) releaseAllSideEntries() error {
+	if sb.tx.tx.Bucket(externalBucket) == nil && sb.tx.tx.Bucket(expiryIndexBucket) == nil {
+		return nil
+	}
+	var keys [][]byte
+	var entries []sideEntries
+	err := sb.bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		e, err := sb.sideEntriesOf(k, v)
+		if e.ref != nil || e.expires != 0 {
+			keys = append(keys, append([]byte{}, k...))
+			entries = append(entries, e)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		if err := sb.releaseSideEntries(keys[i], entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SecureCursor iterates over the decrypted entries of a SecureBucket. Values
+// returned by its methods are fresh allocations the caller may retain; keys
+// are only valid for the life of the transaction.
 type SecureCursor struct {
-	cursor  *bbolt.Cursor
+	cursor  *liveCursor
+	bucket  *SecureBucket
 	aead    cipher.AEAD
 	keyLock *memguard.LockedBuffer
 }
 
 // First moves the cursor to the first key/value pair and returns it.
 func (sc *SecureCursor) First() ([]byte, []byte, error) {
+	if err := sc.bucket.checkOpen(); err != nil {
+		return nil, nil, err
+	}
 	k, encV := sc.cursor.First()
 	if k == nil || encV == nil {
 		return k, nil, nil
 	}
-	v, err := decryptData(encV, sc.aead)
+	v, err := sc.bucket.openValue(k, encV)
 	if err != nil {
 		return k, nil, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
 	}
@@ -315,11 +1511,14 @@ func (sc *SecureCursor) First() ([]byte, []byte, error) {
 
 // Next moves the cursor to the next key/value pair and returns it.
 func (sc *SecureCursor) Next() ([]byte, []byte, error) {
+	if err := sc.bucket.checkOpen(); err != nil {
+		return nil, nil, err
+	}
 	k, encV := sc.cursor.Next()
 	if k == nil || encV == nil {
 		return k, nil, nil // No more entries
 	}
-	v, err := decryptData(encV, sc.aead)
+	v, err := sc.bucket.openValue(k, encV)
 	if err != nil {
 		return k, nil, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
 	}
@@ -328,11 +1527,14 @@ func (sc *SecureCursor) Next() ([]byte, []byte, error) {
 
 // Prev moves the cursor to the previous key/value pair and returns it.
 func (sc *SecureCursor) Prev() ([]byte, []byte, error) {
+	if err := sc.bucket.checkOpen(); err != nil {
+		return nil, nil, err
+	}
 	k, encV := sc.cursor.Prev()
 	if k == nil || encV == nil {
 		return k, nil, nil // No more entries
 	}
-	v, err := decryptData(encV, sc.aead)
+	v, err := sc.bucket.openValue(k, encV)
 	if err != nil {
 		return k, nil, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
 	}
@@ -341,40 +1543,16 @@ func (sc *SecureCursor) Prev() ([]byte, []byte, error) {
 
 // Seek moves the cursor to a given key and returns the associated key/value pair.
 func (sc *SecureCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if err := sc.bucket.checkOpen(); err != nil {
+		return nil, nil, err
+	}
 	k, encV := sc.cursor.Seek(seek)
 	if k == nil || encV == nil {
 		return k, nil, nil // No matching entry
 	}
-	v, err := decryptData(encV, sc.aead)
+	v, err := sc.bucket.openValue(k, encV)
 	if err != nil {
 		return k, nil, fmt.Errorf("failed to decrypt value for key %q: %w", k, err)
 	}
 	return k, v, nil
 }
-
-func encryptData(data []byte, aead cipher.AEAD) ([]byte, error) {
-
-	nonce := make([]byte, aead.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-	ciphertext := aead.Seal(nonce, nonce, data, nil)
-	return ciphertext, nil
-}
-
-// decryptData decrypts the data using AES-GCM.
-func decryptData(encryptedData []byte, aead cipher.AEAD) ([]byte, error) {
-
-	if encryptedData == nil {
-		return nil, nil
-	}
-	if len(encryptedData) < aead.NonceSize() {
-		return nil, errors.New("encrypted data is too short")
-	}
-	nonce, ciphertext := encryptedData[:aead.NonceSize()], encryptedData[aead.NonceSize():]
-	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
-	}
-	return plaintext, nil
-}
@@ -2,10 +2,19 @@ package securebolt
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
 )
 
 func TestSecureBolt(t *testing.T) {
@@ -125,3 +134,1866 @@ func TestSecureBolt(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestExternalSalt(t *testing.T) {
+	filename := "test_external_salt.db"
+	password := "secure-test-password"
+	salt := []byte("0123456789abcdef")
+	bucketName := []byte("SaltBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalSalt: salt})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// Reopen with the same external salt and confirm the value round-trips
+	db, err = OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalSalt: salt})
+	if err != nil {
+		t.Fatalf("Failed to reopen SecureBolt: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, []byte("value")) {
+			return fmt.Errorf("value mismatch: got %q, expected %q", v, "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// The salt must not have been written to the metadata bucket
+	raw, err := bbolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open raw BoltDB: %v", err)
+	}
+	defer raw.Close()
+	err = raw.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(metaBucket); b != nil && b.Get(saltKey) != nil {
+			return errors.New("salt found in metadata bucket")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Metadata check failed: %v", err)
+	}
+
+	// Short salts are rejected
+	if _, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalSalt: []byte("short")}); err == nil {
+		t.Fatalf("Expected error for short external salt")
+	}
+}
+
+func TestExternalSaltRequired(t *testing.T) {
+	filename := "test_external_salt_required.db"
+	password := "secure-test-password"
+	salt := []byte("0123456789abcdef")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalSalt: salt})
+	if err != nil {
+		t.Fatalf("Failed to create SecureBolt: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	_, err = Open(filename, 0600, []byte(password))
+	if !errors.Is(err, ErrExternalSaltRequired) {
+		t.Fatalf("Expected ErrExternalSaltRequired, got %v", err)
+	}
+
+	db, err = OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalSalt: salt})
+	if err != nil {
+		t.Fatalf("Failed to reopen with the external salt: %v", err)
+	}
+	db.Close()
+}
+
+func TestOpenTimeout(t *testing.T) {
+	filename := "test_timeout.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	// A second handle contends for the lock held by the first one
+	errCh := make(chan error, 1)
+	go func() {
+		second, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Timeout: 100 * time.Millisecond})
+		if err == nil {
+			second.Close()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrFileLocked) {
+			t.Fatalf("Expected ErrFileLocked, got %v", err)
+		}
+		if !errors.Is(err, berrors.ErrTimeout) {
+			t.Fatalf("Expected error to wrap bbolt timeout, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Open did not honor the lock timeout")
+	}
+}
+
+func TestReset(t *testing.T) {
+	filename := "test_reset.db"
+	password := "secure-test-password"
+	bucketNames := [][]byte{[]byte("First"), []byte("Second"), []byte("Third")}
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		for _, name := range bucketNames {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("key"), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate buckets: %v", err)
+	}
+
+	if err := db.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// The database must reopen with the same password and hold no user buckets
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen SecureBolt after Reset: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		for _, name := range bucketNames {
+			if _, err := tx.Bucket(name); err == nil {
+				return fmt.Errorf("bucket %q still exists after Reset", name)
+			}
+		}
+		b, err := tx.CreateBucket([]byte("Fresh"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}
+
+func TestBoltEscapeHatch(t *testing.T) {
+	filename := "test_bolt_tx.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *SecureTx) error {
+		b := tx.Bolt().Bucket(metaBucket)
+		if b == nil {
+			return errors.New("metadata bucket not found")
+		}
+		salt := b.Get(saltKey)
+		if !bytes.Equal(salt, db.keys().salt) {
+			return fmt.Errorf("salt mismatch: got %x, expected %x", salt, db.keys().salt)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Raw transaction check failed: %v", err)
+	}
+}
+
+func TestReadOnlyHandles(t *testing.T) {
+	filename := "test_read_only.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	if _, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ReadOnly: true}); err == nil {
+		t.Fatalf("Expected error creating a database in read-only mode")
+	}
+
+	write := func(bucketName string) {
+		db, err := Open(filename, 0600, []byte(password))
+		if err != nil {
+			t.Fatalf("Failed to open writer: %v", err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("key"), []byte(bucketName))
+		})
+		if err != nil {
+			t.Fatalf("Writer update failed: %v", err)
+		}
+	}
+	read := func(db *SecureBolt, bucketName string) error {
+		return db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket([]byte(bucketName))
+			if err != nil {
+				return err
+			}
+			v, err := b.Get([]byte("key"))
+			if err != nil {
+				return err
+			}
+			if string(v) != bucketName {
+				return fmt.Errorf("value mismatch: got %q, expected %q", v, bucketName)
+			}
+			return nil
+		})
+	}
+	openReader := func() *SecureBolt {
+		db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ReadOnly: true, Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("Failed to open reader: %v", err)
+		}
+		return db
+	}
+
+	write("First")
+
+	// Two readers share the file at the same time
+	r1, r2 := openReader(), openReader()
+	for _, r := range []*SecureBolt{r1, r2} {
+		if err := read(r, "First"); err != nil {
+			t.Fatalf("Reader failed: %v", err)
+		}
+	}
+	err := r1.Update(func(tx *SecureTx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("Forbidden"))
+		return err
+	})
+	if err == nil {
+		t.Fatalf("Expected error writing through a read-only handle")
+	}
+	r1.Close()
+	r2.Close()
+
+	// A bucket created by the writer is visible once the reader reopens
+	write("Second")
+	r := openReader()
+	defer r.Close()
+	if err := read(r, "Second"); err != nil {
+		t.Fatalf("Reader did not see the writer's new bucket: %v", err)
+	}
+}
+
+func TestOpenInterruptedCreation(t *testing.T) {
+	filename := "test_interrupted.db"
+	password := "secure-test-password"
+	bucketName := []byte("Bucket")
+
+	defer os.Remove(filename)
+
+	// Simulate a crash after bbolt created the file but before the salt was stored
+	raw, err := bbolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to create raw BoltDB: %v", err)
+	}
+	raw.Close()
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open interrupted database: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "value" {
+			return fmt.Errorf("value mismatch: got %q, expected %q", v, "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	db.Close()
+
+	// A file with user data but no salt is not re-initialized
+	raw, err = bbolt.Open(filename, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open raw BoltDB: %v", err)
+	}
+	err = raw.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(metaBucket)
+	})
+	raw.Close()
+	if err != nil {
+		t.Fatalf("Failed to delete metadata bucket: %v", err)
+	}
+	if _, err := Open(filename, 0600, []byte(password)); err == nil {
+		t.Fatalf("Expected error opening a database with data but no salt")
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	filename := "test_closed.db"
+	password := "secure-test-password"
+	bucketName := []byte("Bucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	// Keep a bucket and cursor past the end of their transaction, as an app
+	// with complex shutdown ordering might
+	var bucket *SecureBucket
+	err = db.Update(func(tx *SecureTx) error {
+		bucket, err = tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	if err := db.Close(); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Second Close: expected ErrDBClosed, got %v", err)
+	}
+	if err := db.View(func(tx *SecureTx) error { return nil }); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("View: expected ErrDBClosed, got %v", err)
+	}
+	if err := db.Update(func(tx *SecureTx) error { return nil }); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Update: expected ErrDBClosed, got %v", err)
+	}
+	if _, err := bucket.Get([]byte("key")); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Get: expected ErrDBClosed, got %v", err)
+	}
+	if err := bucket.Put([]byte("key"), []byte("value")); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Put: expected ErrDBClosed, got %v", err)
+	}
+	if _, _, err := bucket.Cursor().First(); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Cursor: expected ErrDBClosed, got %v", err)
+	}
+}
+
+func TestTagSize(t *testing.T) {
+	password := "secure-test-password"
+	bucketName := []byte("TagBucket")
+
+	for _, tagSize := range []int{0, 12} {
+		filename := fmt.Sprintf("test_tag_size_%d.db", tagSize)
+		defer os.Remove(filename)
+
+		db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{TagSize: tagSize})
+		if err != nil {
+			t.Fatalf("Failed to open with tag size %d: %v", tagSize, err)
+		}
+		err = db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("key"), []byte("value"))
+		})
+		if err != nil {
+			t.Fatalf("Failed to put value with tag size %d: %v", tagSize, err)
+		}
+		db.Close()
+
+		// The recorded tag size is used without being requested again
+		db, err = Open(filename, 0600, []byte(password))
+		if err != nil {
+			t.Fatalf("Failed to reopen with tag size %d: %v", tagSize, err)
+		}
+		err = db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			v, err := b.Get([]byte("key"))
+			if err != nil {
+				return err
+			}
+			if string(v) != "value" {
+				return fmt.Errorf("value mismatch: got %q, expected %q", v, "value")
+			}
+			return nil
+		})
+		db.Close()
+		if err != nil {
+			t.Fatalf("Validation failed with tag size %d: %v", tagSize, err)
+		}
+	}
+
+	if _, err := OpenWithOptions("test_tag_size_bad.db", 0600, []byte(password), &Options{TagSize: 8}); err == nil {
+		os.Remove("test_tag_size_bad.db")
+		t.Fatalf("Expected error for an 8-byte tag size")
+	}
+	if _, err := OpenWithOptions("test_tag_size_12.db", 0600, []byte(password), &Options{TagSize: 16}); err == nil {
+		t.Fatalf("Expected error for a tag size that does not match the database")
+	}
+}
+
+func TestMmapOptions(t *testing.T) {
+	filename := "test_mmap.db"
+	password := "secure-test-password"
+	bucketName := []byte("MmapBucket")
+	value := []byte("mapped value")
+
+	defer os.Remove(filename)
+
+	opts := &Options{InitialMmapSize: 1 << 20}
+	db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+	if err != nil {
+		t.Fatalf("Failed to open database with mmap options: %v", err)
+	}
+	defer db.Close()
+
+	if bo := opts.boltOptions(); bo.InitialMmapSize != opts.InitialMmapSize {
+		t.Fatalf("InitialMmapSize was not forwarded to bbolt")
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), value)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		got, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, value) {
+			t.Fatalf("Got %q, expected %q", got, value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+}
+
+func TestLockMemory(t *testing.T) {
+	filename := "test_lock_memory.db"
+	password := "secure-test-password"
+	bucketName := []byte("LockedBucket")
+	value := []byte("never swapped")
+
+	defer os.Remove(filename)
+
+	opts := &Options{LockMemory: true}
+	if !opts.boltOptions().Mlock {
+		t.Fatalf("LockMemory was not forwarded to bbolt")
+	}
+	db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+	if !lockMemorySupported {
+		if err == nil {
+			db.Close()
+			t.Fatalf("Expected LockMemory to be rejected on this platform")
+		}
+		return
+	}
+	if errors.Is(err, syscall.ENOMEM) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("Memory locking is not permitted here: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Failed to open database with LockMemory: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Put(bucketName, []byte("key"), value)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		got, err := tx.Get(bucketName, []byte("key"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("Got %q, expected %q", got, value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+}
+
+func TestValuesOutliveTransaction(t *testing.T) {
+	filename := "test_value_lifetime.db"
+	password := "secure-test-password"
+	bucketName := []byte("LifetimeBucket")
+	expected := []byte("retained value")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), expected)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	var fromGet, fromForEach, fromCursor []byte
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if fromGet, err = b.Get([]byte("key")); err != nil {
+			return err
+		}
+		err = b.ForEach(func(_, v []byte) error {
+			fromForEach = v
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		_, fromCursor, err = b.Cursor().First()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+
+	// Closing unmaps the file, so any value aliasing the mmap would now fault
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+	for name, got := range map[string][]byte{"Get": fromGet, "ForEach": fromForEach, "Cursor": fromCursor} {
+		if !bytes.Equal(got, expected) {
+			t.Fatalf("%s value changed after the transaction: got %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestNoSyncCheckpoint(t *testing.T) {
+	filename := "test_checkpoint.db"
+	password := "secure-test-password"
+	bucketName := []byte("CheckpointBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{NoSync: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("durable"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	db.Close()
+	if err := db.Checkpoint(); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Expected ErrDBClosed after Close, got %v", err)
+	}
+}
+
+func TestWipeInputAfterPut(t *testing.T) {
+	filename := "test_wipe_input.db"
+	password := "secure-test-password"
+	bucketName := []byte("WipeBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{WipeInputAfterPut: true})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	value := []byte("wipe me after storing")
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), value)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if !bytes.Equal(value, make([]byte, len(value))) {
+		t.Fatalf("Input slice was not zeroed: %q", value)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		got, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(got) != "wipe me after storing" {
+			return fmt.Errorf("stored value was affected by the wipe: %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+}
+
+func TestRejectNilValue(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reject=%v", reject), func(t *testing.T) {
+			filename := fmt.Sprintf("test_nil_value_%v.db", reject)
+			password := "secure-test-password"
+			bucketName := []byte("NilBucket")
+
+			defer os.Remove(filename)
+
+			db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{RejectNilValue: reject})
+			if err != nil {
+				t.Fatalf("Failed to open SecureBolt: %v", err)
+			}
+			defer db.Close()
+
+			err = db.Update(func(tx *SecureTx) error {
+				b, err := tx.CreateBucket(bucketName)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte("empty"), []byte{}); err != nil {
+					return err
+				}
+				err = b.Put([]byte("nil"), nil)
+				if reject && !errors.Is(err, ErrNilValue) {
+					t.Errorf("Expected ErrNilValue for a nil value, got %v", err)
+				} else if !reject && err != nil {
+					t.Errorf("Expected a nil value to be stored as empty, got %v", err)
+				}
+
+				got, err := b.Get([]byte("nil"))
+				if err != nil {
+					return err
+				}
+				if reject && got != nil {
+					t.Errorf("Expected the rejected value not to be stored, got %q", got)
+				} else if !reject && (got == nil || len(got) != 0) {
+					t.Errorf("Expected an empty value, got %q", got)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to put values: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyValidator(t *testing.T) {
+	filename := "test_key_validator.db"
+	password := "secure-test-password"
+	bucketName := []byte("ValidatedBucket")
+	errBadKey := errors.New("key is not valid UTF-8")
+
+	defer os.Remove(filename)
+
+	opts := &Options{KeyValidator: func(key []byte) error {
+		if !utf8.Valid(key) {
+			return errBadKey
+		}
+		return nil
+	}}
+	db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("good-key"), []byte("value")); err != nil {
+			t.Fatalf("Put rejected a valid key: %v", err)
+		}
+		if err := b.Put([]byte{0xff, 0xfe}, []byte("value")); !errors.Is(err, errBadKey) {
+			t.Fatalf("Expected validator error for invalid key, got %v", err)
+		}
+		if _, err := b.Get([]byte{0xff}); !errors.Is(err, errBadKey) {
+			t.Fatalf("Expected validator error from Get, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+}
+
+func TestMixedCompression(t *testing.T) {
+	filename := "test_mixed_compression.db"
+	password := "secure-test-password"
+	bucketName := []byte("MixedBucket")
+	values := map[string][]byte{
+		"plain":      bytes.Repeat([]byte("stored before compression "), 20),
+		"compressed": bytes.Repeat([]byte("stored after compression "), 20),
+	}
+
+	defer os.Remove(filename)
+
+	put := func(opts *Options, key string) {
+		db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+		if err != nil {
+			t.Fatalf("Failed to open SecureBolt: %v", err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(key), values[key])
+		})
+		if err != nil {
+			t.Fatalf("Failed to put %q: %v", key, err)
+		}
+	}
+	put(nil, "plain")
+	put(&Options{Compression: true}, "compressed")
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Compression: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+
+		// Only the value written with compression enabled is flagged
+		for key, wantFlag := range map[string]bool{"plain": false, "compressed": true} {
+			h, _, _, _, ok := parseEnvelope(tx.Bolt().Bucket(bucketName).Get([]byte(key)), b.aead.NonceSize())
+			if !ok || (h.flags&flagCompressed != 0) != wantFlag {
+				t.Fatalf("Value %q: compressed flag set=%v, expected %v", key, h.flags&flagCompressed != 0, wantFlag)
+			}
+		}
+
+		seen := 0
+		err = b.ForEach(func(k, v []byte) error {
+			seen++
+			if !bytes.Equal(v, values[string(k)]) {
+				return fmt.Errorf("ForEach returned a wrong value for %q", k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if seen != len(values) {
+			return fmt.Errorf("ForEach visited %d values, expected %d", seen, len(values))
+		}
+		for key, want := range values {
+			got, err := b.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, want) {
+				return fmt.Errorf("Get returned a wrong value for %q", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read mixed values: %v", err)
+	}
+}
+
+func TestInvalidKeyLength(t *testing.T) {
+	for _, n := range []int{0, 20, 64} {
+		if _, err := newAEAD(make([]byte, n)); !errors.Is(err, ErrInvalidKeyLength) {
+			t.Fatalf("Expected ErrInvalidKeyLength for a %d-byte key, got %v", n, err)
+		}
+	}
+	if _, err := newAEAD(make([]byte, 32)); err != nil {
+		t.Fatalf("Failed to create cipher with a 32-byte key: %v", err)
+	}
+}
+
+func TestOpenNotADatabase(t *testing.T) {
+	password := "secure-test-password"
+
+	for name, size := range map[string]int{"random": 64 * 1024, "truncated": 1000} {
+		t.Run(name, func(t *testing.T) {
+			filename := "test_not_a_database_" + name + ".db"
+			defer os.Remove(filename)
+
+			junk := make([]byte, size)
+			if _, err := rand.Read(junk); err != nil {
+				t.Fatalf("Failed to generate random bytes: %v", err)
+			}
+			if err := os.WriteFile(filename, junk, 0600); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Timeout: time.Second})
+			if err == nil {
+				db.Close()
+				t.Fatalf("Open succeeded on a file of random bytes")
+			}
+			if !errors.Is(err, ErrNotADatabase) {
+				t.Fatalf("Expected ErrNotADatabase, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStrictFileMode(t *testing.T) {
+	filename := "test_strict_file_mode.db"
+	password := "secure-test-password"
+	strict := &Options{StrictFileMode: true}
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), strict)
+	if err != nil {
+		t.Fatalf("Failed to create database in strict mode: %v", err)
+	}
+	db.Close()
+
+	// Loosen the permissions as a misconfigured deployment would
+	if err := os.Chmod(filename, 0644); err != nil {
+		t.Fatalf("Failed to change file mode: %v", err)
+	}
+	_, err = OpenWithOptions(filename, 0600, []byte(password), strict)
+	if !errors.Is(err, ErrInsecureFilePermissions) {
+		t.Fatalf("Expected ErrInsecureFilePermissions, got %v", err)
+	}
+
+	// Without the option the file opens as before
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database without strict mode: %v", err)
+	}
+	db.Close()
+
+	if err := os.Chmod(filename, 0600); err != nil {
+		t.Fatalf("Failed to change file mode: %v", err)
+	}
+	db, err = OpenWithOptions(filename, 0600, []byte(password), strict)
+	if err != nil {
+		t.Fatalf("Failed to open database with restored permissions: %v", err)
+	}
+	db.Close()
+}
+
+func TestOpenStats(t *testing.T) {
+	filename := "test_open_stats.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	stats := db.OpenStats()
+	if stats.KDFDuration <= 0 {
+		t.Fatalf("Expected a nonzero KDF duration, got %v", stats.KDFDuration)
+	}
+	if !stats.KeyLocked {
+		t.Fatalf("Expected the key to be memory-locked")
+	}
+	if stats.KDFTime != kdfTime || stats.KDFMemoryKiB != kdfMemory || stats.KDFThreads != kdfThreads || stats.KeyLength != kdfKeyLength {
+		t.Fatalf("Unexpected KDF parameters: %+v", stats)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	filename := "test_truncate.db"
+	password := "secure-test-password"
+	bucketName := []byte("StagingBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.PutAll(map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}); err != nil {
+			return err
+		}
+		return tx.Bolt().Bucket(bucketName).SetSequence(42)
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Truncate()
+	})
+	if err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return fmt.Errorf("bucket was removed: %w", err)
+		}
+		if k, _, _ := b.Cursor().First(); k != nil {
+			return fmt.Errorf("key %q survived Truncate", k)
+		}
+		if seq := tx.Bolt().Bucket(bucketName).Sequence(); seq != 42 {
+			return fmt.Errorf("sequence is %d, expected 42", seq)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected state after Truncate: %v", err)
+	}
+}
+
+func TestSwapValues(t *testing.T) {
+	filename := "test_swap.db"
+	password := "secure-test-password"
+	bucketName := []byte("CredentialBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.PutAll(map[string][]byte{"active": []byte("cred-1"), "standby": []byte("cred-2")}); err != nil {
+			return err
+		}
+		if err := b.SwapValues([]byte("active"), []byte("missing")); err == nil {
+			t.Fatalf("SwapValues succeeded with a missing key")
+		}
+		return b.SwapValues([]byte("active"), []byte("standby"))
+	})
+	if err != nil {
+		t.Fatalf("SwapValues failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for key, want := range map[string]string{"active": "cred-2", "standby": "cred-1"} {
+			got, err := b.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if string(got) != want {
+				t.Fatalf("%s holds %q, expected %q", key, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read swapped values: %v", err)
+	}
+}
+
+func TestRenameKey(t *testing.T) {
+	filename := "test_rename_key.db"
+	password := "secure-test-password"
+	bucketName := []byte("UserBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.PutAll(map[string][]byte{"old": []byte("profile"), "taken": []byte("other")}); err != nil {
+			return err
+		}
+		if err := b.RenameKey([]byte("missing"), []byte("new")); err == nil {
+			t.Fatalf("RenameKey succeeded with a missing key")
+		}
+		if err := b.RenameKey([]byte("old"), []byte("taken")); err == nil {
+			t.Fatalf("RenameKey overwrote an existing key")
+		}
+		return b.RenameKey([]byte("old"), []byte("new"))
+	})
+	if err != nil {
+		t.Fatalf("RenameKey failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if v, err := b.Get([]byte("new")); err != nil || string(v) != "profile" {
+			t.Fatalf("Renamed key holds %q, %v, expected %q", v, err, "profile")
+		}
+		if v, err := b.Get([]byte("old")); err != nil || v != nil {
+			t.Fatalf("Old key still holds %q, %v", v, err)
+		}
+		if v, err := b.Get([]byte("taken")); err != nil || string(v) != "other" {
+			t.Fatalf("Existing key was modified: %q, %v", v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read renamed key: %v", err)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	filename := "test_get_multi.db"
+	password := "secure-test-password"
+	bucketName := []byte("MultiBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.PutAll(map[string][]byte{"a": []byte("1"), "b\x00": []byte("2"), "c": {}})
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		got, err := b.GetMulti([][]byte{[]byte("a"), []byte("b\x00"), []byte("b"), []byte("c"), []byte("missing")})
+		if err != nil {
+			return err
+		}
+		want := map[string][]byte{"a": []byte("1"), "b\x00": []byte("2"), "c": {}}
+		if len(got) != len(want) {
+			t.Fatalf("GetMulti returned %d values, expected %d: %q", len(got), len(want), got)
+		}
+		for k, v := range want {
+			if g, ok := got[k]; !ok || !bytes.Equal(g, v) {
+				t.Fatalf("GetMulti[%q] = %q, expected %q", k, g, v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get values: %v", err)
+	}
+}
+
+func TestValueValidator(t *testing.T) {
+	filename := "test_value_validator.db"
+	password := "secure-test-password"
+	bucketName := []byte("Documents")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	errNotJSON := errors.New("value is not JSON")
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		b.SetValueValidator(func(key, value []byte) error {
+			if !json.Valid(value) {
+				return errNotJSON
+			}
+			return nil
+		})
+
+		if err := b.Put([]byte("good"), []byte(`{"name":"alice"}`)); err != nil {
+			t.Fatalf("Valid JSON was rejected: %v", err)
+		}
+		if err := b.Put([]byte("bad"), []byte("not json")); !errors.Is(err, errNotJSON) {
+			t.Fatalf("Expected the validator error, got %v", err)
+		}
+		if err := b.PutWithTTL([]byte("bad"), []byte("{"), time.Hour); !errors.Is(err, errNotJSON) {
+			t.Fatalf("Expected the validator error from PutWithTTL, got %v", err)
+		}
+		if v, err := b.Get([]byte("bad")); err != nil || v != nil {
+			t.Fatalf("Rejected value was stored: %q, %v", v, err)
+		}
+
+		// Removing the validator allows any value again
+		b.SetValueValidator(nil)
+		return b.Put([]byte("raw"), []byte("not json"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+}
+
+func TestPepper(t *testing.T) {
+	filename := "test_pepper.db"
+	password := "secure-test-password"
+	pepper := []byte("server-wide-pepper")
+	bucketName := []byte("Peppered")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{Pepper: pepper})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	db.Close()
+
+	get := func(opts *Options) ([]byte, error) {
+		db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+		if err != nil {
+			t.Fatalf("Failed to reopen SecureBolt: %v", err)
+		}
+		defer db.Close()
+		var value []byte
+		err = db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			value, err = b.Get([]byte("key"))
+			return err
+		})
+		return value, err
+	}
+
+	if v, err := get(&Options{Pepper: pepper}); err != nil || string(v) != "value" {
+		t.Fatalf("Failed to read with the pepper: %q, %v", v, err)
+	}
+	if _, err := get(nil); err == nil {
+		t.Fatalf("Value decrypted without the pepper")
+	}
+	if _, err := get(&Options{Pepper: []byte("another-pepper")}); err == nil {
+		t.Fatalf("Value decrypted with a different pepper")
+	}
+}
+
+func TestForEachBatch(t *testing.T) {
+	filename := "test_foreach_batch.db"
+	password := "secure-test-password"
+	bucketName := []byte("LargeBucket")
+	const count = 1003
+	const batchSize = 100
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := b.Put(Uint64Key(uint64(i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Bolt().Bucket(bucketName).CreateBucket([]byte("nested"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		seen := make(map[uint64]bool)
+		batches := 0
+		err = b.ForEachBatch(batchSize, func(batch []KV) error {
+			batches++
+			if len(batch) == 0 || len(batch) > batchSize {
+				t.Fatalf("Batch of %d entries, expected 1 to %d", len(batch), batchSize)
+			}
+			for _, kv := range batch {
+				n, err := ParseUint64Key(kv.Key)
+				if err != nil {
+					return err
+				}
+				if seen[n] {
+					t.Fatalf("Entry %d seen twice", n)
+				}
+				seen[n] = true
+				if want := fmt.Sprintf("value%d", n); string(kv.Value) != want {
+					t.Fatalf("Entry %d = %q, expected %q", n, kv.Value, want)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(seen) != count {
+			t.Fatalf("Saw %d entries, expected %d", len(seen), count)
+		}
+		if batches != (count+batchSize-1)/batchSize {
+			t.Fatalf("Got %d batches, expected %d", batches, (count+batchSize-1)/batchSize)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachBatch failed: %v", err)
+	}
+}
+
+func TestErasePrefix(t *testing.T) {
+	filename := "test_erase_prefix.db"
+	password := "secure-test-password"
+	bucketName := []byte("Subjects")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	var erased int
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		err = b.PutAll(map[string][]byte{
+			"user:41/name":  []byte("bob"),
+			"user:42/email": []byte("alice@example.com"),
+			"user:42/name":  []byte("alice"),
+			"user:42/phone": []byte("555-0100"),
+			"user:420/name": []byte("carol"),
+		})
+		if err != nil {
+			return err
+		}
+		erased, err = b.ErasePrefix([]byte("user:42/"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ErasePrefix failed: %v", err)
+	}
+	if erased != 3 {
+		t.Fatalf("Erased %d keys, expected 3", erased)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		var remaining []string
+		err = b.ForEach(func(k, v []byte) error {
+			remaining = append(remaining, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(remaining) != 2 || remaining[0] != "user:41/name" || remaining[1] != "user:420/name" {
+			t.Fatalf("Unexpected keys after erasure: %q", remaining)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read remaining keys: %v", err)
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	filename := "test_delete_where.db"
+	password := "secure-test-password"
+	bucketName := []byte("Sessions")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	var deleted int
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			state := "active"
+			if i%3 == 0 {
+				state = "revoked"
+			}
+			if err := b.Put([]byte(fmt.Sprintf("session%03d", i)), []byte(state)); err != nil {
+				return err
+			}
+		}
+		deleted, err = b.DeleteWhere(func(k, v []byte) (bool, error) {
+			return string(v) == "revoked", nil
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("DeleteWhere failed: %v", err)
+	}
+	if deleted != 34 {
+		t.Fatalf("Deleted %d keys, expected 34", deleted)
+	}
+
+	errStop := errors.New("stop")
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		remaining := 0
+		err = b.ForEach(func(k, v []byte) error {
+			if string(v) != "active" {
+				t.Errorf("Unexpected value %q for key %q", v, k)
+			}
+			remaining++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if remaining != 66 {
+			t.Errorf("Found %d keys after deletion, expected 66", remaining)
+		}
+
+		// A predicate error deletes nothing
+		n, err := b.DeleteWhere(func(k, v []byte) (bool, error) {
+			if string(k) == "session050" {
+				return false, errStop
+			}
+			return true, nil
+		})
+		if !errors.Is(err, errStop) || n != 0 {
+			t.Errorf("DeleteWhere() = %d, %v, expected 0 and the predicate error", n, err)
+		}
+		if v, err := b.Get([]byte("session001")); err != nil || v == nil {
+			t.Errorf("Expected session001 to survive a failed DeleteWhere, got %q, %v", v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to check remaining keys: %v", err)
+	}
+}
+
+func TestTxPut(t *testing.T) {
+	filename := "test_tx_put.db"
+	password := "secure-test-password"
+	bucketName := []byte("Created")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		if err := tx.Put(bucketName, []byte("first"), []byte("1")); err != nil {
+			return err
+		}
+		// The second Put finds the bucket created by the first
+		return tx.Put(bucketName, []byte("second"), []byte("2"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		got, err := b.GetMulti([][]byte{[]byte("first"), []byte("second")})
+		if err != nil {
+			return err
+		}
+		if string(got["first"]) != "1" || string(got["second"]) != "2" {
+			t.Fatalf("Unexpected values %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+}
+
+func TestTxGet(t *testing.T) {
+	filename := "test_tx_get.db"
+	password := "secure-test-password"
+	bucketName := []byte("Existing")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Put(bucketName, []byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		for _, c := range []struct {
+			bucket, key []byte
+			want        []byte
+		}{
+			{bucketName, []byte("key"), []byte("value")},
+			{bucketName, []byte("missing"), nil},
+			{[]byte("Missing"), []byte("key"), nil},
+		} {
+			v, err := tx.Get(c.bucket, c.key)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(v, c.want) || (v == nil) != (c.want == nil) {
+				t.Errorf("Get(%q, %q) = %q, expected %q", c.bucket, c.key, v, c.want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get values: %v", err)
+	}
+}
+
+func TestEnsureBuckets(t *testing.T) {
+	filename := "test_ensure_buckets.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.EnsureBuckets([]byte("users"), []byte("sessions")); err != nil {
+		t.Fatalf("Failed to ensure buckets: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Put([]byte("users"), []byte("alice"), []byte("admin"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if err := db.EnsureBuckets([]byte("sessions"), []byte("users"), []byte("audit")); err != nil {
+		t.Fatalf("Failed to ensure overlapping buckets: %v", err)
+	}
+	if err := db.EnsureBuckets([]byte("extra"), []byte("securebolt_meta")); err == nil {
+		t.Fatalf("Expected a reserved bucket name to be rejected")
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		for _, name := range []string{"users", "sessions", "audit"} {
+			if _, err := tx.Bucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if tx.Bolt().Bucket([]byte("extra")) != nil {
+			t.Errorf("Expected a rejected call to create no bucket")
+		}
+		v, err := tx.Get([]byte("users"), []byte("alice"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "admin" {
+			t.Errorf("Expected existing contents to be kept, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to check buckets: %v", err)
+	}
+}
+
+func TestPutAll(t *testing.T) {
+	filename := "test_put_all.db"
+	password := "secure-test-password"
+	bucketName := []byte("PutAllBucket")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.PutAll(map[string][]byte{
+			"alice": []byte("alice-secret"),
+			"bob":   []byte("bob-secret"),
+			"carol": []byte("carol-secret"),
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to put entries: %v", err)
+	}
+
+	// A failing value rolls back the entries written before it
+	errRejected := errors.New("value rejected")
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		b.SetValueValidator(func(key, value []byte) error {
+			if string(key) == "dave" {
+				return errRejected
+			}
+			return nil
+		})
+		return b.PutAll(map[string][]byte{
+			"alice": []byte("alice-updated"),
+			"anna":  []byte("anna-secret"),
+			"dave":  []byte("dave-secret"),
+			"erin":  []byte("erin-secret"),
+		})
+	})
+	if !errors.Is(err, errRejected) {
+		t.Fatalf("Expected the validator error, got %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		want := map[string]string{
+			"alice": "alice-secret",
+			"bob":   "bob-secret",
+			"carol": "carol-secret",
+		}
+		for k, v := range want {
+			got, err := b.Get([]byte(k))
+			if err != nil {
+				return err
+			}
+			if string(got) != v {
+				t.Errorf("Expected %q for key %q, got %q", v, k, got)
+			}
+		}
+		for _, k := range []string{"anna", "dave", "erin"} {
+			got, err := b.Get([]byte(k))
+			if err != nil {
+				return err
+			}
+			if got != nil {
+				t.Errorf("Expected key %q from the failed PutAll not to be written, got %q", k, got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read entries: %v", err)
+	}
+}
+
+func TestCreateBucketRejectsReservedNames(t *testing.T) {
+	filename := "test_reserved_buckets.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	names := [][]byte{
+		metaBucket,
+		externalBucket,
+		append(append([]byte{}, nestedBucketPrefix...), CompositeKey([]byte("users"), []byte("docs"))...),
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucket(name); err == nil {
+				t.Errorf("Expected CreateBucket(%q) to be rejected", name)
+			}
+			if _, err := tx.CreateBucketIfNotExists(name); err == nil {
+				t.Errorf("Expected CreateBucketIfNotExists(%q) to be rejected", name)
+			}
+			if err := tx.Put(name, []byte("key"), []byte("value")); err == nil {
+				t.Errorf("Expected Put into %q to be rejected", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to run transaction: %v", err)
+	}
+}
+
+func TestRenameKeyOverDeletedKey(t *testing.T) {
+	filename := "test_rename_key_deleted.db"
+	password := "secure-test-password"
+	bucketName := []byte("UserBucket")
+
+	defer os.Remove(filename)
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExternalThreshold: 16})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 64)
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("old"), large); err != nil {
+			return err
+		}
+		if err := b.PutWithTTL([]byte("expired"), large, time.Millisecond); err != nil {
+			return err
+		}
+		if err := b.PutAll(map[string][]byte{"deleted": []byte("gone"), "taken": []byte("other")}); err != nil {
+			return err
+		}
+		return b.SoftDelete([]byte("deleted"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to populate bucket: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	external := func(tx *SecureTx) int {
+		n := 0
+		tx.Bolt().Bucket(externalBucket).ForEach(func(_, _ []byte) error {
+			n++
+			return nil
+		})
+		return n
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.RenameKey([]byte("old"), []byte("expired")); err != nil {
+			t.Fatalf("Failed to rename onto an expired key: %v", err)
+		}
+		if n := external(tx); n != 1 {
+			t.Fatalf("Expected 1 external value after renaming onto an expired key, got %d", n)
+		}
+		if err := b.RenameKey([]byte("expired"), []byte("deleted")); err != nil {
+			t.Fatalf("Failed to rename onto a tombstone: %v", err)
+		}
+		if err := b.RenameKey([]byte("deleted"), []byte("taken")); err == nil {
+			t.Fatalf("RenameKey overwrote an existing key")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenameKey failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if v, err := b.Get([]byte("deleted")); err != nil || !bytes.Equal(v, large) {
+			t.Fatalf("Renamed key holds %q, %v, expected %q", v, err, large)
+		}
+		for _, k := range []string{"old", "expired"} {
+			if v, err := b.Get([]byte(k)); err != nil || v != nil {
+				t.Fatalf("Key %q still holds %q, %v", k, v, err)
+			}
+		}
+		if n := external(tx); n != 1 {
+			t.Fatalf("Expected 1 external value, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read renamed key: %v", err)
+	}
+}
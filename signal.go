@@ -0,0 +1,39 @@
+package securebolt
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// InstallSignalHandlers closes the database when the process receives one of
+// the given signals, defaulting to SIGTERM when none are given. On delivery
+// the database is marked closed so no new transactions start, in-flight
+// transactions are allowed to finish, and then the key is destroyed and the
+// file closed, exactly as Close does. The handler is removed once the
+// database is closed by any means.
+//
+// Installing the handler replaces the default action for those signals, so
+// the process no longer exits on them; callers that want to exit should do so
+// after observing ErrDBClosed or their own notification of the same signals.
+//
+// os.Interrupt is not a default because the package installs
+// memguard.CatchInterrupt when it is loaded: on SIGINT memguard wipes its
+// buffers and exits the process at once, before any transaction could be
+// drained here. Passing os.Interrupt does not change that.
+func (s *SecureBolt) InstallSignalHandlers(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case <-ch:
+			s.Close()
+		case <-s.done:
+		}
+	}()
+}
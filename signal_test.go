@@ -0,0 +1,84 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInstallSignalHandlers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("A process cannot send itself SIGTERM on Windows")
+	}
+	filename := "test_signal.db"
+	password := "secure-test-password"
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.InstallSignalHandlers()
+
+	// A transaction in flight when the signal arrives is allowed to finish
+	inTx := make(chan struct{})
+	finished := make(chan error, 1)
+	go func() {
+		finished <- db.Update(func(tx *SecureTx) error {
+			close(inTx)
+			time.Sleep(100 * time.Millisecond)
+			b, err := tx.CreateBucket([]byte("Drained"))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("key"), []byte("value"))
+		})
+	}()
+	<-inTx
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find own process: %v", err)
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+	if err := <-finished; err != nil {
+		t.Fatalf("Expected the in-flight transaction to commit, got %v", err)
+	}
+
+	select {
+	case <-db.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Database was not closed on SIGTERM")
+	}
+	if err := db.View(func(tx *SecureTx) error { return nil }); !errors.Is(err, ErrDBClosed) {
+		t.Fatalf("Expected ErrDBClosed after SIGTERM, got %v", err)
+	}
+
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket([]byte("Drained"))
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "value" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read drained write: %v", err)
+	}
+}
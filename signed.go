@@ -0,0 +1,56 @@
+package securebolt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// signatureLength is the length of the HMAC-SHA256 appended by PutSigned.
+const signatureLength = sha256.Size
+
+// PutSigned stores value like Put, together with an HMAC-SHA256 over the key
+// and value under signingKey. The signature is kept inside the encrypted
+// payload and is separate from the database key, so VerifySigned proves that
+// the record was written by a holder of signingKey rather than merely by
+// someone able to open the database. Get, ForEach and cursors return the
+// value without the signature.
+func (sb *SecureBucket) PutSigned(key, value, signingKey []byte) error {
+	if len(signingKey) == 0 {
+		return errors.New("signing key cannot be empty")
+	}
+	return sb.put(key, value, recordSignature(key, value, signingKey), 0)
+}
+
+// VerifySigned returns the value of key and whether it carries a valid
+// signature under signingKey. ok is false when the signature does not match
+// or the value was stored without PutSigned. A missing key returns a nil
+// value and false.
+func (sb *SecureBucket) VerifySigned(key, signingKey []byte) (value []byte, ok bool, err error) {
+	if err := sb.checkKey(key); err != nil {
+		return nil, false, err
+	}
+	if err := sb.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	encryptedValue := sb.bucket.Get(key)
+	if encryptedValue == nil {
+		return nil, false, nil
+	}
+	rec, err := sb.openFull(key, encryptedValue)
+	if err != nil {
+		return nil, false, err
+	}
+	if rec.signature == nil {
+		return rec.value, false, nil
+	}
+	return rec.value, hmac.Equal(rec.signature, recordSignature(key, rec.value, signingKey)), nil
+}
+
+// recordSignature computes the PutSigned signature of a key and value.
+func recordSignature(key, value, signingKey []byte) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	writeField(mac, key)
+	mac.Write(value)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,68 @@
+package securebolt
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPutSigned(t *testing.T) {
+	filename := "test_signed.db"
+	password := "secure-test-password"
+	bucketName := []byte("SignedBucket")
+	signingKey := []byte("approver-signing-key")
+	value := []byte("transfer 100 to bob")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.PutSigned([]byte("signed"), value, signingKey); err != nil {
+			return err
+		}
+		return b.Put([]byte("unsigned"), value)
+	})
+	if err != nil {
+		t.Fatalf("Failed to put values: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+
+		// Get hides the signature
+		got, err := b.Get([]byte("signed"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, value) {
+			t.Fatalf("Get returned %q, expected %q", got, value)
+		}
+
+		got, ok, err := b.VerifySigned([]byte("signed"), signingKey)
+		if err != nil || !ok || !bytes.Equal(got, value) {
+			t.Fatalf("Valid signature rejected: ok=%v err=%v value=%q", ok, err, got)
+		}
+		if _, ok, err := b.VerifySigned([]byte("signed"), []byte("wrong-key")); err != nil || ok {
+			t.Fatalf("Wrong signing key accepted: ok=%v err=%v", ok, err)
+		}
+		if _, ok, err := b.VerifySigned([]byte("unsigned"), signingKey); err != nil || ok {
+			t.Fatalf("Unsigned value accepted: ok=%v err=%v", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to verify values: %v", err)
+	}
+}
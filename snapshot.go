@@ -0,0 +1,134 @@
+package securebolt
+
+import (
+	"errors"
+	"sync"
+)
+
+// SecureSnapshot is a consistent, read-only view of the database that spans
+// any number of reads, backed by a single long-lived bbolt read transaction.
+// Every read sees the database as it was when the snapshot was taken, even if
+// writes commit in the meantime. Reads through a snapshot neither use nor
+// fill the decrypted value cache, since its contents may be newer than the
+// snapshot.
+//
+// While a snapshot is held, bbolt cannot reuse the pages freed by later
+// writes, so the file grows with every write, and a write that needs to grow
+// the file's memory map waits until the snapshot is released. A goroutine
+// holding a snapshot must not write itself, or wait for such a write, unless
+// Options.InitialMmapSize is large enough that the map never grows while the
+// snapshot is held; otherwise it deadlocks. Release snapshots as soon as
+// they are no longer needed. Close releases any snapshot still held.
+type SecureSnapshot struct {
+	mu       sync.Mutex
+	stx      *SecureTx
+	released bool
+}
+
+// errSnapshotReleased is returned by the methods of a released snapshot.
+var errSnapshotReleased = errors.New("snapshot has been released")
+
+// Snapshot starts a consistent read-only view of the database. The caller
+// must call Release when done with it.
+func (s *SecureBolt) Snapshot() (*SecureSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed.Load() {
+		return nil, ErrDBClosed
+	}
+
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	km := s.keys()
+	snap := &SecureSnapshot{stx: &SecureTx{
+		tx:       tx,
+		db:       s,
+		aead:     km.aead,
+		keyLock:  km.keyLock,
+		snapshot: true,
+	}}
+
+	s.snapMu.Lock()
+	if s.snapshots == nil {
+		s.snapshots = make(map[*SecureSnapshot]struct{})
+	}
+	s.snapshots[snap] = struct{}{}
+	s.snapMu.Unlock()
+	return snap, nil
+}
+
+// Bucket returns the named bucket as of the snapshot. The bucket must not be
+// used after the snapshot is released.
+func (snap *SecureSnapshot) Bucket(name []byte) (*SecureBucket, error) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.released {
+		return nil, errSnapshotReleased
+	}
+	return snap.stx.Bucket(name)
+}
+
+// Get returns the decrypted value of key in the named bucket as of the
+// snapshot, or nil when the key does not exist.
+func (snap *SecureSnapshot) Get(bucket, key []byte) ([]byte, error) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.released {
+		return nil, errSnapshotReleased
+	}
+	b, err := snap.stx.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(key)
+}
+
+// ForEach calls fn with each key and decrypted value of the named bucket as
+// of the snapshot, as SecureBucket.ForEach does. Keys are only valid until
+// the snapshot is released.
+func (snap *SecureSnapshot) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.released {
+		return errSnapshotReleased
+	}
+	b, err := snap.stx.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.ForEach(fn)
+}
+
+// Release ends the snapshot and closes its read transaction. Releasing a
+// snapshot more than once has no effect.
+func (snap *SecureSnapshot) Release() error {
+	s := snap.stx.db
+	s.snapMu.Lock()
+	delete(s.snapshots, snap)
+	s.snapMu.Unlock()
+	return snap.release()
+}
+
+// release closes the read transaction unless it is already closed.
+func (snap *SecureSnapshot) release() error {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if snap.released {
+		return nil
+	}
+	snap.released = true
+	return snap.stx.tx.Rollback()
+}
+
+// releaseSnapshots releases every snapshot still held, so that closing the
+// database does not wait for them.
+func (s *SecureBolt) releaseSnapshots() {
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	for snap := range s.snapshots {
+		delete(s.snapshots, snap)
+		snap.release()
+	}
+}
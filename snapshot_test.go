@@ -0,0 +1,115 @@
+package securebolt
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	filename := "test_snapshot.db"
+	password := "secure-test-password"
+	bucketName := []byte("Reports")
+
+	defer os.Remove(filename)
+
+	// The memory map must not grow while this goroutine holds a snapshot
+	db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{CacheSize: 16, InitialMmapSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	put := func(value string) {
+		err := db.Update(func(tx *SecureTx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("total"), []byte(value))
+		})
+		if err != nil {
+			t.Fatalf("Failed to put value: %v", err)
+		}
+	}
+	get := func() string {
+		var value []byte
+		err := db.View(func(tx *SecureTx) error {
+			b, err := tx.Bucket(bucketName)
+			if err != nil {
+				return err
+			}
+			value, err = b.Get([]byte("total"))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		return string(value)
+	}
+
+	put("1")
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+
+	// Writes commit while the snapshot is held, but it keeps its view
+	put("2")
+	if got := get(); got != "2" {
+		t.Fatalf("View sees %q, expected %q", got, "2")
+	}
+	for i := 0; i < 2; i++ {
+		v, err := snap.Get(bucketName, []byte("total"))
+		if err != nil {
+			t.Fatalf("Failed to get from snapshot: %v", err)
+		}
+		if string(v) != "1" {
+			t.Fatalf("Snapshot sees %q, expected %q", v, "1")
+		}
+	}
+	count := 0
+	err = snap.ForEach(bucketName, func(k, v []byte) error {
+		count++
+		if string(v) != "1" {
+			t.Fatalf("Snapshot ForEach sees %q, expected %q", v, "1")
+		}
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("Snapshot ForEach visited %d entries: %v", count, err)
+	}
+
+	// Buckets created after the snapshot are not part of it
+	err = db.Update(func(tx *SecureTx) error {
+		return tx.Put([]byte("Later"), []byte("key"), []byte("new"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write new bucket: %v", err)
+	}
+	if _, err := snap.Bucket([]byte("Later")); err == nil {
+		t.Fatalf("Snapshot sees a bucket created after it was taken")
+	}
+
+	// Snapshot reads do not leak the old value into the cache
+	if got := get(); got != "2" {
+		t.Fatalf("View sees %q after snapshot reads, expected %q", got, "2")
+	}
+
+	if err := snap.Release(); err != nil {
+		t.Fatalf("Failed to release snapshot: %v", err)
+	}
+	if err := snap.Release(); err != nil {
+		t.Fatalf("Second release failed: %v", err)
+	}
+	if _, err := snap.Get(bucketName, []byte("total")); err == nil {
+		t.Fatalf("Get succeeded on a released snapshot")
+	}
+
+	// Close releases snapshots that are still held
+	if _, err := db.Snapshot(); err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close with a held snapshot: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package securebolt
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/awnumar/memguard"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	splitThresholdKey = []byte("split_threshold") // Number of shares required to open
+	splitCountKey     = []byte("split_count")     // Total number of shares
+)
+
+// maxSplitShares is the largest number of shares GF(256) sharing supports.
+const maxSplitShares = 255
+
+// splitSecretLength is the size of the random secret protected by the shares.
+const splitSecretLength = 32
+
+// OpenSplit opens or creates a database protected by split knowledge: a random
+// secret is divided with Shamir's Secret Sharing into one share per entry of
+// shares, and any threshold of them reconstruct it. Each share is encrypted
+// under a key derived from its password and stored in the metadata bucket
+// together with the sharing parameters.
+//
+// shares is positional: shares[i] is the password of operator i. When creating
+// a database every password must be provided; when opening an existing one,
+// absent operators are passed as nil and at least threshold passwords must be
+// present. threshold must match the value the database was created with.
+func OpenSplit(filename string, mode fs.FileMode, shares [][]byte, threshold int) (*SecureBolt, error) {
+	if len(shares) > maxSplitShares {
+		return nil, fmt.Errorf("at most %d shares are supported", maxSplitShares)
+	}
+	if threshold < 1 || threshold > len(shares) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d", len(shares))
+	}
+	defer func() {
+		for _, share := range shares {
+			memguard.WipeBytes(share) // Securely erase the share passwords
+		}
+	}()
+
+	return open(filename, mode, nil, nil, func(db *bbolt.DB, salt []byte, isNewDB bool) ([]byte, error) {
+		if isNewDB {
+			return createSplit(db, shares, threshold)
+		}
+		return recoverSplit(db, shares, threshold)
+	})
+}
+
+// requireNotSplit rejects password-based opens of a split-knowledge database.
+func requireNotSplit(db *bbolt.DB) error {
+	return db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(metaBucket); b != nil && b.Get(splitCountKey) != nil {
+			return errors.New("database is protected by split knowledge, use OpenSplit")
+		}
+		return nil
+	})
+}
+
+// splitShareKey returns the metadata key holding the encrypted share i.
+func splitShareKey(i int) []byte {
+	return []byte("split_share_" + strconv.Itoa(i))
+}
+
+// createSplit generates the secret for a new database, splits it and stores
+// each share encrypted under its operator's password.
+func createSplit(db *bbolt.DB, shares [][]byte, threshold int) ([]byte, error) {
+	for i, share := range shares {
+		if len(share) == 0 {
+			return nil, fmt.Errorf("share %d cannot be empty", i)
+		}
+	}
+
+	secret := make([]byte, splitSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	points, err := shamirSplit(secret, len(shares), threshold)
+	if err != nil {
+		memguard.WipeBytes(secret)
+		return nil, err
+	}
+
+	sealed := make([][]byte, len(shares))
+	for i, share := range shares {
+		sealed[i], err = sealShare(share, points[i])
+		memguard.WipeBytes(points[i])
+		if err != nil {
+			memguard.WipeBytes(secret)
+			return nil, fmt.Errorf("failed to protect share %d: %w", i, err)
+		}
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(splitThresholdKey, []byte(strconv.Itoa(threshold))); err != nil {
+			return err
+		}
+		if err := b.Put(splitCountKey, []byte(strconv.Itoa(len(shares)))); err != nil {
+			return err
+		}
+		for i, s := range sealed {
+			if err := b.Put(splitShareKey(i), s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		memguard.WipeBytes(secret)
+		return nil, fmt.Errorf("failed to store shares: %w", err)
+	}
+	return secret, nil
+}
+
+// recoverSplit decrypts the shares of the provided passwords and combines
+// them back into the secret.
+func recoverSplit(db *bbolt.DB, shares [][]byte, threshold int) ([]byte, error) {
+	var storedThreshold, count int
+	sealed := make(map[int][]byte)
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(metaBucket)
+		if b == nil || b.Get(splitCountKey) == nil {
+			return errors.New("database was not created with OpenSplit")
+		}
+		var err error
+		if storedThreshold, err = strconv.Atoi(string(b.Get(splitThresholdKey))); err != nil {
+			return fmt.Errorf("invalid split threshold: %w", err)
+		}
+		if count, err = strconv.Atoi(string(b.Get(splitCountKey))); err != nil {
+			return fmt.Errorf("invalid split count: %w", err)
+		}
+		for i := 0; i < count && i < len(shares); i++ {
+			if s := b.Get(splitShareKey(i)); s != nil {
+				sealed[i] = append([]byte{}, s...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if threshold != storedThreshold {
+		return nil, fmt.Errorf("threshold %d does not match the database threshold %d", threshold, storedThreshold)
+	}
+	if len(shares) != count {
+		return nil, fmt.Errorf("expected %d share positions, got %d", count, len(shares))
+	}
+
+	var points [][]byte
+	defer func() {
+		for _, p := range points {
+			memguard.WipeBytes(p)
+		}
+	}()
+	for i, share := range shares {
+		if len(share) == 0 {
+			continue
+		}
+		s, ok := sealed[i]
+		if !ok {
+			return nil, fmt.Errorf("share %d not found in metadata", i)
+		}
+		point, err := openShare(share, s)
+		if err != nil {
+			return nil, fmt.Errorf("share %d is incorrect: %w", i, err)
+		}
+		points = append(points, point)
+		if len(points) == threshold {
+			return shamirCombine(points), nil
+		}
+	}
+	return nil, fmt.Errorf("at least %d shares are required, got %d", threshold, len(points))
+}
+
+// sealShare encrypts a share point under a key derived from password. The
+// result is the derivation salt followed by the encrypted point.
+func sealShare(password, point []byte) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, keyLock, err := shareAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+
+	ciphertext, err := encryptData(point, aead)
+	if err != nil {
+		return nil, err
+	}
+	return append(salt, ciphertext...), nil
+}
+
+// openShare reverses sealShare.
+func openShare(password, sealed []byte) ([]byte, error) {
+	if len(sealed) < saltLength {
+		return nil, errors.New("sealed share is too short")
+	}
+	aead, keyLock, err := shareAEAD(password, sealed[:saltLength])
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+
+	return decryptData(sealed[saltLength:], aead)
+}
+
+// shareAEAD derives the cipher protecting a single share.
+func shareAEAD(password, salt []byte) (cipher.AEAD, *memguard.LockedBuffer, error) {
+	keyLock, err := deriveKey(password, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(keyLock.Bytes())
+	if err != nil {
+		keyLock.Destroy()
+		return nil, nil, err
+	}
+	return aead, keyLock, nil
+}
+
+// shamirSplit splits secret into n shares over GF(256), any k of which
+// reconstruct it. Each share is its x coordinate (1..n) followed by one
+// polynomial evaluation per secret byte.
+func shamirSplit(secret []byte, n, k int) ([][]byte, error) {
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, k)
+	defer memguard.WipeBytes(coeffs)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients: %w", err)
+		}
+		for _, share := range shares {
+			share[j+1] = gfEval(coeffs, share[0])
+		}
+	}
+	return shares, nil
+}
+
+// shamirCombine reconstructs the secret from shares produced by shamirSplit
+// using Lagrange interpolation at x = 0.
+func shamirCombine(shares [][]byte) []byte {
+	secret := make([]byte, len(shares[0])-1)
+	for i, si := range shares {
+		// Lagrange basis polynomial of share i evaluated at zero
+		num, den := byte(1), byte(1)
+		for m, sm := range shares {
+			if m == i {
+				continue
+			}
+			num = gfMul(num, sm[0])
+			den = gfMul(den, sm[0]^si[0])
+		}
+		basis := gfMul(num, gfInv(den))
+		for j := range secret {
+			secret[j] ^= gfMul(si[j+1], basis)
+		}
+	}
+	return secret
+}
+
+// gfEval evaluates the polynomial with the given coefficients at x.
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial, in constant time.
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= a & -(b & 1)
+		a = (a << 1) ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a in GF(256), computed as a^254.
+func gfInv(a byte) byte {
+	r := byte(1)
+	for i := 0; i < 254; i++ {
+		r = gfMul(r, a)
+	}
+	return r
+}
@@ -0,0 +1,105 @@
+package securebolt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShamirCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := shamirSplit(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+
+	// Every combination of three shares reconstructs the secret
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got := shamirCombine([][]byte{shares[a], shares[b], shares[c]})
+				if !bytes.Equal(got, secret) {
+					t.Fatalf("Shares %d,%d,%d reconstructed %x, expected %x", a, b, c, got, secret)
+				}
+			}
+		}
+	}
+
+	// Fewer shares than the threshold do not
+	if got := shamirCombine(shares[:2]); bytes.Equal(got, secret) {
+		t.Fatalf("Two shares reconstructed the secret with a threshold of three")
+	}
+}
+
+func TestOpenSplit(t *testing.T) {
+	filename := "test_split.db"
+	bucketName := []byte("SplitBucket")
+	passwords := []string{"operator-one", "operator-two", "operator-three"}
+	shares := func(present ...int) [][]byte {
+		s := make([][]byte, len(passwords))
+		for _, i := range present {
+			s[i] = []byte(passwords[i])
+		}
+		return s
+	}
+
+	defer os.Remove(filename)
+
+	db, err := OpenSplit(filename, 0600, shares(0, 1, 2), 2)
+	if err != nil {
+		t.Fatalf("Failed to create split database: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to put value: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// Any two operators can open the database
+	db, err = OpenSplit(filename, 0600, shares(0, 2), 2)
+	if err != nil {
+		t.Fatalf("Failed to open with two shares: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, []byte("value")) {
+			return fmt.Errorf("value mismatch: got %q, expected %q", v, "value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close SecureBolt: %v", err)
+	}
+
+	// A single operator, a wrong share or a plain password cannot
+	if _, err := OpenSplit(filename, 0600, shares(1), 2); err == nil {
+		t.Fatalf("Expected error when opening with a single share")
+	}
+	wrong := shares(0)
+	wrong[1] = []byte("not-operator-two")
+	if _, err := OpenSplit(filename, 0600, wrong, 2); err == nil {
+		t.Fatalf("Expected error when opening with a wrong share")
+	}
+	if _, err := Open(filename, 0600, []byte(passwords[0])); err == nil {
+		t.Fatalf("Expected error when opening a split database with a password")
+	}
+}
@@ -0,0 +1,171 @@
+package securebolt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// keyCheckKey is the securebolt_meta entry holding the key-check verifier.
+var keyCheckKey = []byte("key_check")
+
+// keyCheckSubkeyInfo is the HKDF info of the key the key-check verifier is
+// computed with.
+const keyCheckSubkeyInfo = "securebolt key check"
+
+// keyCheck returns the key-check verifier of the key material: an HMAC
+// under a subkey, which reveals nothing about the key itself.
+func keyCheck(km *keyMaterial) ([]byte, error) {
+	keyLock, err := km.deriveSubkey(keyCheckSubkeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer keyLock.Destroy()
+	h := hmac.New(sha256.New, keyLock.Bytes())
+	h.Write([]byte(keyCheckSubkeyInfo))
+	return h.Sum(nil), nil
+}
+
+// readKeyCheck returns a copy of the stored key-check verifier, or nil when
+// the database has none.
+func readKeyCheck(db *bbolt.DB) ([]byte, error) {
+	var stored []byte
+	err := db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(metaBucket); b != nil {
+			if v := b.Get(keyCheckKey); v != nil {
+				stored = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key check: %w", err)
+	}
+	return stored, nil
+}
+
+// verifyKeyCheck compares the derived key with the key-check verifier stored
+// in the securebolt_meta bucket and returns ErrInvalidPassword when they do
+// not match. A database without a verifier is accepted as is, and a new one
+// is given one when created with Options.StrictSecurity; an existing one only
+// gets one from adoptKeyCheck, once the key is known to be right.
+func verifyKeyCheck(db *bbolt.DB, km *keyMaterial, opts *Options, isNewDB bool) error {
+	stored, err := readKeyCheck(db)
+	if err != nil {
+		return err
+	}
+	if stored == nil && !(isNewDB && opts.StrictSecurity) {
+		return nil
+	}
+
+	check, err := keyCheck(km)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		if !hmac.Equal(stored, check) {
+			return ErrInvalidPassword
+		}
+		return nil
+	}
+	return storeKeyCheck(db, check)
+}
+
+// adoptKeyCheck gives an existing database without a key-check verifier one
+// when it is opened for writing with Options.StrictSecurity. The verifier is
+// computed from whatever key was derived, so it is only stored once that key
+// has decrypted a value already in the database; otherwise a first strict
+// open with a wrong password would lock out the right one. A database that
+// holds no value yet is left without a verifier, and a value that does not
+// decrypt means the password is wrong. aead is the cipher values are opened
+// with.
+func adoptKeyCheck(db *bbolt.DB, km *keyMaterial, aead cipher.AEAD, opts *Options) error {
+	if !opts.StrictSecurity || opts.ReadOnly {
+		return nil
+	}
+	stored, err := readKeyCheck(db)
+	if err != nil || stored != nil {
+		return err
+	}
+
+	var found bool
+	err = db.View(func(tx *bbolt.Tx) error {
+		bind, v := sampleValue(tx)
+		if v == nil {
+			return nil
+		}
+		found = true
+		if _, err := openEnvelope(v, aead, bind); err != nil {
+			return ErrInvalidPassword
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return err
+	}
+
+	check, err := keyCheck(km)
+	if err != nil {
+		return err
+	}
+	return storeKeyCheck(db, check)
+}
+
+// sampleValue returns the first encrypted value of the user buckets,
+// searching the buckets nested in them too, with the binding it is opened
+// with, or a nil value when they hold none.
+func sampleValue(tx *bbolt.Tx) (*binding, []byte) {
+	c := tx.Cursor()
+	for name, _ := c.First(); name != nil; name, _ = c.Next() {
+		if bytes.HasPrefix(name, reservedPrefix) {
+			continue
+		}
+		if bind, v := sampleBucket(tx.Bucket(name), name, nil); v != nil {
+			return bind, v
+		}
+	}
+	return nil, nil
+}
+
+// sampleBucket is sampleValue for the bucket b stored under name at path,
+// which is nil for a top-level bucket.
+func sampleBucket(b *bbolt.Bucket, name []byte, path [][]byte) (*binding, []byte) {
+	if path == nil {
+		path = [][]byte{name}
+	}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			return &binding{bucket: name, key: k}, v
+		}
+		child := b.Bucket(k)
+		if child == nil {
+			continue
+		}
+		childPath := append(append([][]byte{}, path...), k)
+		childName := append(append([]byte{}, nestedBucketPrefix...), CompositeKey(childPath...)...)
+		if bind, v := sampleBucket(child, childName, childPath); v != nil {
+			return bind, v
+		}
+	}
+	return nil, nil
+}
+
+// storeKeyCheck stores the key-check verifier in the securebolt_meta bucket.
+func storeKeyCheck(db *bbolt.DB, check []byte) error {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(keyCheckKey, check)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store key check: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package securebolt
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestStrictSecurity(t *testing.T) {
+	filename := "test_strict.db"
+	password := "correct horse battery staple 42"
+	bucketName := []byte("Secrets")
+	defer os.Remove(filename)
+	opts := &Options{StrictSecurity: true}
+
+	if _, err := OpenWithOptions(filename, 0600, []byte("1234"), opts); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("Expected ErrWeakPassword for a weak password, got %v", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("Expected a rejected password not to create the database")
+	}
+
+	db, err := OpenWithOptions(filename, 0600, []byte(password), opts)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("alice"), []byte("alice-secret")); err != nil {
+			return err
+		}
+		// Copy the ciphertext under another key, bypassing the wrapper
+		raw := tx.Bolt().Bucket(bucketName)
+		stored := append([]byte{}, raw.Get([]byte("alice"))...)
+		if stored[1]&flagBound == 0 {
+			t.Errorf("Expected the value to be sealed with flagBound")
+		}
+		return raw.Put([]byte("mallory"), stored)
+	})
+	if err != nil {
+		t.Fatalf("Failed to write values: %v", err)
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Get([]byte("mallory")); err == nil {
+			t.Errorf("Expected a ciphertext copied to another key not to decrypt")
+		}
+		return b.Delete([]byte("mallory"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to check key binding: %v", err)
+	}
+
+	if _, err := db.RefreshNonces(); err != nil {
+		t.Fatalf("Failed to refresh nonces: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("alice"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "alice-secret" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read value: %v", err)
+	}
+	db.Close()
+
+	if _, err := Open(filename, 0600, []byte("a different but long passphrase 7")); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword for a wrong password, got %v", err)
+	}
+	db, err = Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	db.Close()
+}
+
+func TestStrictKeyCheckWrongPasswordFirst(t *testing.T) {
+	filename := "test_strict_adopt.db"
+	password := "correct horse battery staple 42"
+	wrongPassword := "a different but long passphrase 7"
+	bucketName := []byte("Secrets")
+	defer os.Remove(filename)
+
+	// An existing database written without StrictSecurity has no verifier
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("alice"), []byte("alice-secret"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write value: %v", err)
+	}
+	db.Close()
+
+	opts := &Options{StrictSecurity: true}
+	if _, err := OpenWithOptions(filename, 0600, []byte(wrongPassword), opts); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword for a wrong first strict open, got %v", err)
+	}
+
+	db, err = OpenWithOptions(filename, 0600, []byte(password), opts)
+	if err != nil {
+		t.Fatalf("Failed to open database with the right password after a wrong one: %v", err)
+	}
+	err = db.View(func(tx *SecureTx) error {
+		if tx.Bolt().Bucket(metaBucket).Get(keyCheckKey) == nil {
+			t.Errorf("Expected the verifier to be stored once the key decrypted a value")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read key check: %v", err)
+	}
+	db.Close()
+
+	if _, err := Open(filename, 0600, []byte(wrongPassword)); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword from the adopted verifier, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package securebolt
+
+import (
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// tombstoneLength is the size of a tombstone's plaintext: its deletion time.
+const tombstoneLength = 8
+
+// SoftDelete replaces the value of key with an encrypted tombstone recording
+// when it was deleted, so the deletion can be replicated or audited before
+// Purge removes it. A tombstoned key reads as absent: Get returns nil for it,
+// and cursors, ForEach and every other scan and export step over it. Only
+// ForEachTombstone lists it. Deleting a key that does not exist or is already a tombstone does nothing.
+// Writing the key again with Put replaces the tombstone.
+func (sb *SecureBucket) SoftDelete(key []byte) error {
+	if err := sb.checkKey(key); err != nil {
+		return err
+	}
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	stored := sb.bucket.Get(key)
+	if stored == nil {
+		return nil
+	}
+	if sb.tombstoned(key, stored) {
+		return nil
+	}
+	old, err := sb.sideEntriesOf(key, stored)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := sb.bucketSettings()
+	if err != nil {
+		return err
+	}
+	var flags byte
+	if sb.tx.db.opts.StrictSecurity || cfg.bound {
+		flags |= flagBound
+	}
+	if err := sb.tx.chargeKeyUsage(tombstoneLength); err != nil {
+		return err
+	}
+	tombstone, err := sealTombstone(time.Now().UnixNano(), sb.aead, flags, sb.bindingOf(key))
+	if err != nil {
+		return err
+	}
+
+	if err := sb.bucket.Put(key, tombstone); err != nil {
+		return err
+	}
+	if err := sb.releaseSideEntries(key, old); err != nil {
+		return err
+	}
+	sb.tx.db.cache.invalidate(sb.name, key)
+	sb.tx.recordChange(OpDelete, sb.name, key, nil)
+	sb.tx.db.metrics.deletes.Add(1)
+	return nil
+}
+
+// ForEachTombstone calls fn with the key and deletion time of every
+// tombstone left in the bucket by SoftDelete.
+func (sb *SecureBucket) ForEachTombstone(fn func(k []byte, deletedAt time.Time) error) error {
+	if err := sb.checkOpen(); err != nil {
+		return err
+	}
+	c := sb.bucket.Cursor()
+	for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+		if len(v) == 0 || v[0] != tombstoneVersion {
+			continue
+		}
+		rec, err := sb.openFull(k, v)
+		if err != nil {
+			return err
+		}
+		if rec.deleted == 0 {
+			continue // A legacy value whose nonce starts like a tombstone
+		}
+		if err := fn(k, time.Unix(0, rec.deleted)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tombstoned reports whether the stored value of key is a SoftDelete
+// tombstone. Only values whose first byte is tombstoneVersion are decrypted,
+// to tell a tombstone from a legacy value whose random nonce starts with the
+// same byte; a value that fails to decrypt is reported as not a tombstone
+// and left for the caller to surface the error when it opens it.
+func (sb *SecureBucket) tombstoned(key, stored []byte) bool {
+	if len(stored) == 0 || stored[0] != tombstoneVersion {
+		return false
+	}
+	rec, err := sb.openFull(key, stored)
+	return err == nil && rec.deleted != 0
+}
+
+// liveCursor is a cursor over a SecureBucket that steps over SoftDelete
+// tombstones, so every scan built on it sees a soft-deleted key as absent.
+// Nested buckets are still returned with a nil value, as by bbolt.
+type liveCursor struct {
+	c  *bbolt.Cursor
+	sb *SecureBucket
+}
+
+// cursor returns a liveCursor over the bucket.
+func (sb *SecureBucket) cursor() *liveCursor {
+	return &liveCursor{c: sb.bucket.Cursor(), sb: sb}
+}
+
+func (lc *liveCursor) First() ([]byte, []byte) {
+	k, v := lc.c.First()
+	return lc.skip(k, v, lc.c.Next)
+}
+
+func (lc *liveCursor) Next() ([]byte, []byte) {
+	k, v := lc.c.Next()
+	return lc.skip(k, v, lc.c.Next)
+}
+
+func (lc *liveCursor) Prev() ([]byte, []byte) {
+	k, v := lc.c.Prev()
+	return lc.skip(k, v, lc.c.Prev)
+}
+
+func (lc *liveCursor) Seek(seek []byte) ([]byte, []byte) {
+	k, v := lc.c.Seek(seek)
+	return lc.skip(k, v, lc.c.Next)
+}
+
+// skip steps from k with step until it reaches a key that is not a
+// tombstone.
+func (lc *liveCursor) skip(k, v []byte, step func() ([]byte, []byte)) ([]byte, []byte) {
+	for k != nil && lc.sb.tombstoned(k, v) {
+		k, v = step()
+	}
+	return k, v
+}
+
+// Purge permanently removes tombstones older than olderThan from every
+// bucket, nested buckets included, and returns how many were removed.
+// Tombstones are recognized from their version byte, and only those are
+// decrypted to read their deletion time.
+func (s *SecureBolt) Purge(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan).UnixNano()
+	var purged int
+	err := s.Update(func(tx *SecureTx) error {
+		purged = 0
+		return tx.walkUserBuckets(func(b *SecureBucket) error {
+			var old [][]byte
+			err := b.ForEachTombstone(func(k []byte, deletedAt time.Time) error {
+				if deletedAt.UnixNano() < cutoff {
+					old = append(old, append([]byte{}, k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range old {
+				if err := b.bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			purged += len(old)
+			return nil
+		})
+	})
+	return purged, err
+}
@@ -0,0 +1,241 @@
+package securebolt
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	filename := "test_tombstone.db"
+	password := "secure-test-password"
+	bucketName := []byte("Users")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"alice", "bob", "carol"} {
+			if err := b.Put([]byte(k), []byte(k+"-secret")); err != nil {
+				return err
+			}
+		}
+		if err := b.SoftDelete([]byte("bob")); err != nil {
+			return err
+		}
+		return b.SoftDelete([]byte("missing"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to soft delete: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get([]byte("bob"))
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			t.Errorf("Expected a tombstoned key to read as absent, got %q", v)
+		}
+		if stored := b.bucket.Get([]byte("bob")); stored[0] != tombstoneVersion {
+			t.Errorf("Expected the tombstone to be sealed under tombstoneVersion, got %#x", stored[0])
+		}
+		if b.bucket.Get([]byte("missing")) != nil {
+			t.Errorf("Expected soft deleting a missing key to store nothing")
+		}
+
+		var seen []string
+		err = b.ForEach(func(k, v []byte) error {
+			seen = append(seen, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(seen) != 2 || seen[0] != "alice" || seen[1] != "carol" {
+			t.Errorf("Expected ForEach to skip the tombstone, got %v", seen)
+		}
+
+		var tombstones []string
+		err = b.ForEachTombstone(func(k []byte, deletedAt time.Time) error {
+			tombstones = append(tombstones, string(k))
+			if time.Since(deletedAt) > time.Minute {
+				t.Errorf("Unexpected deletion time %v", deletedAt)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(tombstones) != 1 || tombstones[0] != "bob" {
+			t.Errorf("Expected one tombstone for bob, got %v", tombstones)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read bucket: %v", err)
+	}
+
+	if n, err := db.Purge(time.Hour); err != nil || n != 0 {
+		t.Fatalf("Expected Purge to keep a recent tombstone, got %d, %v", n, err)
+	}
+	n, err := db.Purge(0)
+	if err != nil {
+		t.Fatalf("Failed to purge tombstones: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 tombstone purged, got %d", n)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if b.bucket.Get([]byte("bob")) != nil {
+			t.Errorf("Expected the purged tombstone to be removed")
+		}
+		v, err := b.Get([]byte("alice"))
+		if err != nil {
+			return err
+		}
+		if string(v) != "alice-secret" {
+			t.Errorf("Unexpected value %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read bucket after purge: %v", err)
+	}
+}
+
+func TestSoftDeleteHiddenFromScans(t *testing.T) {
+	filename := "test_tombstone_scans.db"
+	password := "secure-test-password"
+	bucketName := []byte("Users")
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "b", "c", "d"} {
+			if err := b.Put([]byte(k), []byte(k+"-secret")); err != nil {
+				return err
+			}
+		}
+		if err := b.SoftDelete([]byte("a")); err != nil {
+			return err
+		}
+		return b.SoftDelete([]byte("c"))
+	})
+	if err != nil {
+		t.Fatalf("Failed to soft delete: %v", err)
+	}
+
+	var archive, table bytes.Buffer
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+
+		c := b.Cursor()
+		var forward []string
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			forward = append(forward, string(k))
+		}
+		if len(forward) != 2 || forward[0] != "b" || forward[1] != "d" {
+			t.Errorf("Expected the cursor to step over tombstones, got %v", forward)
+		}
+		if k, v, err := c.Seek([]byte("c")); err != nil || string(k) != "d" || string(v) != "d-secret" {
+			t.Errorf("Expected Seek to land past the tombstone on d, got %q, %q, %v", k, v, err)
+		}
+		if k, _, err := c.Prev(); err != nil || string(k) != "b" {
+			t.Errorf("Expected Prev to step over the tombstone to b, got %q, %v", k, err)
+		}
+		if k, _, err := c.Prev(); err != nil || k != nil {
+			t.Errorf("Expected Prev to step over the first tombstone to the start, got %q, %v", k, err)
+		}
+
+		var sorted []string
+		err = b.SortedByValue(func(a, b []byte) bool { return bytes.Compare(a, b) < 0 }, func(k, v []byte) error {
+			sorted = append(sorted, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(sorted) != 2 {
+			t.Errorf("Expected SortedByValue to skip tombstones, got %v", sorted)
+		}
+
+		if err := b.ExportCSV(&table); err != nil {
+			return err
+		}
+		return b.ExportTar(&archive)
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan bucket: %v", err)
+	}
+
+	rows, err := csv.NewReader(&table).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("Expected a header and 2 rows in the CSV export, got %d rows", len(rows))
+	}
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucket([]byte("Restored"))
+		if err != nil {
+			return err
+		}
+		if err := b.ImportTar(&archive); err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "c"} {
+			if b.bucket.Get([]byte(k)) != nil {
+				t.Errorf("Expected soft-deleted key %q not to be restored by ImportTar", k)
+			}
+		}
+		for _, k := range []string{"b", "d"} {
+			v, err := b.Get([]byte(k))
+			if err != nil {
+				return err
+			}
+			if string(v) != k+"-secret" {
+				t.Errorf("Unexpected restored value %q for key %q", v, k)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to import archive: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package securebolt
+
+import (
+	"bytes"
+
+	"go.etcd.io/bbolt"
+)
+
+// BucketNode is a bucket in the hierarchy returned by Tree.
+type BucketNode struct {
+	Name     []byte        // Bucket name, nil for the root
+	Keys     int           // Number of values directly in the bucket
+	Children []*BucketNode // Nested buckets in key order
+}
+
+// BucketCount returns the number of buckets below n, at any depth.
+func (n *BucketNode) BucketCount() int {
+	count := len(n.Children)
+	for _, child := range n.Children {
+		count += child.BucketCount()
+	}
+	return count
+}
+
+// Tree returns the bucket hierarchy of the database with per-bucket key
+// counts. The returned root represents the database itself and has no keys;
+// its children are the top-level buckets, excluding the internal securebolt_
+// buckets. Values are counted but never decrypted.
+func (s *SecureBolt) Tree() (*BucketNode, error) {
+	root := &BucketNode{}
+	err := s.View(func(tx *SecureTx) error {
+		return tx.tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if bytes.HasPrefix(name, reservedPrefix) {
+				return nil
+			}
+			root.Children = append(root.Children, bucketTree(name, b))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// bucketTree builds the node of a bucket and its nested buckets.
+func bucketTree(name []byte, b *bbolt.Bucket) *BucketNode {
+	node := &BucketNode{Name: append([]byte{}, name...)}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			node.Keys++
+			continue
+		}
+		node.Children = append(node.Children, bucketTree(k, b.Bucket(k)))
+	}
+	return node
+}
+
+// Schema returns a fingerprint of the database structure: the key count of
+// every bucket, keyed by its path. Top-level buckets are keyed by name and
+// nested buckets by their names joined with "/", such as "users/admins".
+// Like Tree it excludes the internal securebolt_ buckets and decrypts
+// nothing, so fingerprints of different environments can be compared
+// without exposing data.
+func (s *SecureBolt) Schema() (map[string]int, error) {
+	root, err := s.Tree()
+	if err != nil {
+		return nil, err
+	}
+	schema := make(map[string]int)
+	var add func(prefix string, n *BucketNode)
+	add = func(prefix string, n *BucketNode) {
+		for _, child := range n.Children {
+			path := prefix + string(child.Name)
+			schema[path] = child.Keys
+			add(path+"/", child)
+		}
+	}
+	add("", root)
+	return schema, nil
+}
@@ -0,0 +1,108 @@
+package securebolt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	filename := "test_tree.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		if err := users.PutAll(map[string][]byte{"alice": []byte("1"), "bob": []byte("2")}); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte("empty")); err != nil {
+			return err
+		}
+
+		// Nested buckets are only reachable through the escape hatch
+		admins, err := tx.Bolt().Bucket([]byte("users")).CreateBucket([]byte("admins"))
+		if err != nil {
+			return err
+		}
+		if err := admins.Put([]byte("root"), []byte("x")); err != nil {
+			return err
+		}
+		_, err = admins.CreateBucket([]byte("audit"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to create buckets: %v", err)
+	}
+
+	root, err := db.Tree()
+	if err != nil {
+		t.Fatalf("Tree failed: %v", err)
+	}
+
+	var lines []string
+	var render func(n *BucketNode, depth int)
+	render = func(n *BucketNode, depth int) {
+		for _, child := range n.Children {
+			lines = append(lines, fmt.Sprintf("%s%s:%d", strings.Repeat(" ", depth), child.Name, child.Keys))
+			render(child, depth+1)
+		}
+	}
+	render(root, 0)
+
+	expected := []string{"empty:0", "users:2", " admins:1", "  audit:0"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected tree:\n%s\nexpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+	if n := root.BucketCount(); n != 4 {
+		t.Fatalf("BucketCount returned %d, expected 4", n)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	filename := "test_schema.db"
+	password := "secure-test-password"
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		orders, err := tx.CreateBucket([]byte("orders"))
+		if err != nil {
+			return err
+		}
+		if err := orders.PutAll(map[string][]byte{"1": []byte("a"), "2": []byte("b"), "3": []byte("c")}); err != nil {
+			return err
+		}
+		_, err = tx.Bolt().Bucket([]byte("orders")).CreateBucket([]byte("archive"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to create buckets: %v", err)
+	}
+
+	schema, err := db.Schema()
+	if err != nil {
+		t.Fatalf("Schema failed: %v", err)
+	}
+	expected := map[string]int{"orders": 3, "orders/archive": 0}
+	if fmt.Sprint(schema) != fmt.Sprint(expected) {
+		t.Fatalf("Schema is %v, expected %v", schema, expected)
+	}
+}
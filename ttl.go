@@ -0,0 +1,172 @@
+package securebolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// expiryIndexBucket maps expiry times to the keys that expire then, when
+// Options.ExpiryIndex is set. Index keys are
+//
+//	[expiry, 8-byte big endian][uvarint bucket length][bucket][key]
+//
+// so a cursor visits them in expiry order.
+var expiryIndexBucket = []byte("securebolt_expiry")
+
+// expiryHeaderLength is the size of the expiry time prefixed to expiring values.
+const expiryHeaderLength = 8
+
+// PutWithTTL stores value under key like Put, expiring it after ttl. The
+// expiry time is encrypted with the value. Get returns nil for an expired
+// key, while ForEach and cursors keep returning it until ReapExpired deletes
+// it. Overwriting the key with Put removes the expiry.
+func (sb *SecureBucket) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	return sb.put(key, value, nil, time.Now().Add(ttl).UnixNano())
+}
+
+// ReapExpired deletes every expired key in a single write transaction and
+// returns how many were deleted. With Options.ExpiryIndex it only visits the
+// index entries up to now, so its cost grows with the number of expired keys;
+// otherwise it scans every value in the database.
+func (s *SecureBolt) ReapExpired() (int, error) {
+	now := time.Now()
+	var n int
+	err := s.Update(func(tx *SecureTx) error {
+		var err error
+		if s.opts.ExpiryIndex {
+			n, err = tx.reapIndexed(now)
+		} else {
+			n, err = tx.reapByScan(now)
+		}
+		return err
+	})
+	return n, err
+}
+
+// reapIndexed deletes the keys the expiry index lists as expired by now.
+// Index entries that no longer match the stored value are dropped.
+func (stx *SecureTx) reapIndexed(now time.Time) (int, error) {
+	index := stx.tx.Bucket(expiryIndexBucket)
+	if index == nil {
+		return 0, nil
+	}
+	limit := Uint64Key(uint64(now.UnixNano()))
+
+	var due [][]byte
+	c := index.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:expiryHeaderLength], limit) <= 0; k, _ = c.Next() {
+		due = append(due, append([]byte{}, k...))
+	}
+
+	n := 0
+	for _, indexKey := range due {
+		name, key, expires, ok := parseExpiryIndexKey(indexKey)
+		if !ok {
+			return n, errors.New("invalid expiry index entry")
+		}
+		if err := index.Delete(indexKey); err != nil {
+			return n, err
+		}
+		sb := stx.bucketNamed(name)
+		if sb == nil {
+			continue
+		}
+		stored := sb.bucket.Get(key)
+		if stored == nil {
+			continue
+		}
+		rec, err := sb.openFull(key, stored)
+		if err != nil {
+			return n, err
+		}
+		if rec.expires != expires {
+			continue
+		}
+		if err := sb.Delete(key); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// reapByScan deletes expired keys by checking every value of every bucket,
+// nested buckets included. Values without an expiry are recognized from the
+// envelope header and are not decrypted.
+func (stx *SecureTx) reapByScan(now time.Time) (int, error) {
+	n := 0
+	err := stx.walkUserBuckets(func(sb *SecureBucket) error {
+		var due [][]byte
+		c := sb.bucket.Cursor()
+		for k, v := nextValue(c, true); k != nil; k, v = nextValue(c, false) {
+			h, _, _, _, ok := parseEnvelope(v, sb.aead.NonceSize())
+			if !ok || h.flags&flagExpiry == 0 {
+				continue
+			}
+			rec, err := sb.openFull(k, v)
+			if err != nil {
+				return err
+			}
+			if rec.expired(now) {
+				due = append(due, append([]byte{}, k...))
+			}
+		}
+		for _, key := range due {
+			if err := sb.Delete(key); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// indexExpiry adds key to the expiry index when the index is enabled.
+func (sb *SecureBucket) indexExpiry(key []byte, expires int64) error {
+	if !sb.tx.db.opts.ExpiryIndex {
+		return nil
+	}
+	index, err := sb.tx.tx.CreateBucketIfNotExists(expiryIndexBucket)
+	if err != nil {
+		return err
+	}
+	return index.Put(expiryIndexKey(sb.name, key, expires), []byte{})
+}
+
+// unindexExpiry removes key from the expiry index, if it is listed there.
+func (sb *SecureBucket) unindexExpiry(key []byte, expires int64) error {
+	index := sb.tx.tx.Bucket(expiryIndexBucket)
+	if index == nil {
+		return nil
+	}
+	return index.Delete(expiryIndexKey(sb.name, key, expires))
+}
+
+// expiryIndexKey builds the index key of a bucket key expiring at expires.
+func expiryIndexKey(bucket, key []byte, expires int64) []byte {
+	k := Uint64Key(uint64(expires))
+	k = binary.AppendUvarint(k, uint64(len(bucket)))
+	k = append(k, bucket...)
+	return append(k, key...)
+}
+
+// parseExpiryIndexKey splits an index key built by expiryIndexKey.
+func parseExpiryIndexKey(k []byte) (bucket, key []byte, expires int64, ok bool) {
+	if len(k) < expiryHeaderLength {
+		return nil, nil, 0, false
+	}
+	expires = int64(binary.BigEndian.Uint64(k))
+	rest := k[expiryHeaderLength:]
+	n, size := binary.Uvarint(rest)
+	if size <= 0 || uint64(len(rest)-size) < n {
+		return nil, nil, 0, false
+	}
+	rest = rest[size:]
+	return rest[:n], rest[n:], expires, true
+}
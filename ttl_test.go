@@ -0,0 +1,105 @@
+package securebolt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReapExpired(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index=%v", indexed), func(t *testing.T) {
+			filename := fmt.Sprintf("test_ttl_%v.db", indexed)
+			password := "secure-test-password"
+			bucketName := []byte("TTLBucket")
+
+			defer os.Remove(filename)
+
+			db, err := OpenWithOptions(filename, 0600, []byte(password), &Options{ExpiryIndex: indexed})
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			err = db.Update(func(tx *SecureTx) error {
+				b, err := tx.CreateBucket(bucketName)
+				if err != nil {
+					return err
+				}
+				if err := b.PutWithTTL([]byte("short-1"), []byte("a"), time.Millisecond); err != nil {
+					return err
+				}
+				if err := b.PutWithTTL([]byte("short-2"), []byte("b"), time.Millisecond); err != nil {
+					return err
+				}
+				if err := b.PutWithTTL([]byte("long"), []byte("c"), time.Hour); err != nil {
+					return err
+				}
+				return b.Put([]byte("forever"), []byte("d"))
+			})
+			if err != nil {
+				t.Fatalf("Failed to put values: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			// Expired keys are hidden from Get before they are reaped
+			err = db.View(func(tx *SecureTx) error {
+				b, err := tx.Bucket(bucketName)
+				if err != nil {
+					return err
+				}
+				for key, live := range map[string]bool{"short-1": false, "long": true, "forever": true} {
+					v, err := b.Get([]byte(key))
+					if err != nil {
+						return err
+					}
+					if (v != nil) != live {
+						t.Fatalf("Get(%q) = %q, expected live=%v", key, v, live)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to read values: %v", err)
+			}
+
+			n, err := db.ReapExpired()
+			if err != nil {
+				t.Fatalf("ReapExpired failed: %v", err)
+			}
+			if n != 2 {
+				t.Fatalf("ReapExpired deleted %d keys, expected 2", n)
+			}
+
+			err = db.Update(func(tx *SecureTx) error {
+				b, err := tx.Bucket(bucketName)
+				if err != nil {
+					return err
+				}
+				if n := b.bucket.Stats().KeyN; n != 2 {
+					t.Fatalf("Bucket holds %d keys after reaping, expected 2", n)
+				}
+				return b.Delete([]byte("long"))
+			})
+			if err != nil {
+				t.Fatalf("Failed to delete key: %v", err)
+			}
+
+			// Delete removes the remaining index entry
+			err = db.View(func(tx *SecureTx) error {
+				index := tx.Bolt().Bucket(expiryIndexBucket)
+				if indexed && (index == nil || index.Stats().KeyN != 0) {
+					t.Fatalf("Expiry index is not empty after deleting every expiring key")
+				}
+				if !indexed && index != nil {
+					t.Fatalf("Expiry index created while disabled")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to inspect expiry index: %v", err)
+			}
+		})
+	}
+}
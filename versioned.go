@@ -0,0 +1,62 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// versionHeaderLength is the size of the version prefixed to versioned values.
+const versionHeaderLength = 8
+
+// PutVersioned stores value under key together with a version one higher than
+// the current one, and returns the new version. The version is part of the
+// encrypted plaintext so it is authenticated with the value. Keys written with
+// PutVersioned must only be read and written with the versioned methods.
+func (sb *SecureBucket) PutVersioned(key, value []byte) (uint64, error) {
+	_, current, err := sb.GetVersioned(key)
+	if err != nil {
+		return 0, err
+	}
+	return sb.putVersion(key, value, current+1)
+}
+
+// GetVersioned returns the value and version stored under key. A missing key
+// returns a nil value and version 0.
+func (sb *SecureBucket) GetVersioned(key []byte) ([]byte, uint64, error) {
+	record, err := sb.Get(key)
+	if err != nil || record == nil {
+		return nil, 0, err
+	}
+	if len(record) < versionHeaderLength {
+		return nil, 0, fmt.Errorf("value for key %q is not a versioned record", key)
+	}
+	version, _ := ParseUint64Key(record[:versionHeaderLength])
+	return record[versionHeaderLength:], version, nil
+}
+
+// UpdateIfVersion stores value under key only if the current version equals
+// expected, returning the new version. Use an expected version of 0 to
+// require that the key does not exist yet. On mismatch it returns
+// ErrVersionConflict and leaves the stored value untouched.
+func (sb *SecureBucket) UpdateIfVersion(key, value []byte, expected uint64) (uint64, error) {
+	_, current, err := sb.GetVersioned(key)
+	if err != nil {
+		return 0, err
+	}
+	if current != expected {
+		return current, fmt.Errorf("%w: key %q is at version %d, expected %d", ErrVersionConflict, key, current, expected)
+	}
+	return sb.putVersion(key, value, current+1)
+}
+
+// putVersion stores the (version, value) record under key.
+func (sb *SecureBucket) putVersion(key, value []byte, version uint64) (uint64, error) {
+	if version == 0 {
+		return 0, errors.New("version overflow")
+	}
+	record := append(Uint64Key(version), value...)
+	if err := sb.Put(key, record); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
@@ -0,0 +1,73 @@
+package securebolt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestUpdateIfVersion(t *testing.T) {
+	filename := "test_versioned.db"
+	password := "secure-test-password"
+	bucketName := []byte("VersionedBucket")
+	key := []byte("record")
+
+	defer os.Remove(filename)
+
+	db, err := Open(filename, 0600, []byte(password))
+	if err != nil {
+		t.Fatalf("Failed to open SecureBolt: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *SecureTx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		version, err := b.PutVersioned(key, []byte("v1"))
+		if err != nil {
+			return err
+		}
+		if version != 1 {
+			return fmt.Errorf("first write got version %d, expected 1", version)
+		}
+
+		// A conditional update against the current version succeeds
+		version, err = b.UpdateIfVersion(key, []byte("v2"), 1)
+		if err != nil {
+			return err
+		}
+		if version != 2 {
+			return fmt.Errorf("conditional update got version %d, expected 2", version)
+		}
+
+		// A conditional update against a stale version conflicts
+		if _, err := b.UpdateIfVersion(key, []byte("stale"), 1); !errors.Is(err, ErrVersionConflict) {
+			return fmt.Errorf("expected ErrVersionConflict, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	err = db.View(func(tx *SecureTx) error {
+		b, err := tx.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		value, version, err := b.GetVersioned(key)
+		if err != nil {
+			return err
+		}
+		if string(value) != "v2" || version != 2 {
+			return fmt.Errorf("got %q at version %d, expected %q at version 2", value, version, "v2")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+}